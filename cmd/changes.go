@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// printChanges writes a table of the changes followed by a summary line
+func printChanges(w io.Writer, changes plan.Changes) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tNAME\tTYPE\tTTL\tTARGETS")
+	for _, ep := range changes.Create {
+		fmt.Fprintf(tw, "create\t%s\t%s\t%d\t%s\n", displayName(ep), ep.RecordType, ep.RecordTTL, displayTargets(ep))
+	}
+	for i, ep := range changes.UpdateNew {
+		// Updates are sorted by pairs, the old endpoint is the one at the same index
+		if i >= len(changes.UpdateOld) {
+			break
+		}
+		previous := changes.UpdateOld[i]
+		ttl := fmt.Sprint(ep.RecordTTL)
+		if previous.RecordTTL != ep.RecordTTL {
+			ttl = fmt.Sprintf("%d -> %d", previous.RecordTTL, ep.RecordTTL)
+		}
+		targets := displayTargets(ep)
+		if previous := displayTargets(previous); previous != targets {
+			targets = previous + " -> " + targets
+		}
+		fmt.Fprintf(tw, "update\t%s\t%s\t%s\t%s\n", displayName(ep), ep.RecordType, ttl, targets)
+	}
+	for _, ep := range changes.Delete {
+		fmt.Fprintf(tw, "delete\t%s\t%s\t%d\t%s\n", displayName(ep), ep.RecordType, ep.RecordTTL, displayTargets(ep))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d to create, %d to update, %d to delete\n", len(changes.Create), len(changes.UpdateNew), len(changes.Delete))
+	return err
+}
+
+func displayName(ep *endpoint.Endpoint) string {
+	name := strings.TrimSuffix(ep.DNSName, ".")
+	if ep.SetIdentifier != "" {
+		name += " (" + ep.SetIdentifier + ")"
+	}
+	return name
+}
+
+func displayTargets(ep *endpoint.Endpoint) string {
+	return strings.Join(ep.Targets, ", ")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/michelangelomo/external-dns-desec-provider/internal/provider"
+	log "github.com/sirupsen/logrus"
+)
+
+// commands are the one-shot subcommands, the webhook runs without any
+var commands = map[string]func(args []string) error{
+	"export":              runExport,
+	"export-dnsendpoints": runExportDNSEndpoints,
+	"import":              runImport,
+	"plan":                runPlan,
+}
+
+// runCommand runs a subcommand and returns the exit code
+func runCommand(name string, args []string) int {
+	command, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q, available commands: %s\n", name, strings.Join(slices.Sorted(maps.Keys(commands)), ", "))
+		return 2
+	}
+	err := command(args)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.As(err, new(usageError)):
+		// The usage was already printed along with the error
+		return 2
+	default:
+		log.Errorf("%s failed: %v", name, err)
+		return 1
+	}
+}
+
+// usageError reports invalid command line arguments, once the usage of the
+// command has been printed
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+// parseFlags parses the arguments of a subcommand
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{err: err}
+	}
+	return nil
+}
+
+// flagError prints an invalid argument error and the usage like the flag
+// package does
+func flagError(flags *flag.FlagSet, err error) error {
+	fmt.Fprintln(flags.Output(), err)
+	flags.Usage()
+	return usageError{err: err}
+}
+
+// registryFlags registers the flags of the external-dns TXT registry naming
+func registryFlags(flags *flag.FlagSet, options *provider.OwnershipOptions) {
+	flags.StringVar(&options.TXTPrefix, "txt-prefix", "", "prefix of the TXT registry records, like external-dns --txt-prefix")
+	flags.StringVar(&options.TXTSuffix, "txt-suffix", "", "suffix of the TXT registry records, like external-dns --txt-suffix")
+	flags.StringVar(&options.WildcardReplacement, "txt-wildcard-replacement", "", "replacement of * in the TXT registry records, like external-dns --txt-wildcard-replacement")
+}
+
+// openInput opens a file, - for stdin
+func openInput(file string) (io.ReadCloser, error) {
+	if file == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(file)
+}
+
+// newCommandClient creates a deSEC client from the environment like the webhook does
+func newCommandClient() (*provider.DesecClient, error) {
+	config, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	log.SetLevel(config.LogLevel)
+	return provider.CreateDesecClient(config)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/manifest"
+	"github.com/michelangelomo/external-dns-desec-provider/internal/provider"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	groupByZone      = "zone"
+	groupByNamespace = "namespace"
+)
+
+// runExportDNSEndpoints writes the records of managed zones as DNSEndpoint
+// resources, for the external-dns CRD source
+func runExportDNSEndpoints(args []string) error {
+	flags := flag.NewFlagSet("export-dnsendpoints", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: webhook export-dnsendpoints [-output FILE] [-group-by zone|namespace] [-exclude-registry] [zone...]")
+		fmt.Fprintln(flags.Output(), "Writes the records of the managed zones, or the given ones, as DNSEndpoint resources.")
+		flags.PrintDefaults()
+	}
+	output := flags.String("output", "-", "file to write the resources to, - for stdout")
+	groupBy := flags.String("group-by", groupByZone, "one resource per zone, or per zone and namespace of the owning resource")
+	namespace := flags.String("namespace", "", "namespace of the resources, or of the records without an owning resource with -group-by namespace")
+	excludeRegistry := flags.Bool("exclude-registry", false, "leave out the external-dns TXT registry records")
+	var ownership provider.OwnershipOptions
+	registryFlags(flags, &ownership)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *groupBy != groupByZone && *groupBy != groupByNamespace {
+		return flagError(flags, fmt.Errorf("unknown grouping %q", *groupBy))
+	}
+
+	client, err := newCommandClient()
+	if err != nil {
+		return err
+	}
+	zones := flags.Args()
+	if len(zones) == 0 {
+		zones = client.ManagedZones()
+	}
+
+	var resources []manifest.Resource
+	for _, zone := range zones {
+		endpoints, registryRecords, err := client.RegistryEndpoints(zone, ownership)
+		if err != nil {
+			return err
+		}
+		if !*excludeRegistry {
+			endpoints = append(endpoints, registryRecords...)
+		}
+
+		groups := make(map[string][]*endpoint.Endpoint)
+		for _, ep := range endpoints {
+			if ep.RecordType == endpoint.RecordTypeNS && strings.TrimSuffix(ep.DNSName, ".") == strings.TrimSuffix(zone, ".") {
+				// deSEC maintains the apex NS records
+				continue
+			}
+			group := *namespace
+			if *groupBy == groupByNamespace {
+				group = resourceNamespace(ep, *namespace)
+			}
+			groups[group] = append(groups[group], ep)
+		}
+		for group, endpoints := range groups {
+			resources = append(resources, manifest.Resource{Name: manifest.ResourceName(zone), Namespace: group, Endpoints: endpoints})
+		}
+	}
+
+	if *output == "-" {
+		return manifest.WriteDNSEndpoints(os.Stdout, resources)
+	}
+	err = writeFile(*output, func(w io.Writer) error {
+		return manifest.WriteDNSEndpoints(w, resources)
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("exported %d DNSEndpoint resources to %s", len(resources), *output)
+	return nil
+}
+
+// resourceNamespace returns the namespace of the resource owning an endpoint
+// according to the TXT registry, like shop for ingress/shop/www
+func resourceNamespace(ep *endpoint.Endpoint, fallback string) string {
+	parts := strings.Split(ep.Labels[endpoint.ResourceLabelKey], "/")
+	if len(parts) != 3 || parts[1] == "" {
+		return fallback
+	}
+	return parts[1]
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// runExport writes managed zones as RFC 1035 master files
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: webhook export [-output DIR] [zone...]")
+		fmt.Fprintln(flags.Output(), "Writes the managed zones, or the given ones, to <zone>.zone files.")
+		flags.PrintDefaults()
+	}
+	output := flags.String("output", ".", "directory to write the zone files to, - for stdout")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	client, err := newCommandClient()
+	if err != nil {
+		return err
+	}
+	zones := flags.Args()
+	if len(zones) == 0 {
+		zones = client.ManagedZones()
+	}
+
+	for _, zone := range zones {
+		if *output == "-" {
+			if err := client.ExportZone(os.Stdout, zone); err != nil {
+				return err
+			}
+			continue
+		}
+		path := filepath.Join(*output, zone+".zone")
+		err := writeFile(path, func(w io.Writer) error {
+			return client.ExportZone(w, zone)
+		})
+		if err != nil {
+			return err
+		}
+		log.Infof("exported zone %s to %s", zone, path)
+	}
+	return nil
+}
+
+// writeFile writes to a temporary file renamed to path once complete, so a
+// failed export never leaves a truncated backup behind
+func writeFile(path string, write func(w io.Writer) error) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
+
+	if err := write(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
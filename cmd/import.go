@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/manifest"
+	"github.com/michelangelomo/external-dns-desec-provider/internal/provider"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	formatZone        = "zone"
+	formatDNSEndpoint = "dnsendpoint"
+)
+
+// runImport loads records from a zone file or DNSEndpoint manifests into a
+// managed zone. The changes are always previewed and only applied with -apply.
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: webhook import -zone ZONE [-format zone|dnsendpoint] [-apply] [-prune] [-owner-id ID] FILE")
+		fmt.Fprintln(flags.Output(), "Imports the records of a zone file or DNSEndpoint manifests, - reads stdin.")
+		flags.PrintDefaults()
+	}
+	zone := flags.String("zone", "", "managed zone to import the records into")
+	format := flags.String("format", "", "input format, zone or dnsendpoint (default from the file extension)")
+	apply := flags.Bool("apply", false, "apply the changes instead of only printing them")
+	prune := flags.Bool("prune", false, "delete the records of the zone missing from the input")
+	var ownership provider.OwnershipOptions
+	flags.StringVar(&ownership.OwnerID, "owner-id", "", "write external-dns TXT registry records with this owner ID")
+	registryFlags(flags, &ownership)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *zone == "" || flags.NArg() != 1 {
+		return flagError(flags, errors.New("a zone and a single file are required"))
+	}
+	file := flags.Arg(0)
+	if *format == "" {
+		*format = formatZone
+		if ext := strings.ToLower(filepath.Ext(file)); ext == ".yaml" || ext == ".yml" || ext == ".json" {
+			*format = formatDNSEndpoint
+		}
+	}
+	if *format != formatZone && *format != formatDNSEndpoint {
+		return flagError(flags, fmt.Errorf("unknown format %q", *format))
+	}
+
+	endpoints, err := readImport(file, *format, *zone)
+	if err != nil {
+		return err
+	}
+	if ownership.OwnerID != "" {
+		records, err := provider.OwnershipRecords(endpoints, ownership)
+		if err != nil {
+			return fmt.Errorf("failed to generate the TXT registry records: %w", err)
+		}
+		endpoints = append(endpoints, records...)
+	}
+
+	client, err := newCommandClient()
+	if err != nil {
+		return err
+	}
+	changes, err := client.DiffZone(*zone, endpoints, *prune)
+	if err != nil {
+		return err
+	}
+	if err := printChanges(os.Stdout, changes); err != nil {
+		return err
+	}
+	if !*apply {
+		log.Info("preview only, run again with -apply to apply the changes")
+		return nil
+	}
+	if err := client.ApplyChanges(changes); err != nil {
+		return err
+	}
+	log.Infof("imported %s into zone %s", file, *zone)
+	return nil
+}
+
+// readImport parses the endpoints of a file in the given format
+func readImport(file, format, zone string) ([]*endpoint.Endpoint, error) {
+	r, err := openInput(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+
+	if format == formatDNSEndpoint {
+		return manifest.ReadDNSEndpoints(r)
+	}
+	return provider.ParseZoneFile(r, zone)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/manifest"
+	"github.com/michelangelomo/external-dns-desec-provider/internal/provider"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// runPlan prints the changes external-dns would send for the desired endpoints
+// of a file, without applying them
+func runPlan(args []string) error {
+	flags := flag.NewFlagSet("plan", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: webhook plan [-output table|json] [-policy sync] [-owner-id ID] FILE")
+		fmt.Fprintln(flags.Output(), "Prints the changes external-dns would make for the endpoints or DNSEndpoint resources of a JSON or YAML file, - reads stdin.")
+		flags.PrintDefaults()
+	}
+	output := flags.String("output", outputTable, "output format, table or json")
+	var options provider.PlanOptions
+	flags.StringVar(&options.Policy, "policy", "sync", "external-dns --policy: sync, upsert-only or create-only")
+	flags.StringVar(&options.Ownership.OwnerID, "owner-id", "default", "external-dns --txt-owner-id")
+	registryFlags(flags, &options.Ownership)
+	managedTypes := flags.String("managed-record-types", "A,AAAA,CNAME", "comma-separated external-dns --managed-record-types")
+	excludeTypes := flags.String("exclude-record-types", "", "comma-separated external-dns --exclude-record-types")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return flagError(flags, errors.New("a single file is required"))
+	}
+	if *output != outputTable && *output != outputJSON {
+		return flagError(flags, fmt.Errorf("unknown output format %q", *output))
+	}
+	options.ManagedRecordTypes = splitList(*managedTypes)
+	options.ExcludeRecordTypes = splitList(*excludeTypes)
+
+	file, err := openInput(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	desired, err := manifest.ReadDNSEndpoints(file)
+	if err != nil {
+		return err
+	}
+
+	client, err := newCommandClient()
+	if err != nil {
+		return err
+	}
+	changes, invalid, err := client.Plan(desired, options)
+	if err != nil {
+		return err
+	}
+	for _, ep := range invalid {
+		log.Warnf("dropping invalid endpoint %s/%s: %s", ep.DNSName, ep.RecordType, ep.Reason)
+	}
+	if *output == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(changes)
+	}
+	return printChanges(os.Stdout, changes)
+}
+
+// splitList splits a comma-separated list, ignoring empty items
+func splitList(value string) []string {
+	var items []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -8,6 +8,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/michelangelomo/external-dns-desec-provider/internal/admin"
 	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
 	"github.com/michelangelomo/external-dns-desec-provider/internal/health"
 	"github.com/michelangelomo/external-dns-desec-provider/internal/provider"
@@ -20,6 +21,11 @@ var (
 )
 
 func main() {
+	// Subcommands run once and exit, the webhook runs without arguments
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	log.Infof("starting external-dns-desec-provider %s", Version)
 	// Load configuration
 	config, err := config.LoadConfig()
@@ -38,6 +44,25 @@ func main() {
 		log.Fatalf("failed to create Desec client: %v", err)
 	}
 
+	// Keep flattened apex CNAMEs up to date with their targets. Outside of
+	// ALIAS mode, the refresher only starts once a record opts in with
+	// desec/alias.
+	refreshCtx, stopRefresh := context.WithCancel(context.Background())
+	defer stopRefresh()
+	desecClient.StartAliasRefresher(refreshCtx, config.AliasRefreshInterval)
+
+	// Keep the NS and DS records of managed subzones in sync with their parent
+	if config.DelegationSync {
+		log.Infof("syncing subzone delegations every %s", config.DelegationSyncInterval)
+		go desecClient.RunDelegationSync(refreshCtx, config.DelegationSyncInterval)
+	}
+
+	// Report, and optionally restore, RRsets changed outside of the webhook
+	if config.DriftDetection {
+		log.Infof("checking zones for drift every %s, against the changes applied from now on", config.DriftCheckInterval)
+		go desecClient.RunDriftCheck(refreshCtx, config.DriftCheckInterval)
+	}
+
 	// Initialize the webhook server
 	log.Infof("initializing webhook server on %s", config.GetListeningAddress())
 	server := server.NewWebhookServer(desecClient, config)
@@ -45,6 +70,7 @@ func main() {
 	// Initialize the health server
 	log.Infof("initializing health server on %s", config.GetHealthListeningAddress())
 	healthServer := health.NewHealthServer()
+	healthServer.Handle("/admin/", admin.NewHandler(desecClient, config))
 
 	// Create a channel to listen for OS signals
 	stop := make(chan os.Signal, 1)
@@ -80,6 +106,8 @@ func main() {
 		log.Errorf("health server failed: %v", err)
 	}
 
+	stopRefresh()
+
 	// Create a timeout context for shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -0,0 +1,139 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/michelangelomo/external-dns-desec-provider/internal/provider"
+	log "github.com/sirupsen/logrus"
+)
+
+// Provider is the part of the deSEC client used by the admin endpoints
+type Provider interface {
+	DNSSECStatuses(checkParent bool) ([]provider.DNSSECStatus, error)
+	ExportZone(w io.Writer, zone string) error
+	DriftReports(check bool) []provider.DriftReport
+	LastApply() *provider.ApplyResult
+}
+
+type admin struct {
+	provider Provider
+}
+
+// errorResponse is the JSON body sent along with error status codes
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewHandler returns the read-only admin endpoints, served below /admin/
+func NewHandler(provider Provider, config config.Config) http.Handler {
+	admin := admin{provider: provider}
+
+	mux := mux.NewRouter()
+	if config.AdminDNSSECStatus {
+		mux.HandleFunc("/admin/dnssec", admin.dnssecHandler).Methods("GET")
+	}
+	if config.AdminApplyResults {
+		mux.HandleFunc("/admin/apply", admin.applyHandler).Methods("GET")
+	}
+	if config.AdminZoneExport {
+		mux.HandleFunc("/admin/zones/{zone}", admin.zoneHandler).Methods("GET")
+	}
+	if config.DriftDetection {
+		mux.HandleFunc("/admin/drift", admin.driftHandler).Methods("GET")
+	}
+	return mux
+}
+
+// checkParameter parses the optional boolean check query parameter
+func checkParameter(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("check")
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// dnssecHandler lists the DS records, keys and delegation status of every
+// managed zone. With ?check=true the DS records published by the parents are
+// compared as well.
+func (admin admin) dnssecHandler(w http.ResponseWriter, r *http.Request) {
+	check, err := checkParameter(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid check parameter"})
+		return
+	}
+
+	statuses, err := admin.provider.DNSSECStatuses(check)
+	if err != nil {
+		log.Errorf("failed to get DNSSEC status: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	if statuses == nil {
+		statuses = []provider.DNSSECStatus{}
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// driftHandler lists the drift between the last state applied and deSEC of
+// every zone, as of the last drift check or a new one with ?check=true
+func (admin admin) driftHandler(w http.ResponseWriter, r *http.Request) {
+	check, err := checkParameter(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid check parameter"})
+		return
+	}
+	reports := admin.provider.DriftReports(check)
+	if reports == nil {
+		reports = []provider.DriftReport{}
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// applyHandler returns the outcome of every zone and RRset of the last apply
+func (admin admin) applyHandler(w http.ResponseWriter, r *http.Request) {
+	result := admin.provider.LastApply()
+	if result == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "no changes applied yet"})
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// zoneHandler serves a managed zone as an RFC 1035 master file
+func (admin admin) zoneHandler(w http.ResponseWriter, r *http.Request) {
+	zone := mux.Vars(r)["zone"]
+
+	var buf bytes.Buffer
+	if err := admin.provider.ExportZone(&buf, zone); err != nil {
+		if errors.Is(err, provider.ErrZoneNotManaged) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+			return
+		}
+		log.Errorf("failed to export zone %s: %v", zone, err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "text/dns")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		log.Errorf("failed to encode response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
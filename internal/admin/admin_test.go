@@ -0,0 +1,224 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/michelangelomo/external-dns-desec-provider/internal/provider"
+)
+
+type fakeProvider struct {
+	statuses    []provider.DNSSECStatus
+	err         error
+	checkParent bool
+	zones       map[string]string
+	drift       []provider.DriftReport
+	checked     bool
+	lastApply   *provider.ApplyResult
+}
+
+func (f *fakeProvider) DNSSECStatuses(checkParent bool) ([]provider.DNSSECStatus, error) {
+	f.checkParent = checkParent
+	return f.statuses, f.err
+}
+
+func (f *fakeProvider) ExportZone(w io.Writer, zone string) error {
+	if f.err != nil {
+		return f.err
+	}
+	content, ok := f.zones[zone]
+	if !ok {
+		return fmt.Errorf("%w: %s", provider.ErrZoneNotManaged, zone)
+	}
+	_, err := io.WriteString(w, content)
+	return err
+}
+
+func (f *fakeProvider) DriftReports(check bool) []provider.DriftReport {
+	f.checked = check
+	return f.drift
+}
+
+func (f *fakeProvider) LastApply() *provider.ApplyResult {
+	return f.lastApply
+}
+
+func TestDNSSECHandler(t *testing.T) {
+	fake := &fakeProvider{statuses: []provider.DNSSECStatus{{
+		Zone: "example.com",
+		DS:   []string{"2371 13 2 1f987cc6583e92796abc86ff3a03cbd5"},
+		Keys: []provider.DNSSECKey{{Flags: 257, KeyType: "csk", DS: []string{"2371 13 2 1f987cc6583e92796abc86ff3a03cbd5"}}},
+	}}}
+	handler := NewHandler(fake, config.Config{AdminDNSSECStatus: true})
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedCheck  bool
+	}{
+		{name: "List", url: "/admin/dnssec", expectedStatus: http.StatusOK},
+		{name: "Check parents", url: "/admin/dnssec?check=true", expectedStatus: http.StatusOK, expectedCheck: true},
+		{name: "Invalid check", url: "/admin/dnssec?check=maybe", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.checkParent = false
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.expectedStatus)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if fake.checkParent != tt.expectedCheck {
+				t.Errorf("checkParent = %v, want %v", fake.checkParent, tt.expectedCheck)
+			}
+			var statuses []provider.DNSSECStatus
+			if err := json.Unmarshal(w.Body.Bytes(), &statuses); err != nil || len(statuses) != 1 || statuses[0].Zone != "example.com" {
+				t.Errorf("body = %s, %v", w.Body.String(), err)
+			}
+		})
+	}
+}
+
+func TestDNSSECHandlerDisabled(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewHandler(&fakeProvider{}, config.Config{}).ServeHTTP(w, httptest.NewRequest("GET", "/admin/dnssec", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestDNSSECHandlerError(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewHandler(&fakeProvider{err: errors.New("deSEC unavailable")}, config.Config{AdminDNSSECStatus: true}).ServeHTTP(w, httptest.NewRequest("GET", "/admin/dnssec", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	var body errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error != "deSEC unavailable" {
+		t.Errorf("body = %s, %v", w.Body.String(), err)
+	}
+}
+
+func TestZoneHandler(t *testing.T) {
+	zone := "$ORIGIN example.com.\n$TTL 3600\n@ 3600 IN A 192.0.2.1\n"
+	fake := &fakeProvider{zones: map[string]string{"example.com": zone}}
+
+	tests := []struct {
+		name           string
+		config         config.Config
+		url            string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Disabled", url: "/admin/zones/example.com", expectedStatus: http.StatusNotFound},
+		{name: "Export", config: config.Config{AdminZoneExport: true}, url: "/admin/zones/example.com", expectedStatus: http.StatusOK, expectedBody: zone},
+		{name: "Unmanaged zone", config: config.Config{AdminZoneExport: true}, url: "/admin/zones/example.org", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewHandler(fake, tt.config).ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.expectedStatus)
+			}
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestDriftHandler(t *testing.T) {
+	fake := &fakeProvider{drift: []provider.DriftReport{{
+		Zone:    "example.com",
+		Tracked: 2,
+		Drifts: []provider.Drift{{
+			Name:    "www.example.com",
+			Type:    "A",
+			Kind:    provider.DriftModified,
+			Desired: &provider.DriftRRSet{TTL: 3600, Records: []string{"192.0.2.1"}},
+			Actual:  &provider.DriftRRSet{TTL: 3600, Records: []string{"192.0.2.9"}},
+		}},
+	}}}
+
+	w := httptest.NewRecorder()
+	NewHandler(fake, config.Config{}).ServeHTTP(w, httptest.NewRequest("GET", "/admin/drift", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status without drift detection = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	w = httptest.NewRecorder()
+	NewHandler(fake, config.Config{DriftDetection: true}).ServeHTTP(w, httptest.NewRequest("GET", "/admin/drift?check=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !fake.checked {
+		t.Error("check=true did not run a drift check")
+	}
+	var reports []provider.DriftReport
+	if err := json.Unmarshal(w.Body.Bytes(), &reports); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(reports) != 1 || len(reports[0].Drifts) != 1 || reports[0].Drifts[0].Actual.Records[0] != "192.0.2.9" {
+		t.Errorf("reports = %+v", reports)
+	}
+
+	w = httptest.NewRecorder()
+	NewHandler(fake, config.Config{DriftDetection: true}).ServeHTTP(w, httptest.NewRequest("GET", "/admin/drift?check=maybe", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status with an invalid check = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestApplyHandler(t *testing.T) {
+	fake := &fakeProvider{}
+
+	w := httptest.NewRecorder()
+	NewHandler(fake, config.Config{AdminApplyResults: true}).ServeHTTP(w, httptest.NewRequest("GET", "/admin/apply", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status before any apply = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	fake.lastApply = &provider.ApplyResult{Status: provider.ApplyPartial, Zones: []provider.ZoneResult{
+		{Zone: "example.com", Status: provider.ResultApplied, RRSets: []provider.RRSetResult{
+			{Name: "www.example.com", Type: "A", Action: "create", Status: provider.ResultApplied},
+		}},
+		{Zone: "example.org", Status: provider.ResultFailed, Error: "422", RRSets: []provider.RRSetResult{
+			{Name: "www.example.org", Type: "A", Action: "create", Status: provider.ResultFailed, Reason: "422"},
+		}},
+	}}
+	// The results are only served when enabled
+	w = httptest.NewRecorder()
+	NewHandler(fake, config.Config{}).ServeHTTP(w, httptest.NewRequest("GET", "/admin/apply", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status when disabled = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	w = httptest.NewRecorder()
+	NewHandler(fake, config.Config{AdminApplyResults: true}).ServeHTTP(w, httptest.NewRequest("GET", "/admin/apply", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var result provider.ApplyResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if result.Status != provider.ApplyPartial || len(result.Zones) != 2 || result.Zones[1].RRSets[0].Status != provider.ResultFailed {
+		t.Errorf("result = %+v", result)
+	}
+}
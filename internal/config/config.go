@@ -2,16 +2,52 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	log "github.com/sirupsen/logrus"
 )
 
 type Config struct {
-	APIToken      string   `required:"true"`
-	DryRun        bool     `default:"false"`
-	DomainFilters []string `required:"true"`
-	DefaultTTL    int      `default:"3600"`
+	APIToken      string    `required:"true"`
+	DryRun        bool      `default:"false"`
+	DomainFilters []string  `required:"true"`
+	DefaultTTL    int       `default:"3600"`
+	ReverseZones  []string  `default:""`
+	TTLPolicy     TTLPolicy `default:""`
+
+	// CompareAndSwap refuses updates and deletes of records changed since
+	// external-dns read them
+	CompareAndSwap bool `default:"false"`
+
+	// PartialApply keeps applying the changes of the other zones when the ones
+	// of a zone fail
+	PartialApply bool `default:"false"`
+
+	// BulkChunkSize is the maximum number of RRsets sent in a bulk request,
+	// 0 sends every RRset of a zone at once in a single atomic request
+	BulkChunkSize int `default:"0"`
+	// BulkChunkRetries is the number of times a throttled or failed chunk is
+	// sent again
+	BulkChunkRetries int `default:"3"`
+	// WriteRateLimit is the number of write requests sent per second, 0
+	// disables the limit. WriteRateBurst only applies along with a limit.
+	WriteRateLimit float64 `default:"0"`
+	WriteRateBurst int     `default:"5"`
+
+	DelegationSync         bool          `default:"false"`
+	DelegationSyncInterval time.Duration `default:"10m"`
+	DNSSECResolver         string        `default:""`
+
+	AliasMode            bool          `default:"false"`
+	AliasResolver        string        `default:""`
+	AliasRefreshInterval time.Duration `default:"5m"`
+
+	// DriftDetection compares the zones with the state applied since the
+	// webhook started, which is only kept in memory
+	DriftDetection     bool          `default:"false"`
+	DriftCheckInterval time.Duration `default:"10m"`
+	DriftAutoHeal      bool          `default:"false"`
 
 	WebhookAddress string `default:"127.0.0.1"`
 	WebhookPort    int    `default:"8888"`
@@ -19,6 +55,13 @@ type Config struct {
 	HealthAddress string `default:"0.0.0.0"`
 	HealthPort    int    `default:"8080"`
 
+	// AdminZoneExport serves the zone files of the managed zones on the health server
+	AdminZoneExport bool `default:"false"`
+	// AdminDNSSECStatus serves the DNSSEC status of the managed zones on the health server
+	AdminDNSSECStatus bool `default:"false"`
+	// AdminApplyResults serves the result of the last apply on the health server
+	AdminApplyResults bool `default:"false"`
+
 	LogLevel log.Level `default:"info"`
 }
 
@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -17,25 +19,63 @@ func TestLoadConfig(t *testing.T) {
 		{
 			name: "Valid configuration",
 			envVars: map[string]string{
-				"WEBHOOK_APITOKEN":       "test-token",
-				"WEBHOOK_DOMAINFILTERS":  "example.com,test.org",
-				"WEBHOOK_DRYRUN":         "true",
-				"WEBHOOK_WEBHOOKADDRESS": "0.0.0.0",
-				"WEBHOOK_WEBHOOKPORT":    "9000",
-				"WEBHOOK_HEALTHADDRESS":  "127.0.0.1",
-				"WEBHOOK_HEALTHPORT":     "9001",
-				"WEBHOOK_LOGLEVEL":       "debug",
+				"WEBHOOK_APITOKEN":               "test-token",
+				"WEBHOOK_DOMAINFILTERS":          "example.com,test.org",
+				"WEBHOOK_DRYRUN":                 "true",
+				"WEBHOOK_WEBHOOKADDRESS":         "0.0.0.0",
+				"WEBHOOK_WEBHOOKPORT":            "9000",
+				"WEBHOOK_HEALTHADDRESS":          "127.0.0.1",
+				"WEBHOOK_HEALTHPORT":             "9001",
+				"WEBHOOK_LOGLEVEL":               "debug",
+				"WEBHOOK_REVERSEZONES":           "2.0.192.in-addr.arpa,8.b.d.0.1.0.0.2.ip6.arpa",
+				"WEBHOOK_DELEGATIONSYNC":         "true",
+				"WEBHOOK_DELEGATIONSYNCINTERVAL": "1h",
+				"WEBHOOK_ALIASMODE":              "true",
+				"WEBHOOK_ALIASRESOLVER":          "192.0.2.53:53",
+				"WEBHOOK_ALIASREFRESHINTERVAL":   "1m",
+				"WEBHOOK_ADMINZONEEXPORT":        "true",
+				"WEBHOOK_ADMINDNSSECSTATUS":      "true",
+				"WEBHOOK_ADMINAPPLYRESULTS":      "true",
+				"WEBHOOK_DRIFTDETECTION":         "true",
+				"WEBHOOK_DRIFTCHECKINTERVAL":     "30m",
+				"WEBHOOK_DRIFTAUTOHEAL":          "true",
+				"WEBHOOK_COMPAREANDSWAP":         "true",
+				"WEBHOOK_PARTIALAPPLY":           "true",
+				"WEBHOOK_BULKCHUNKSIZE":          "50",
+				"WEBHOOK_BULKCHUNKRETRIES":       "5",
+				"WEBHOOK_WRITERATELIMIT":         "0.5",
+				"WEBHOOK_WRITERATEBURST":         "2",
+				"WEBHOOK_TTLPOLICY":              `[{"name":"*.apps.example.com","type":"A","default":60,"max":300}]`,
 			},
 			expectError: false,
 			expected: Config{
-				APIToken:       "test-token",
-				DomainFilters:  []string{"example.com", "test.org"},
-				DryRun:         true,
-				WebhookAddress: "0.0.0.0",
-				WebhookPort:    9000,
-				HealthAddress:  "127.0.0.1",
-				HealthPort:     9001,
-				LogLevel:       log.DebugLevel,
+				APIToken:               "test-token",
+				DomainFilters:          []string{"example.com", "test.org"},
+				DryRun:                 true,
+				WebhookAddress:         "0.0.0.0",
+				WebhookPort:            9000,
+				HealthAddress:          "127.0.0.1",
+				HealthPort:             9001,
+				LogLevel:               log.DebugLevel,
+				ReverseZones:           []string{"2.0.192.in-addr.arpa", "8.b.d.0.1.0.0.2.ip6.arpa"},
+				DelegationSync:         true,
+				DelegationSyncInterval: time.Hour,
+				AliasMode:              true,
+				AliasResolver:          "192.0.2.53:53",
+				AliasRefreshInterval:   time.Minute,
+				AdminZoneExport:        true,
+				AdminDNSSECStatus:      true,
+				AdminApplyResults:      true,
+				DriftDetection:         true,
+				DriftCheckInterval:     30 * time.Minute,
+				DriftAutoHeal:          true,
+				CompareAndSwap:         true,
+				PartialApply:           true,
+				BulkChunkSize:          50,
+				BulkChunkRetries:       5,
+				WriteRateLimit:         0.5,
+				WriteRateBurst:         2,
+				TTLPolicy:              TTLPolicy{{Name: "*.apps.example.com", Type: "A", Default: 60, Max: 300}},
 			},
 		},
 		{
@@ -46,16 +86,30 @@ func TestLoadConfig(t *testing.T) {
 			},
 			expectError: false,
 			expected: Config{
-				APIToken:       "minimal-token",
-				DomainFilters:  []string{"minimal.com"},
-				DryRun:         false,
-				WebhookAddress: "127.0.0.1",
-				WebhookPort:    8888,
-				HealthAddress:  "0.0.0.0",
-				HealthPort:     8080,
-				LogLevel:       log.InfoLevel,
+				APIToken:               "minimal-token",
+				DomainFilters:          []string{"minimal.com"},
+				DryRun:                 false,
+				WebhookAddress:         "127.0.0.1",
+				WebhookPort:            8888,
+				HealthAddress:          "0.0.0.0",
+				HealthPort:             8080,
+				LogLevel:               log.InfoLevel,
+				DelegationSyncInterval: 10 * time.Minute,
+				AliasRefreshInterval:   5 * time.Minute,
+				DriftCheckInterval:     10 * time.Minute,
+				BulkChunkRetries:       3,
+				WriteRateBurst:         5,
 			},
 		},
+		{
+			name: "Invalid TTL policy",
+			envVars: map[string]string{
+				"WEBHOOK_APITOKEN":      "test-token",
+				"WEBHOOK_DOMAINFILTERS": "example.com",
+				"WEBHOOK_TTLPOLICY":     `{"default":60}`,
+			},
+			expectError: true,
+		},
 		{
 			name: "Missing API token",
 			envVars: map[string]string{
@@ -132,6 +186,66 @@ func TestLoadConfig(t *testing.T) {
 			if config.LogLevel != tt.expected.LogLevel {
 				t.Errorf("LogLevel = %v, want %v", config.LogLevel, tt.expected.LogLevel)
 			}
+			if !reflect.DeepEqual(config.ReverseZones, tt.expected.ReverseZones) {
+				t.Errorf("ReverseZones = %v, want %v", config.ReverseZones, tt.expected.ReverseZones)
+			}
+			if config.DelegationSync != tt.expected.DelegationSync {
+				t.Errorf("DelegationSync = %v, want %v", config.DelegationSync, tt.expected.DelegationSync)
+			}
+			if config.DelegationSyncInterval != tt.expected.DelegationSyncInterval {
+				t.Errorf("DelegationSyncInterval = %v, want %v", config.DelegationSyncInterval, tt.expected.DelegationSyncInterval)
+			}
+			if config.DNSSECResolver != tt.expected.DNSSECResolver {
+				t.Errorf("DNSSECResolver = %v, want %v", config.DNSSECResolver, tt.expected.DNSSECResolver)
+			}
+			if config.AliasMode != tt.expected.AliasMode {
+				t.Errorf("AliasMode = %v, want %v", config.AliasMode, tt.expected.AliasMode)
+			}
+			if config.AliasResolver != tt.expected.AliasResolver {
+				t.Errorf("AliasResolver = %v, want %v", config.AliasResolver, tt.expected.AliasResolver)
+			}
+			if config.AliasRefreshInterval != tt.expected.AliasRefreshInterval {
+				t.Errorf("AliasRefreshInterval = %v, want %v", config.AliasRefreshInterval, tt.expected.AliasRefreshInterval)
+			}
+			if config.AdminZoneExport != tt.expected.AdminZoneExport {
+				t.Errorf("AdminZoneExport = %v, want %v", config.AdminZoneExport, tt.expected.AdminZoneExport)
+			}
+			if config.AdminDNSSECStatus != tt.expected.AdminDNSSECStatus {
+				t.Errorf("AdminDNSSECStatus = %v, want %v", config.AdminDNSSECStatus, tt.expected.AdminDNSSECStatus)
+			}
+			if config.AdminApplyResults != tt.expected.AdminApplyResults {
+				t.Errorf("AdminApplyResults = %v, want %v", config.AdminApplyResults, tt.expected.AdminApplyResults)
+			}
+			if config.DriftDetection != tt.expected.DriftDetection {
+				t.Errorf("DriftDetection = %v, want %v", config.DriftDetection, tt.expected.DriftDetection)
+			}
+			if config.DriftCheckInterval != tt.expected.DriftCheckInterval {
+				t.Errorf("DriftCheckInterval = %v, want %v", config.DriftCheckInterval, tt.expected.DriftCheckInterval)
+			}
+			if config.DriftAutoHeal != tt.expected.DriftAutoHeal {
+				t.Errorf("DriftAutoHeal = %v, want %v", config.DriftAutoHeal, tt.expected.DriftAutoHeal)
+			}
+			if config.CompareAndSwap != tt.expected.CompareAndSwap {
+				t.Errorf("CompareAndSwap = %v, want %v", config.CompareAndSwap, tt.expected.CompareAndSwap)
+			}
+			if config.PartialApply != tt.expected.PartialApply {
+				t.Errorf("PartialApply = %v, want %v", config.PartialApply, tt.expected.PartialApply)
+			}
+			if config.BulkChunkSize != tt.expected.BulkChunkSize {
+				t.Errorf("BulkChunkSize = %v, want %v", config.BulkChunkSize, tt.expected.BulkChunkSize)
+			}
+			if config.BulkChunkRetries != tt.expected.BulkChunkRetries {
+				t.Errorf("BulkChunkRetries = %v, want %v", config.BulkChunkRetries, tt.expected.BulkChunkRetries)
+			}
+			if config.WriteRateLimit != tt.expected.WriteRateLimit {
+				t.Errorf("WriteRateLimit = %v, want %v", config.WriteRateLimit, tt.expected.WriteRateLimit)
+			}
+			if config.WriteRateBurst != tt.expected.WriteRateBurst {
+				t.Errorf("WriteRateBurst = %v, want %v", config.WriteRateBurst, tt.expected.WriteRateBurst)
+			}
+			if !reflect.DeepEqual(config.TTLPolicy, tt.expected.TTLPolicy) {
+				t.Errorf("TTLPolicy = %v, want %v", config.TTLPolicy, tt.expected.TTLPolicy)
+			}
 		})
 	}
 
@@ -217,6 +331,26 @@ func clearWebhookEnvVars() {
 		"WEBHOOK_HEALTHADDRESS",
 		"WEBHOOK_HEALTHPORT",
 		"WEBHOOK_LOGLEVEL",
+		"WEBHOOK_REVERSEZONES",
+		"WEBHOOK_DELEGATIONSYNC",
+		"WEBHOOK_DELEGATIONSYNCINTERVAL",
+		"WEBHOOK_DNSSECRESOLVER",
+		"WEBHOOK_ALIASMODE",
+		"WEBHOOK_ALIASRESOLVER",
+		"WEBHOOK_ALIASREFRESHINTERVAL",
+		"WEBHOOK_TTLPOLICY",
+		"WEBHOOK_ADMINZONEEXPORT",
+		"WEBHOOK_ADMINDNSSECSTATUS",
+		"WEBHOOK_ADMINAPPLYRESULTS",
+		"WEBHOOK_DRIFTDETECTION",
+		"WEBHOOK_DRIFTCHECKINTERVAL",
+		"WEBHOOK_DRIFTAUTOHEAL",
+		"WEBHOOK_COMPAREANDSWAP",
+		"WEBHOOK_PARTIALAPPLY",
+		"WEBHOOK_BULKCHUNKSIZE",
+		"WEBHOOK_BULKCHUNKRETRIES",
+		"WEBHOOK_WRITERATELIMIT",
+		"WEBHOOK_WRITERATEBURST",
 	}
 
 	for _, envVar := range envVars {
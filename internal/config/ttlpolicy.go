@@ -0,0 +1,68 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// TTLRule sets the TTLs of the records matching a zone, a name pattern and a
+// record type. Empty match fields match everything and zero TTLs are unset.
+type TTLRule struct {
+	Zone string `json:"zone,omitempty"`
+	// Name is a DNS name or a shell pattern like "*.apps.example.com"
+	Name string `json:"name,omitempty"`
+	Type string `json:"type,omitempty"`
+
+	// Default replaces the default TTL for the records without a TTL
+	Default int `json:"default,omitempty"`
+	// Min and Max bound the TTL, the minimum TTL of the zone still applies
+	Min int `json:"min,omitempty"`
+	Max int `json:"max,omitempty"`
+}
+
+// TTLPolicy is an ordered list of TTL rules, decoded from a JSON array
+type TTLPolicy []TTLRule
+
+// Decode implements envconfig.Decoder
+func (policy *TTLPolicy) Decode(value string) error {
+	*policy = nil
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	var rules []TTLRule
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		return fmt.Errorf("invalid TTL policy: %w", err)
+	}
+	for i, rule := range rules {
+		if _, err := path.Match(rule.Name, ""); err != nil {
+			return fmt.Errorf("invalid TTL policy rule %d: name pattern %q: %w", i, rule.Name, err)
+		}
+		if rule.Default < 0 || rule.Min < 0 || rule.Max < 0 {
+			return fmt.Errorf("invalid TTL policy rule %d: TTLs must not be negative", i)
+		}
+		if rule.Min != 0 && rule.Max != 0 && rule.Min > rule.Max {
+			return fmt.Errorf("invalid TTL policy rule %d: min %d is greater than max %d", i, rule.Min, rule.Max)
+		}
+	}
+	*policy = rules
+	return nil
+}
+
+// String describes the rule in log messages
+func (rule TTLRule) String() string {
+	var fields []string
+	for _, field := range []struct{ key, value string }{
+		{"zone", rule.Zone}, {"name", rule.Name}, {"type", rule.Type},
+	} {
+		if field.value != "" {
+			fields = append(fields, field.key+"="+field.value)
+		}
+	}
+	if len(fields) == 0 {
+		return "*"
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTTLPolicyDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expectError bool
+		expected    TTLPolicy
+	}{
+		{name: "Empty", value: " ", expected: nil},
+		{
+			name:  "Rules",
+			value: `[{"zone":"example.com","type":"MX","min":86400},{"name":"*.apps.example.com","default":60}]`,
+			expected: TTLPolicy{
+				{Zone: "example.com", Type: "MX", Min: 86400},
+				{Name: "*.apps.example.com", Default: 60},
+			},
+		},
+		{name: "Not a list", value: `{"default":60}`, expectError: true},
+		{name: "Invalid pattern", value: `[{"name":"[.example.com"}]`, expectError: true},
+		{name: "Negative TTL", value: `[{"default":-1}]`, expectError: true},
+		{name: "Min above max", value: `[{"min":600,"max":60}]`, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var policy TTLPolicy
+			err := policy.Decode(tt.value)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Decode() expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(policy, tt.expected) {
+				t.Errorf("Decode() = %v, want %v", policy, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTTLRuleString(t *testing.T) {
+	if got := (TTLRule{}).String(); got != "*" {
+		t.Errorf("String() = %q, want %q", got, "*")
+	}
+	if got := (TTLRule{Zone: "example.com", Type: "A"}).String(); got != "zone=example.com type=A" {
+		t.Errorf("String() = %q, want %q", got, "zone=example.com type=A")
+	}
+}
@@ -6,24 +6,34 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type HealthServer struct {
 	httpServer *http.Server
+	router     *mux.Router
 }
 
 func NewHealthServer() *HealthServer {
 	mux := mux.NewRouter()
 	mux.HandleFunc("/healthz", healthzHandler).Methods("GET")
 	mux.HandleFunc("/readyz", readyzHandler).Methods("GET")
+	mux.Handle("/metrics", promhttp.Handler()).Methods("GET")
 
 	return &HealthServer{
 		httpServer: &http.Server{
 			Handler: mux,
 		},
+		router: mux,
 	}
 }
 
+// Handle serves every path below prefix with handler, to expose admin
+// endpoints next to the health checks
+func (server *HealthServer) Handle(prefix string, handler http.Handler) {
+	server.router.PathPrefix(prefix).Handler(handler)
+}
+
 func (server *HealthServer) Run(config config.Config) error {
 	server.httpServer.Addr = config.GetHealthListeningAddress()
 	return server.httpServer.ListenAndServe()
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -181,3 +182,38 @@ func TestHealthServerShutdown(t *testing.T) {
 		t.Errorf("Shutdown returned error: %v", err)
 	}
 }
+
+func TestHealthServerHandle(t *testing.T) {
+	server := NewHealthServer()
+	server.Handle("/admin/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+
+	w := httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/admin/dnssec", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "/admin/dnssec" {
+		t.Errorf("admin handler returned %d %q, want 200 \"/admin/dnssec\"", w.Code, w.Body.String())
+	}
+
+	// The health checks are still served
+	w = httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("healthz returned %d, want 200", w.Code)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	server := NewHealthServer()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	server.router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("metrics handler returned wrong status code: got %v want %v", w.Code, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), "go_goroutines") {
+		t.Errorf("metrics handler did not return the Prometheus metrics: %s", w.Body.String())
+	}
+}
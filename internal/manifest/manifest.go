@@ -0,0 +1,172 @@
+// Package manifest reads and writes external-dns DNSEndpoint resources
+package manifest
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/external-dns/apis/v1alpha1"
+	"sigs.k8s.io/external-dns/endpoint"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	kindDNSEndpoint     = "DNSEndpoint"
+	kindDNSEndpointList = "DNSEndpointList"
+	kindList            = "List"
+)
+
+// object is the part of a resource identifying its kind, along with the items
+// of lists
+type object struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Items      []json.RawMessage `json:"items"`
+}
+
+// ReadDNSEndpoints returns the endpoints of the DNSEndpoint resources of a
+// stream of YAML documents or JSON objects, lists included. Resources of other
+// kinds are skipped. Documents may also be bare lists of endpoints, like the
+// records served by the webhook.
+func ReadDNSEndpoints(r io.Reader) ([]*endpoint.Endpoint, error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	var endpoints []*endpoint.Endpoint
+	for document := 1; ; document++ {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return endpoints, nil
+			}
+			return nil, fmt.Errorf("document %d: %w", document, err)
+		}
+		found, err := resourceEndpoints(raw)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", document, err)
+		}
+		endpoints = append(endpoints, found...)
+	}
+}
+
+// resourceEndpoints returns the endpoints of a DNSEndpoint resource or list
+func resourceEndpoints(raw json.RawMessage) ([]*endpoint.Endpoint, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '[' {
+		var endpoints []*endpoint.Endpoint
+		if err := json.Unmarshal(raw, &endpoints); err != nil {
+			return nil, err
+		}
+		return endpoints, nil
+	}
+	var obj object
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+
+	switch obj.Kind {
+	case kindDNSEndpoint:
+		var resource v1alpha1.DNSEndpoint
+		if err := json.Unmarshal(raw, &resource); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", kindDNSEndpoint, resource.Name, err)
+		}
+		return resource.Spec.Endpoints, nil
+	case kindDNSEndpointList, kindList:
+		var endpoints []*endpoint.Endpoint
+		for _, item := range obj.Items {
+			found, err := resourceEndpoints(item)
+			if err != nil {
+				return nil, err
+			}
+			endpoints = append(endpoints, found...)
+		}
+		return endpoints, nil
+	default:
+		log.Debugf("skipping resource of kind %q", obj.Kind)
+		return nil, nil
+	}
+}
+
+// Resource is a DNSEndpoint resource to write
+type Resource struct {
+	Name      string
+	Namespace string
+	Endpoints []*endpoint.Endpoint
+}
+
+// dnsEndpoint is a DNSEndpoint resource without the fields of v1alpha1.DNSEndpoint
+// that always serialize, like the status and the creation timestamp
+type dnsEndpoint struct {
+	APIVersion string                   `json:"apiVersion"`
+	Kind       string                   `json:"kind"`
+	Metadata   metadata                 `json:"metadata"`
+	Spec       v1alpha1.DNSEndpointSpec `json:"spec"`
+}
+
+type metadata struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// WriteDNSEndpoints writes the resources as YAML documents, sorted by namespace
+// and name. Endpoints are sorted by name, type and set identifier and their
+// targets are sorted, so the same records always produce the same output.
+// Names lose their trailing dot and labels, which the TXT registry maintains,
+// are dropped.
+func WriteDNSEndpoints(w io.Writer, resources []Resource) error {
+	resources = slices.Clone(resources)
+	slices.SortFunc(resources, func(a, b Resource) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Name, b.Name))
+	})
+
+	for i, resource := range resources {
+		endpoints := make([]*endpoint.Endpoint, len(resource.Endpoints))
+		for j, ep := range resource.Endpoints {
+			ep = ep.DeepCopy()
+			ep.DNSName = strings.TrimSuffix(ep.DNSName, ".")
+			ep.Labels = nil
+			slices.Sort(ep.Targets)
+			endpoints[j] = ep
+		}
+		slices.SortFunc(endpoints, func(a, b *endpoint.Endpoint) int {
+			return cmp.Or(
+				cmp.Compare(a.DNSName, b.DNSName),
+				cmp.Compare(a.RecordType, b.RecordType),
+				cmp.Compare(a.SetIdentifier, b.SetIdentifier),
+			)
+		})
+
+		data, err := sigsyaml.Marshal(dnsEndpoint{
+			APIVersion: v1alpha1.GroupVersion.String(),
+			Kind:       kindDNSEndpoint,
+			Metadata:   metadata{Name: resource.Name, Namespace: resource.Namespace},
+			Spec:       v1alpha1.DNSEndpointSpec{Endpoints: endpoints},
+		})
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResourceName returns a resource name for a DNS name, like example-com
+func ResourceName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.Trim(name, ".")), ".", "-")
+}
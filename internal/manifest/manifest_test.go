@@ -0,0 +1,159 @@
+package manifest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestReadDNSEndpoints(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expectError bool
+		expected    []*endpoint.Endpoint
+	}{
+		{
+			name: "YAML documents",
+			input: `apiVersion: externaldns.k8s.io/v1alpha1
+kind: DNSEndpoint
+metadata:
+  name: www
+spec:
+  endpoints:
+  - dnsName: www.example.com
+    recordType: A
+    recordTTL: 300
+    targets: [192.0.2.1, 192.0.2.2]
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unrelated
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: externaldns.k8s.io/v1alpha1
+  kind: DNSEndpoint
+  metadata:
+    name: mail
+  spec:
+    endpoints:
+    - dnsName: example.com
+      recordType: MX
+      targets: ["10 mail.example.com"]
+`,
+			expected: []*endpoint.Endpoint{
+				{DNSName: "www.example.com", RecordType: "A", RecordTTL: 300, Targets: endpoint.Targets{"192.0.2.1", "192.0.2.2"}},
+				{DNSName: "example.com", RecordType: "MX", Targets: endpoint.Targets{"10 mail.example.com"}},
+			},
+		},
+		{
+			name:  "JSON",
+			input: `{"apiVersion": "externaldns.k8s.io/v1alpha1", "kind": "DNSEndpoint", "spec": {"endpoints": [{"dnsName": "www.example.com", "recordType": "CNAME", "targets": ["lb.example.net"]}]}}`,
+			expected: []*endpoint.Endpoint{
+				{DNSName: "www.example.com", RecordType: "CNAME", Targets: endpoint.Targets{"lb.example.net"}},
+			},
+		},
+		{
+			name:  "Endpoint list",
+			input: "- dnsName: www.example.com\n  recordType: A\n  targets: [192.0.2.1]\n",
+			expected: []*endpoint.Endpoint{
+				{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+			},
+		},
+		{name: "Empty", input: ""},
+		{name: "Invalid YAML", input: "kind: [DNSEndpoint", expectError: true},
+		{name: "Invalid endpoints", input: "kind: DNSEndpoint\nspec:\n  endpoints: yes\n", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoints, err := ReadDNSEndpoints(strings.NewReader(tt.input))
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("ReadDNSEndpoints() expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadDNSEndpoints() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(endpoints, tt.expected) {
+				t.Errorf("ReadDNSEndpoints() = %v, want %v", endpoints, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteDNSEndpoints(t *testing.T) {
+	resources := []Resource{
+		{Name: "example-com", Namespace: "shop", Endpoints: []*endpoint.Endpoint{
+			{DNSName: "www.example.com.", RecordType: "A", RecordTTL: 300, Targets: endpoint.Targets{"192.0.2.2", "192.0.2.1"},
+				Labels: endpoint.Labels{endpoint.OwnerLabelKey: "cluster"}},
+			{DNSName: "api.example.com.", RecordType: "CNAME", RecordTTL: 3600, Targets: endpoint.Targets{"lb.example.net"}},
+		}},
+		{Name: "example-com", Endpoints: []*endpoint.Endpoint{
+			{DNSName: "example.com.", RecordType: "MX", RecordTTL: 3600, Targets: endpoint.Targets{"10 mail.example.com"}},
+		}},
+	}
+
+	var out strings.Builder
+	if err := WriteDNSEndpoints(&out, resources); err != nil {
+		t.Fatalf("WriteDNSEndpoints() error = %v", err)
+	}
+	expected := `apiVersion: externaldns.k8s.io/v1alpha1
+kind: DNSEndpoint
+metadata:
+  name: example-com
+spec:
+  endpoints:
+  - dnsName: example.com
+    recordTTL: 3600
+    recordType: MX
+    targets:
+    - 10 mail.example.com
+---
+apiVersion: externaldns.k8s.io/v1alpha1
+kind: DNSEndpoint
+metadata:
+  name: example-com
+  namespace: shop
+spec:
+  endpoints:
+  - dnsName: api.example.com
+    recordTTL: 3600
+    recordType: CNAME
+    targets:
+    - lb.example.net
+  - dnsName: www.example.com
+    recordTTL: 300
+    recordType: A
+    targets:
+    - 192.0.2.1
+    - 192.0.2.2
+`
+	if out.String() != expected {
+		t.Errorf("WriteDNSEndpoints() =\n%s\nwant\n%s", out.String(), expected)
+	}
+	if resources[0].Endpoints[0].Labels == nil || resources[0].Endpoints[0].Targets[0] != "192.0.2.2" {
+		t.Error("WriteDNSEndpoints() modified the endpoints")
+	}
+
+	endpoints, err := ReadDNSEndpoints(strings.NewReader(out.String()))
+	if err != nil {
+		t.Fatalf("ReadDNSEndpoints() error = %v", err)
+	}
+	if len(endpoints) != 3 {
+		t.Errorf("ReadDNSEndpoints() of the written resources = %v, want 3 endpoints", endpoints)
+	}
+}
+
+func TestResourceName(t *testing.T) {
+	if name := ResourceName("Sub.Example.com."); name != "sub-example-com" {
+		t.Errorf("ResourceName() = %q, want sub-example-com", name)
+	}
+}
@@ -0,0 +1,45 @@
+// Package metrics holds the Prometheus metrics of the webhook, served on
+// /metrics by the health server
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "desec_webhook"
+
+var (
+	// DriftRRsets is the number of RRsets of a zone differing from the last
+	// state applied, by kind of drift, as of the last drift check
+	DriftRRsets = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "drift",
+		Name:      "rrsets",
+		Help:      "RRsets differing from the last state applied by the webhook, by zone and kind of drift.",
+	}, []string{"zone", "kind"})
+
+	// DriftChecks counts the drift checks of a zone by result: ok, drift or error
+	DriftChecks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "drift",
+		Name:      "checks_total",
+		Help:      "Drift checks by zone and result.",
+	}, []string{"zone", "result"})
+
+	// DriftHealed counts the drifted RRsets restored to their last applied state
+	DriftHealed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "drift",
+		Name:      "healed_rrsets_total",
+		Help:      "Drifted RRsets restored to the last state applied by the webhook, by zone.",
+	}, []string{"zone"})
+
+	// Updates counts the RRset updates of external-dns applied outside of dry
+	// run: skipped when unchanged, or updated
+	Updates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rrset_updates_total",
+		Help:      "RRset updates by zone and outcome: skipped when unchanged, or updated.",
+	}, []string{"zone", "mode"})
+)
@@ -0,0 +1,362 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/nrdcg/desec"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const (
+	aliasLookupTimeout = 10 * time.Second
+)
+
+// Resolver looks up the addresses of a hostname, *net.Resolver implements it
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// NewResolver returns a resolver querying the DNS server at address (host:port),
+// or the system resolver when address is empty
+func NewResolver(address string) Resolver {
+	if address == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+}
+
+// alias is an apex CNAME published as A and AAAA records
+type alias struct {
+	domain string
+	target string
+	ttl    int
+	addrs  []netip.Addr
+}
+
+// isApexCNAME reports whether an endpoint is a CNAME at the apex of its zone,
+// which deSEC can't hold
+func isApexCNAME(ep *endpoint.Endpoint, domain string) bool {
+	return ep.RecordType == endpoint.RecordTypeCNAME && domain != "" && normalizeName(ep.DNSName) == domain
+}
+
+// resolveAlias looks up the addresses of an alias target, sorted with IPv4 first
+func (d *DesecClient) resolveAlias(target string) ([]netip.Addr, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, aliasLookupTimeout)
+	defer cancel()
+
+	found, err := d.resolver.LookupNetIP(ctx, "ip", normalizeName(target))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve alias target %s: %w", target, err)
+	}
+	addrs := make([]netip.Addr, 0, len(found))
+	for _, addr := range found {
+		addr = addr.Unmap()
+		if !slices.Contains(addrs, addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("alias target %s has no addresses", target)
+	}
+	slices.SortFunc(addrs, func(a, b netip.Addr) int { return a.Compare(b) })
+	return addrs, nil
+}
+
+// flattenAlias resolves the target of an apex CNAME and returns the A and AAAA
+// endpoints to publish instead. The alias is remembered to be refreshed later;
+// when the target can't be resolved the last known addresses are used.
+func (d *DesecClient) flattenAlias(ep *endpoint.Endpoint, domain string) ([]*endpoint.Endpoint, error) {
+	if len(ep.Targets) != 1 {
+		return nil, fmt.Errorf("apex CNAME %s must have exactly one target", ep.DNSName)
+	}
+	name := normalizeName(ep.DNSName)
+	target := normalizeName(ep.Targets[0])
+
+	d.aliasMu.Lock()
+	previous, tracked := d.aliases[name]
+	d.aliasMu.Unlock()
+
+	addrs, err := d.resolveAlias(target)
+	if err != nil {
+		if !tracked || previous.target != target {
+			return nil, err
+		}
+		log.Warnf("%v, keeping the last known addresses %v for %s", err, previous.addrs, name)
+		addrs = previous.addrs
+	}
+
+	ttl := d.storedTTLLimits(domain, ep.DNSName, ep.RecordType).clamp(ep.RecordTTL)
+	d.aliasMu.Lock()
+	d.aliases[name] = alias{domain: domain, target: target, ttl: ttl, addrs: addrs}
+	d.aliasMu.Unlock()
+
+	// Outside of ALIAS mode, the first alias opting in starts the refresher
+	if !d.aliasMode {
+		d.startAliasRefresher(fmt.Sprintf("%s opted in with desec/alias", name))
+	}
+
+	log.Debugf("flattened apex CNAME %s -> %s into %v", name, target, addrs)
+	return aliasEndpoints(ep, addrs), nil
+}
+
+// previewAlias returns a flatten function for a read-only plan. Apex CNAMEs
+// are flattened into the addresses currently published in the records, and
+// only resolved when none is published yet. Nothing is remembered.
+func (d *DesecClient) previewAlias(records []*endpoint.Endpoint) func(ep *endpoint.Endpoint, domain string) ([]*endpoint.Endpoint, error) {
+	return func(ep *endpoint.Endpoint, domain string) ([]*endpoint.Endpoint, error) {
+		if len(ep.Targets) != 1 {
+			return nil, fmt.Errorf("apex CNAME %s must have exactly one target", ep.DNSName)
+		}
+		var addrs []netip.Addr
+		for _, record := range records {
+			if normalizeName(record.DNSName) != normalizeName(ep.DNSName) || record.SetIdentifier != ep.SetIdentifier ||
+				(record.RecordType != endpoint.RecordTypeA && record.RecordType != endpoint.RecordTypeAAAA) {
+				continue
+			}
+			for _, target := range record.Targets {
+				if addr, err := netip.ParseAddr(target); err == nil {
+					addrs = append(addrs, addr)
+				}
+			}
+		}
+		if len(addrs) == 0 {
+			resolved, err := d.resolveAlias(ep.Targets[0])
+			if err != nil {
+				return nil, err
+			}
+			addrs = resolved
+		}
+		slices.SortFunc(addrs, func(a, b netip.Addr) int { return a.Compare(b) })
+		return aliasEndpoints(ep, addrs), nil
+	}
+}
+
+// aliasEndpoints returns copies of an alias endpoint holding its addresses,
+// one A and one AAAA endpoint when both families are present
+func aliasEndpoints(ep *endpoint.Endpoint, addrs []netip.Addr) []*endpoint.Endpoint {
+	var endpoints []*endpoint.Endpoint
+	for _, family := range addressFamilies(addrs) {
+		if len(family.targets) == 0 {
+			continue
+		}
+		flattened := ep.DeepCopy()
+		flattened.RecordType = family.recordType
+		flattened.Targets = family.targets
+		endpoints = append(endpoints, flattened)
+	}
+	return endpoints
+}
+
+// addressFamily holds the addresses of an alias for one record type
+type addressFamily struct {
+	recordType string
+	targets    endpoint.Targets
+}
+
+// addressFamilies splits addresses into their A and AAAA targets
+func addressFamilies(addrs []netip.Addr) []addressFamily {
+	families := []addressFamily{{recordType: endpoint.RecordTypeA}, {recordType: endpoint.RecordTypeAAAA}}
+	for _, addr := range addrs {
+		if addr.Is4() {
+			families[0].targets = append(families[0].targets, addr.String())
+		} else {
+			families[1].targets = append(families[1].targets, addr.String())
+		}
+	}
+	return families
+}
+
+// flattenAliasChanges replaces apex CNAMEs in the changes by A and AAAA records.
+// Deleting an alias deletes the address families it was last published with,
+// or both when it isn't known.
+func (d *DesecClient) flattenAliasChanges(changes plan.Changes) (plan.Changes, error) {
+	flatten := func(eps []*endpoint.Endpoint, remove bool) ([]*endpoint.Endpoint, error) {
+		var result []*endpoint.Endpoint
+		for _, ep := range eps {
+			if ep == nil {
+				continue
+			}
+			domain := findMatchingDomain(ep.DNSName, d.domainFilters)
+			if !isApexCNAME(ep, domain) {
+				result = append(result, ep)
+				continue
+			}
+			if !remove {
+				flattened, err := d.flattenAlias(ep, domain)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, flattened...)
+				continue
+			}
+
+			name := normalizeName(ep.DNSName)
+			d.aliasMu.Lock()
+			previous, tracked := d.aliases[name]
+			d.aliasMu.Unlock()
+			for _, family := range addressFamilies(previous.addrs) {
+				if tracked && len(family.targets) == 0 {
+					continue
+				}
+				removed := ep.DeepCopy()
+				removed.RecordType = family.recordType
+				removed.Targets = family.targets
+				result = append(result, removed)
+			}
+		}
+		return result, nil
+	}
+
+	var flattened plan.Changes
+	var err error
+	if flattened.Create, err = flatten(changes.Create, false); err != nil {
+		return plan.Changes{}, err
+	}
+	if flattened.UpdateOld, err = flatten(changes.UpdateOld, true); err != nil {
+		return plan.Changes{}, err
+	}
+	if flattened.UpdateNew, err = flatten(changes.UpdateNew, false); err != nil {
+		return plan.Changes{}, err
+	}
+	if flattened.Delete, err = flatten(changes.Delete, true); err != nil {
+		return plan.Changes{}, err
+	}
+
+	// Deleted aliases are no longer refreshed
+	for _, ep := range changes.Delete {
+		if ep != nil && isApexCNAME(ep, findMatchingDomain(ep.DNSName, d.domainFilters)) {
+			d.aliasMu.Lock()
+			delete(d.aliases, normalizeName(ep.DNSName))
+			d.aliasMu.Unlock()
+		}
+	}
+	return flattened, nil
+}
+
+// RefreshAliases resolves the target of every known alias again and updates
+// the A and AAAA records whose addresses changed
+func (d *DesecClient) RefreshAliases() error {
+	d.aliasMu.Lock()
+	names := slices.Sorted(maps.Keys(d.aliases))
+	d.aliasMu.Unlock()
+
+	var errs []error
+	for _, name := range names {
+		d.aliasMu.Lock()
+		current, ok := d.aliases[name]
+		d.aliasMu.Unlock()
+		if !ok {
+			continue
+		}
+
+		addrs, err := d.resolveAlias(current.target)
+		if err != nil {
+			log.Warnf("failed to refresh alias %s: %v", name, err)
+			errs = append(errs, err)
+			continue
+		}
+		if slices.Equal(addrs, current.addrs) {
+			continue
+		}
+
+		// Families that disappeared are deleted by sending them without records
+		previous := addressFamilies(current.addrs)
+		var rrsets []desec.RRSet
+		for i, family := range addressFamilies(addrs) {
+			if len(family.targets) == 0 && len(previous[i].targets) == 0 {
+				continue
+			}
+			rrsets = append(rrsets, desec.RRSet{SubName: "", Type: family.recordType, TTL: current.ttl, Records: append([]string{}, family.targets...)})
+		}
+
+		if d.dryRun {
+			log.Infof("dryrun: would refresh alias %s -> %s: %v -> %v", name, current.target, current.addrs, addrs)
+		} else {
+			log.Infof("refreshing alias %s -> %s: %v -> %v", name, current.target, current.addrs, addrs)
+			if err := d.writeAlias(current.domain, rrsets); err != nil {
+				log.Errorf("failed to refresh alias %s: %v", name, err)
+				errs = append(errs, err)
+				continue
+			}
+		}
+
+		d.aliasMu.Lock()
+		if tracked, ok := d.aliases[name]; ok && tracked.target == current.target {
+			tracked.addrs = addrs
+			d.aliases[name] = tracked
+		}
+		d.aliasMu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// writeAlias writes the refreshed address RRsets of an alias and records them
+// as the desired state of the zone
+func (d *DesecClient) writeAlias(domain string, rrsets []desec.RRSet) error {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	err := d.writeUnchunked(domain, "refresh alias", rrsets, nil, func(chunk []desec.RRSet) error {
+		return d.bulkUpdate(domain, chunk)
+	})
+	if err != nil {
+		return err
+	}
+	d.recordDesired(domain, rrsets)
+	return nil
+}
+
+// StartAliasRefresher refreshes the aliases every interval until the context is
+// done. In ALIAS mode the refresher starts right away, otherwise only once a
+// record opts in with desec/alias.
+func (d *DesecClient) StartAliasRefresher(ctx context.Context, interval time.Duration) {
+	d.aliasMu.Lock()
+	d.aliasRefreshCtx, d.aliasRefreshInterval = ctx, interval
+	d.aliasMu.Unlock()
+	if d.aliasMode {
+		d.startAliasRefresher("ALIAS mode is enabled")
+	}
+}
+
+// startAliasRefresher starts the alias refresher once, if StartAliasRefresher
+// was called
+func (d *DesecClient) startAliasRefresher(reason string) {
+	d.aliasMu.Lock()
+	ctx, interval := d.aliasRefreshCtx, d.aliasRefreshInterval
+	d.aliasMu.Unlock()
+	if ctx == nil || interval <= 0 {
+		return
+	}
+	d.aliasRefreshOnce.Do(func() {
+		log.Infof("refreshing apex CNAME aliases every %s, %s", interval, reason)
+		go d.RunAliasRefresher(ctx, interval)
+	})
+}
+
+// RunAliasRefresher refreshes the aliases every interval until the context is done
+func (d *DesecClient) RunAliasRefresher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = d.RefreshAliases()
+		}
+	}
+}
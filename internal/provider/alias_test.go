@@ -0,0 +1,201 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"golang.org/x/net/dns/dnsmessage"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// staticResolver resolves hostnames from a fixed table
+type staticResolver map[string][]netip.Addr
+
+func (r staticResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+func newAliasTestClient(t *testing.T, resolver staticResolver) (*fakeDesec, *DesecClient) {
+	t.Helper()
+	fake, srv := newFakeDesec(t, "example.com")
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600, AliasMode: true})
+	client.resolver = resolver
+	return fake, client
+}
+
+func TestAdjustEndpointsFlattensApexCNAME(t *testing.T) {
+	_, client := newAliasTestClient(t, staticResolver{
+		"lb.example.net": {netip.MustParseAddr("2001:db8::1"), netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("::ffff:192.0.2.1")},
+	})
+
+	labels := endpoint.Labels{"owner": "default"}
+	adjusted, err := client.AdjustEndpoints([]*endpoint.Endpoint{
+		{DNSName: "example.com", RecordType: "CNAME", Targets: endpoint.Targets{"LB.example.net"}, RecordTTL: 3600, Labels: labels},
+		{DNSName: "www.example.com", RecordType: "CNAME", Targets: endpoint.Targets{"lb.example.net"}, RecordTTL: 3600},
+	})
+	if err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+
+	expected := []*endpoint.Endpoint{
+		{DNSName: "example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 3600, Labels: labels},
+		{DNSName: "example.com", RecordType: "AAAA", Targets: endpoint.Targets{"2001:db8::1"}, RecordTTL: 3600, Labels: labels},
+		{DNSName: "www.example.com", RecordType: "CNAME", Targets: endpoint.Targets{"lb.example.net."}, RecordTTL: 3600},
+	}
+	if !reflect.DeepEqual(adjusted, expected) {
+		t.Errorf("AdjustEndpoints() = %v, want %v", adjusted, expected)
+	}
+}
+
+func TestAdjustEndpointsKeepsApexCNAMEWithoutAliasMode(t *testing.T) {
+	client, err := CreateDesecClient(config.Config{APIToken: "test-token", DomainFilters: []string{"example.com"}, DefaultTTL: 3600})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	client.resolver = staticResolver{}
+
+	adjusted, err := client.AdjustEndpoints([]*endpoint.Endpoint{
+		{DNSName: "example.com", RecordType: "CNAME", Targets: endpoint.Targets{"lb.example.net"}, RecordTTL: 3600},
+	})
+	if err != nil || len(adjusted) != 1 || adjusted[0].RecordType != "CNAME" {
+		t.Errorf("AdjustEndpoints() = %v, %v, want the CNAME unchanged", adjusted, err)
+	}
+}
+
+func TestAdjustEndpointsUnresolvableAlias(t *testing.T) {
+	resolver := staticResolver{"lb.example.net": {netip.MustParseAddr("192.0.2.1")}}
+	_, client := newAliasTestClient(t, resolver)
+	apex := &endpoint.Endpoint{DNSName: "example.com", RecordType: "CNAME", Targets: endpoint.Targets{"lb.example.net"}, RecordTTL: 3600}
+
+	// An unresolvable alias is skipped and its records are left alone
+	adjusted, err := client.AdjustEndpoints([]*endpoint.Endpoint{
+		{DNSName: "example.com", RecordType: "CNAME", Targets: endpoint.Targets{"missing.example.net"}},
+		{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+	})
+	if err != nil || len(adjusted) != 1 || adjusted[0].DNSName != "www.example.com" {
+		t.Errorf("AdjustEndpoints() = %v, %v, want only www.example.com", adjusted, err)
+	}
+	if !client.isUnmanaged(&endpoint.Endpoint{DNSName: "example.com", RecordType: "A"}) {
+		t.Errorf("the apex A records of an unresolvable alias are not left alone")
+	}
+
+	if _, err := client.AdjustEndpoints([]*endpoint.Endpoint{apex}); err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+	// The last known addresses are kept while the target can't be resolved
+	delete(resolver, "lb.example.net")
+	adjusted, err = client.AdjustEndpoints([]*endpoint.Endpoint{apex})
+	if err != nil || len(adjusted) != 1 || !reflect.DeepEqual(adjusted[0].Targets, endpoint.Targets{"192.0.2.1"}) {
+		t.Errorf("AdjustEndpoints() = %v, %v, want the last known address", adjusted, err)
+	}
+}
+
+func TestApplyChangesAndRefreshAlias(t *testing.T) {
+	resolver := staticResolver{"lb.example.net": {netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("2001:db8::1")}}
+	fake, client := newAliasTestClient(t, resolver)
+
+	apex := &endpoint.Endpoint{DNSName: "example.com", RecordType: "CNAME", Targets: endpoint.Targets{"lb.example.net"}, RecordTTL: 7200}
+	if err := client.ApplyChanges(plan.Changes{Create: []*endpoint.Endpoint{apex}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if rrset, ok := fake.get("example.com", "", "A"); !ok || !reflect.DeepEqual(rrset.Records, []string{"192.0.2.1"}) || rrset.TTL != 7200 {
+		t.Errorf("apex A = %v, want [192.0.2.1] with TTL 7200", rrset)
+	}
+	if rrset, ok := fake.get("example.com", "", "AAAA"); !ok || !reflect.DeepEqual(rrset.Records, []string{"2001:db8::1"}) {
+		t.Errorf("apex AAAA = %v, want [2001:db8::1]", rrset)
+	}
+	if _, ok := fake.get("example.com", "", "CNAME"); ok {
+		t.Errorf("apex CNAME was created")
+	}
+
+	// The target moved and lost its IPv6 address
+	resolver["lb.example.net"] = []netip.Addr{netip.MustParseAddr("192.0.2.2")}
+	if err := client.RefreshAliases(); err != nil {
+		t.Fatalf("RefreshAliases() error = %v", err)
+	}
+	if rrset, _ := fake.get("example.com", "", "A"); !reflect.DeepEqual(rrset.Records, []string{"192.0.2.2"}) || rrset.TTL != 7200 {
+		t.Errorf("refreshed apex A = %v, want [192.0.2.2] with TTL 7200", rrset)
+	}
+	if _, ok := fake.get("example.com", "", "AAAA"); ok {
+		t.Errorf("apex AAAA was not deleted")
+	}
+
+	// Nothing is written when the addresses didn't change
+	requests := len(fake.requests)
+	if err := client.RefreshAliases(); err != nil || len(fake.requests) != requests {
+		t.Errorf("RefreshAliases() = %v with %d requests, want no request", err, len(fake.requests)-requests)
+	}
+
+	if err := client.ApplyChanges(plan.Changes{Delete: []*endpoint.Endpoint{apex}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if _, ok := fake.get("example.com", "", "A"); ok {
+		t.Errorf("apex A was not deleted")
+	}
+	if len(client.aliases) != 0 {
+		t.Errorf("deleted alias is still refreshed: %v", client.aliases)
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	go serveTestDNS(conn, map[dnsmessage.Type]dnsmessage.ResourceBody{
+		dnsmessage.TypeA:    &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+		dnsmessage.TypeAAAA: &dnsmessage.AAAAResource{AAAA: netip.MustParseAddr("2001:db8::1").As16()},
+	})
+
+	addrs, err := NewResolver(conn.LocalAddr().String()).LookupNetIP(context.Background(), "ip", "lb.example.net.")
+	if err != nil {
+		t.Fatalf("LookupNetIP() error = %v", err)
+	}
+	if len(addrs) != 2 {
+		t.Errorf("LookupNetIP() = %v, want an IPv4 and an IPv6 address", addrs)
+	}
+}
+
+// serveTestDNS answers every query with the resource of the queried type
+func serveTestDNS(conn net.PacketConn, answers map[dnsmessage.Type]dnsmessage.ResourceBody) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var query dnsmessage.Message
+		if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+			continue
+		}
+		question := query.Questions[0]
+		response := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true, RecursionAvailable: true},
+			Questions: query.Questions,
+		}
+		if body, ok := answers[question.Type]; ok {
+			response.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: question.Type, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   body,
+			}}
+		}
+		packed, err := response.Pack()
+		if err != nil {
+			continue
+		}
+		if _, err := conn.WriteTo(packed, addr); errors.Is(err, net.ErrClosed) {
+			return
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package provider
+
+import (
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// canonicalTargets canonicalizes every target of a record type and drops duplicates.
+// It is applied identically to the records read from deSEC and to the endpoints
+// adjusted for external-dns, so both sides of the plan compare equal.
+func canonicalTargets(recordType string, targets []string) endpoint.Targets {
+	result := make(endpoint.Targets, 0, len(targets))
+	seen := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		rec := canonicalTarget(recordType, target)
+		if seen[rec] {
+			continue
+		}
+		seen[rec] = true
+		result = append(result, rec)
+	}
+	return result
+}
+
+// canonicalTarget returns the canonical form of a single target, as exchanged
+// with external-dns. TXT and SPF contents are unquoted, see recordText for the
+// form sent to deSEC. Targets that can't be parsed, or of unsupported types,
+// are returned unchanged, validation reports them.
+func canonicalTarget(recordType, target string) string {
+	handler, ok := recordHandlers[recordType]
+	if !ok {
+		return target
+	}
+	canonical, err := handler.parse(target)
+	if err != nil {
+		return target
+	}
+	return canonical
+}
+
+// recordText renders a canonical target in the format deSEC stores records in
+func recordText(recordType, target string) string {
+	if handler, ok := recordHandlers[recordType]; ok && handler.render != nil {
+		return handler.render(target)
+	}
+	return target
+}
+
+// canonicalHostname lowercases a hostname and makes it fully qualified
+func canonicalHostname(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name = name + "."
+	}
+	return name
+}
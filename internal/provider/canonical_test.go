@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestCanonicalTarget(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordType string
+		target     string
+		expected   string
+	}{
+		{name: "IPv4", recordType: "A", target: "192.0.2.1", expected: "192.0.2.1"},
+		{name: "IPv6 expanded", recordType: "AAAA", target: "2001:0DB8:0000:0000:0000:0000:0000:0001", expected: "2001:db8::1"},
+		{name: "IPv6 mapped IPv4", recordType: "AAAA", target: "::FFFF:192.0.2.1", expected: "::ffff:192.0.2.1"},
+		{name: "CNAME case and dot", recordType: "CNAME", target: "Alias.Example.COM", expected: "alias.example.com."},
+		{name: "NS", recordType: "NS", target: "ns1.desec.io", expected: "ns1.desec.io."},
+		{name: "PTR", recordType: "PTR", target: "Host.example.com.", expected: "host.example.com."},
+		{name: "MX", recordType: "MX", target: "010  Mail.example.com", expected: "10 mail.example.com."},
+		{name: "Null MX", recordType: "MX", target: "0 .", expected: "0 ."},
+		{name: "SRV", recordType: "SRV", target: "10 60 05060 SIP.example.com", expected: "10 60 5060 sip.example.com."},
+		{name: "TXT unquoted", recordType: "TXT", target: "v=spf1 -all", expected: "v=spf1 -all"},
+		{name: "TXT quoted", recordType: "TXT", target: `"v=spf1 -all"`, expected: "v=spf1 -all"},
+		{name: "SPF quoted", recordType: "SPF", target: `"v=spf1 -all"`, expected: "v=spf1 -all"},
+		{name: "Malformed MX left unchanged", recordType: "MX", target: "mail.example.com", expected: "mail.example.com"},
+		{name: "Malformed IP left unchanged", recordType: "A", target: "not-an-ip", expected: "not-an-ip"},
+		{name: "Unknown type left unchanged", recordType: "LOC", target: "52 22 23.000 N 4 53 32.000 E -2.00m", expected: "52 22 23.000 N 4 53 32.000 E -2.00m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := canonicalTarget(tt.recordType, tt.target)
+			if result != tt.expected {
+				t.Errorf("canonicalTarget(%q, %q) = %q, want %q", tt.recordType, tt.target, result, tt.expected)
+			}
+			// Canonicalization must be idempotent
+			if again := canonicalTarget(tt.recordType, result); again != result {
+				t.Errorf("canonicalTarget() is not idempotent: %q -> %q", result, again)
+			}
+		})
+	}
+}
+
+func TestCanonicalTargetsDeduplicates(t *testing.T) {
+	result := canonicalTargets("AAAA", []string{"2001:db8::1", "2001:DB8:0:0::1", "2001:db8::2"})
+	expected := endpoint.Targets{"2001:db8::1", "2001:db8::2"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("canonicalTargets() = %v, want %v", result, expected)
+	}
+}
+
+// TestCanonicalRoundTrip checks that a target adjusted for external-dns and the
+// record deSEC stores for it are read back identically, so the plan is stable.
+func TestCanonicalRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordType string
+		desired    string
+		stored     string
+	}{
+		{name: "A", recordType: "A", desired: "192.0.2.1", stored: "192.0.2.1"},
+		{name: "AAAA", recordType: "AAAA", desired: "2001:DB8:0:0:0:0:0:1", stored: "2001:db8::1"},
+		{name: "CNAME", recordType: "CNAME", desired: "LB.Example.net", stored: "lb.example.net."},
+		{name: "NS", recordType: "NS", desired: "ns1.desec.io", stored: "ns1.desec.io."},
+		{name: "PTR", recordType: "PTR", desired: "host.example.com", stored: "host.example.com."},
+		{name: "MX", recordType: "MX", desired: "10 mail.example.com", stored: "10 mail.example.com."},
+		{name: "SRV", recordType: "SRV", desired: "0 5 5060 sip.example.com", stored: "0 5 5060 sip.example.com."},
+		{name: "TXT", recordType: "TXT", desired: `"heritage=external-dns,external-dns/owner=default"`, stored: `"heritage=external-dns,external-dns/owner=default"`},
+		{name: "TXT unquoted", recordType: "TXT", desired: "v=DMARC1; p=reject", stored: `"v=DMARC1; p=reject"`},
+		{name: "TXT multiple strings", recordType: "TXT", desired: `"v=DKIM1; k=rsa; " "p=MIGf"`, stored: `"v=DKIM1; k=rsa; p=MIGf"`},
+	}
+
+	client, err := CreateDesecClient(config.Config{
+		APIToken:      "test-token",
+		DomainFilters: []string{"example.com"},
+		DefaultTTL:    3600,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := &endpoint.Endpoint{
+				DNSName:    "rt.example.com",
+				RecordType: tt.recordType,
+				Targets:    endpoint.Targets{tt.desired},
+				RecordTTL:  3600,
+			}
+			adjusted, err := client.AdjustEndpoints([]*endpoint.Endpoint{desired})
+			if err != nil || len(adjusted) != 1 {
+				t.Fatalf("AdjustEndpoints() = %v, %v", adjusted, err)
+			}
+
+			// What we send must be what deSEC stores
+			rrset := convertEndpointToRRSet(adjusted[0], "example.com", testTTLLimits)
+			if !reflect.DeepEqual(rrset.Records, []string{tt.stored}) {
+				t.Errorf("convertEndpointToRRSet() records = %v, want %v", rrset.Records, []string{tt.stored})
+			}
+
+			// What we read back must be what external-dns desires
+			current := convertRRSetToEndpoint(&desec.RRSet{
+				SubName: "rt",
+				Type:    tt.recordType,
+				Records: []string{tt.stored},
+				TTL:     3600,
+			}, "example.com")
+			if !reflect.DeepEqual(current.Targets, adjusted[0].Targets) {
+				t.Errorf("round trip targets = %v, want %v", current.Targets, adjusted[0].Targets)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// ConflictError is returned in compare-and-swap mode when records to update
+// or delete changed since external-dns read them. Nothing was written.
+type ConflictError struct {
+	Endpoints []EndpointError `json:"endpoints"`
+}
+
+func (e *ConflictError) Error() string {
+	reasons := make([]string, 0, len(e.Endpoints))
+	for _, ep := range e.Endpoints {
+		reasons = append(reasons, fmt.Sprintf("%s/%s: %s", ep.DNSName, ep.RecordType, ep.Reason))
+	}
+	return fmt.Sprintf("%d conflicting changes: %s", len(e.Endpoints), strings.Join(reasons, "; "))
+}
+
+// Is matches ErrConflict
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// expectedState is a record as external-dns expects it before a change
+type expectedState struct {
+	change   string
+	endpoint *endpoint.Endpoint
+}
+
+// checkConflicts compares the records updated or deleted by the changes with
+// their current state in deSEC. Updates expect UpdateOld and deletes the
+// deleted endpoint; records already deleted don't conflict with a delete.
+func (d *DesecClient) checkConflicts(changes plan.Changes) error {
+	expected := make(map[string][]expectedState)
+	add := func(change string, endpoints []*endpoint.Endpoint) {
+		for _, ep := range endpoints {
+			if domain := findMatchingDomain(ep.DNSName, d.domainFilters); domain != "" {
+				expected[domain] = append(expected[domain], expectedState{change: change, endpoint: ep})
+			}
+		}
+	}
+	add("updateOld", changes.UpdateOld)
+	add("delete", changes.Delete)
+
+	var conflicts []EndpointError
+	for _, domain := range slices.Sorted(maps.Keys(expected)) {
+		current, err := d.GetEndpoints(domain)
+		if err != nil {
+			return fmt.Errorf("failed to read the current records of %s: %w", domain, err)
+		}
+		live := make(map[string]*endpoint.Endpoint, len(current))
+		for _, ep := range current {
+			live[endpointKey(ep)] = ep
+		}
+
+		for _, state := range expected[domain] {
+			ep := state.endpoint
+			reason := conflictReason(ep, live[endpointKey(ep)], state.change == "delete")
+			if reason == "" {
+				continue
+			}
+			conflicts = append(conflicts, EndpointError{
+				Change:        state.change,
+				DNSName:       ep.DNSName,
+				RecordType:    ep.RecordType,
+				SetIdentifier: ep.SetIdentifier,
+				Targets:       ep.Targets,
+				Reason:        reason,
+			})
+		}
+	}
+	if len(conflicts) > 0 {
+		err := &ConflictError{Endpoints: conflicts}
+		log.Warnf("refusing changes: %v", err)
+		return err
+	}
+	return nil
+}
+
+// conflictReason describes how the current state of a record differs from the
+// expected one, or returns "" when it matches
+func conflictReason(expected, current *endpoint.Endpoint, deleting bool) string {
+	if current == nil {
+		if deleting {
+			return ""
+		}
+		return "record no longer exists"
+	}
+	want := slices.Sorted(slices.Values(canonicalTargets(expected.RecordType, expected.Targets)))
+	got := slices.Sorted(slices.Values(current.Targets))
+	if !slices.Equal(want, got) {
+		return fmt.Sprintf("records are %v, expected %v", got, want)
+	}
+	if expected.RecordTTL > 0 && current.RecordTTL != expected.RecordTTL {
+		return fmt.Sprintf("TTL is %d, expected %d", current.RecordTTL, expected.RecordTTL)
+	}
+	return ""
+}
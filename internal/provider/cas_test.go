@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestApplyChangesCompareAndSwap(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	fake.put("example.com", desec.RRSet{SubName: "www", Type: "A", TTL: 3600, Records: []string{"192.0.2.1"}})
+	fake.put("example.com", desec.RRSet{SubName: "old", Type: "A", TTL: 3600, Records: []string{"192.0.2.3"}})
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600, CompareAndSwap: true})
+
+	www := &endpoint.Endpoint{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 3600}
+	old := &endpoint.Endpoint{DNSName: "old.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.3"}, RecordTTL: 3600}
+	changes := plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{www},
+		UpdateNew: []*endpoint.Endpoint{{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.2"}, RecordTTL: 3600}},
+		Delete:    []*endpoint.Endpoint{old},
+	}
+
+	// Someone changed both records after external-dns read them
+	fake.put("example.com", desec.RRSet{SubName: "www", Type: "A", TTL: 3600, Records: []string{"192.0.2.9"}})
+	fake.put("example.com", desec.RRSet{SubName: "old", Type: "A", TTL: 60, Records: []string{"192.0.2.3"}})
+	writes := fake.writes()
+	err := client.ApplyChanges(changes)
+	var conflictErr *ConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("ApplyChanges() error = %v, want a ConflictError", err)
+	}
+	if len(conflictErr.Endpoints) != 2 || conflictErr.Endpoints[0].Change != "updateOld" || conflictErr.Endpoints[1].Change != "delete" {
+		t.Errorf("ApplyChanges() conflicts = %+v", conflictErr.Endpoints)
+	}
+	if fake.writes() != writes {
+		t.Error("ApplyChanges() wrote records despite the conflicts")
+	}
+
+	// Once external-dns sees the current records, the changes go through, and
+	// deleting a record that is already gone is no conflict
+	fake.put("example.com", desec.RRSet{SubName: "www", Type: "A", TTL: 3600, Records: []string{"192.0.2.1"}})
+	fake.mu.Lock()
+	delete(fake.rrsets["example.com"], rrsetKey{"old", "A"})
+	fake.mu.Unlock()
+	if err := client.ApplyChanges(changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if rrset, _ := fake.get("example.com", "www", "A"); rrset.Records[0] != "192.0.2.2" {
+		t.Errorf("www.example.com records = %v, want [192.0.2.2]", rrset.Records)
+	}
+}
@@ -0,0 +1,204 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/nrdcg/desec"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// chunkRetryBackoff is the delay before the first retry of a chunk,
+	// doubled on every following one
+	chunkRetryBackoff = 2 * time.Second
+	// chunkProgressTTL is how long the chunks written by a failed apply are
+	// remembered, so an identical retry checks them in deSEC instead of
+	// sending them again. They are kept in memory only.
+	chunkProgressTTL = 15 * time.Minute
+)
+
+// newWriteLimiter returns the limiter of the requests writing RRsets, allowing
+// limit requests per second with bursts of burst. A limit of 0 disables it.
+func newWriteLimiter(limit float64, burst int) *rate.Limiter {
+	if limit <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(limit), max(burst, 1))
+}
+
+// writeChunks sends RRsets to a zone with send, in order, in chunks of at most
+// the configured size. send makes its requests through sendChunk, so that
+// each one waits for the write rate limiter and is retried when throttled or
+// when deSEC is unavailable. A chunk written by an
+// earlier attempt of the same changes is skipped only when deSEC still holds
+// what it wrote. The outcome of every chunk is recorded in the result, when
+// given.
+func (d *DesecClient) writeChunks(domain, action string, rrsets []desec.RRSet, result *ZoneResult, send func([]desec.RRSet) error) error {
+	return d.writeChunksOf(d.chunkSize, domain, action, rrsets, result, send)
+}
+
+// writeUnchunked sends RRsets to a zone with send in a single request, whatever
+// the configured chunk size, for changes deSEC must apply atomically
+func (d *DesecClient) writeUnchunked(domain, action string, rrsets []desec.RRSet, result *ZoneResult, send func([]desec.RRSet) error) error {
+	return d.writeChunksOf(len(rrsets), domain, action, rrsets, result, send)
+}
+
+// writeChunksOf sends RRsets in chunks of at most size, or in one chunk when
+// size is not positive
+func (d *DesecClient) writeChunksOf(size int, domain, action string, rrsets []desec.RRSet, result *ZoneResult, send func([]desec.RRSet) error) error {
+	if size <= 0 || size > len(rrsets) {
+		size = len(rrsets)
+	}
+	total := (len(rrsets) + size - 1) / size
+	inDeSEC := d.zoneHolds(domain)
+
+	written := 0
+	for i, chunk := range slices.Collect(slices.Chunk(rrsets, size)) {
+		key := chunkKey(domain, action, chunk)
+		if d.chunkWritten(key) && inDeSEC(action, chunk) {
+			written += len(chunk)
+			log.Infof("%s chunk %d/%d of %s (%d RRsets) was written by an earlier attempt and is still in deSEC, skipping", action, i+1, total, domain, len(chunk))
+			result.set(chunk, ResultSkipped, reasonWrittenEarlier)
+			continue
+		}
+		if err := send(chunk); err != nil {
+			log.Errorf("failed to %s chunk %d/%d of %s after %d of %d RRsets: %v, payload: %v", action, i+1, total, domain, written, len(rrsets), err, chunk)
+			err = fmt.Errorf("%s chunk %d/%d of %s: %w", action, i+1, total, domain, err)
+			result.set(chunk, ResultFailed, err.Error())
+			return err
+		}
+		d.markChunkWritten(key)
+		result.set(chunk, ResultApplied, "")
+		written += len(chunk)
+		if total > 1 {
+			log.Infof("%s chunk %d/%d of %s written (%d of %d RRsets)", action, i+1, total, domain, written, len(rrsets))
+		}
+	}
+	return nil
+}
+
+// zoneHolds returns a function reporting whether deSEC holds the RRsets of a
+// chunk as written: deleted RRsets absent, the others with the same TTL and
+// records. The records of the zone are read once, on the first call; when
+// they cannot be read, no chunk is reported as held.
+func (d *DesecClient) zoneHolds(domain string) func(action string, chunk []desec.RRSet) bool {
+	var current map[rrsetKey]desec.RRSet
+	loaded := false
+	return func(action string, chunk []desec.RRSet) bool {
+		if !loaded {
+			loaded = true
+			rrsets, err := d.GetRecords(domain)
+			if err != nil {
+				log.Warnf("failed to read the records of %s, sending the chunks written by an earlier attempt again: %v", domain, err)
+				return false
+			}
+			current = make(map[rrsetKey]desec.RRSet, len(rrsets))
+			for _, rrset := range rrsets {
+				current[rrsetKey{subname: rrset.SubName, recordType: rrset.Type}] = rrset
+			}
+		}
+		if current == nil {
+			return false
+		}
+		for _, rrset := range chunk {
+			existing, ok := current[rrsetKey{subname: rrset.SubName, recordType: rrset.Type}]
+			if action == "delete" || len(rrset.Records) == 0 {
+				if ok {
+					return false
+				}
+				continue
+			}
+			if !ok || existing.TTL != rrset.TTL ||
+				!slices.Equal(driftRecords(rrset.Type, existing.Records), driftRecords(rrset.Type, rrset.Records)) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// bulkUpdate replaces RRsets of a zone with a single bulk update, sent through
+// sendChunk
+func (d *DesecClient) bulkUpdate(domain string, rrsets []desec.RRSet) error {
+	return d.sendChunk(func() error {
+		_, err := d.writer.Records.BulkUpdate(d.ctx, desec.FullResource, domain, rrsets)
+		return err
+	})
+}
+
+// sendChunk sends a write request once the write rate limiter allows it,
+// retrying with an exponential backoff, or after the delay asked by deSEC,
+// while the error is temporary
+func (d *DesecClient) sendChunk(send func() error) error {
+	for attempt := 0; ; attempt++ {
+		if err := d.writeLimiter.Wait(d.ctx); err != nil {
+			return err
+		}
+		err := send()
+		if err == nil || attempt >= d.chunkRetries || !isTemporary(err) {
+			return err
+		}
+		backoff := d.chunkBackoff << attempt
+		var respErr *responseError
+		if errors.As(err, &respErr) {
+			backoff = max(backoff, respErr.RetryAfter)
+		}
+		log.Warnf("chunk request failed, retrying in %s (%d/%d): %v", backoff, attempt+1, d.chunkRetries, err)
+		select {
+		case <-d.ctx.Done():
+			return d.ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// isTemporary reports whether a request may succeed when sent again: deSEC
+// throttled it or was unavailable, or it failed before getting a response
+func isTemporary(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *desec.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// chunkKey identifies a chunk by its zone, action and payload
+func chunkKey(domain, action string, chunk []desec.RRSet) string {
+	payload, _ := json.Marshal(chunk)
+	sum := sha256.Sum256(append([]byte(domain+" "+action+" "), payload...))
+	return hex.EncodeToString(sum[:])
+}
+
+// chunkWritten reports whether a chunk was written by a recent attempt
+func (d *DesecClient) chunkWritten(key string) bool {
+	d.chunkMu.Lock()
+	defer d.chunkMu.Unlock()
+	written, ok := d.chunksWritten[key]
+	return ok && time.Since(written) < chunkProgressTTL
+}
+
+// markChunkWritten remembers a chunk written
+func (d *DesecClient) markChunkWritten(key string) {
+	d.chunkMu.Lock()
+	defer d.chunkMu.Unlock()
+	d.chunksWritten[key] = time.Now()
+}
+
+// resetChunkProgress forgets the chunks written, once every change is applied
+func (d *DesecClient) resetChunkProgress() {
+	d.chunkMu.Lock()
+	defer d.chunkMu.Unlock()
+	clear(d.chunksWritten)
+}
@@ -0,0 +1,236 @@
+package provider
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// chunkEndpoints returns count A endpoints of the zone
+func chunkEndpoints(zone string, count int) []*endpoint.Endpoint {
+	endpoints := make([]*endpoint.Endpoint, count)
+	for i := range endpoints {
+		endpoints[i] = &endpoint.Endpoint{
+			DNSName:    fmt.Sprintf("host%d.%s", i, zone),
+			RecordType: "A",
+			RecordTTL:  3600,
+			Targets:    endpoint.Targets{fmt.Sprintf("192.0.2.%d", i+1)},
+		}
+	}
+	return endpoints
+}
+
+func TestApplyChangesChunks(t *testing.T) {
+	fake, srv := newFakeDesec(t, "chunks.example")
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"chunks.example"}, DefaultTTL: 3600, BulkChunkSize: 2})
+
+	endpoints := chunkEndpoints("chunks.example", 5)
+	if err := client.ApplyChanges(plan.Changes{Create: endpoints}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if posts := fake.count(http.MethodPost); posts != 3 {
+		t.Errorf("ApplyChanges() sent %d create requests, want 3", posts)
+	}
+
+	if err := client.ApplyChanges(plan.Changes{Delete: endpoints}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if puts := fake.count(http.MethodPut); puts != 3 {
+		t.Errorf("ApplyChanges() sent %d delete requests, want 3", puts)
+	}
+	for i := range 5 {
+		if _, ok := fake.get("chunks.example", fmt.Sprintf("host%d", i), "A"); ok {
+			t.Errorf("host%d/A still exists", i)
+		}
+	}
+}
+
+func TestApplyChangesChunkRetry(t *testing.T) {
+	fake, srv := newFakeDesec(t, "chunks.example")
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"chunks.example"}, DefaultTTL: 3600, BulkChunkRetries: 1})
+	client.chunkBackoff = time.Millisecond
+
+	// The chunk is sent again after being throttled once
+	throttled := false
+	fake.failWith(func(r *http.Request) int {
+		if r.Method == http.MethodPost && !throttled {
+			throttled = true
+			return http.StatusTooManyRequests
+		}
+		return 0
+	})
+	if err := client.ApplyChanges(plan.Changes{Create: chunkEndpoints("chunks.example", 2)}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if posts := fake.count(http.MethodPost); posts != 2 {
+		t.Errorf("ApplyChanges() sent %d create requests, want 2", posts)
+	}
+	if _, ok := fake.get("chunks.example", "host1", "A"); !ok {
+		t.Error("host1/A was not created")
+	}
+
+	// A chunk throttled every time is only retried by writeChunks, not by the
+	// client as well
+	fake.failWith(func(r *http.Request) int {
+		if r.Method == http.MethodPost {
+			return http.StatusTooManyRequests
+		}
+		return 0
+	})
+	posts := fake.count(http.MethodPost)
+	if err := client.ApplyChanges(plan.Changes{Create: chunkEndpoints("throttled.chunks.example", 1)}); err == nil {
+		t.Fatal("ApplyChanges() expected error but got none")
+	}
+	if sent := fake.count(http.MethodPost) - posts; sent != 2 {
+		t.Errorf("ApplyChanges() sent %d create requests for a throttled chunk, want 2", sent)
+	}
+
+	// Errors other than throttling are not retried
+	fake.failWith(func(r *http.Request) int {
+		if r.Method == http.MethodPost {
+			return http.StatusBadRequest
+		}
+		return 0
+	})
+	posts = fake.count(http.MethodPost)
+	if err := client.ApplyChanges(plan.Changes{Create: chunkEndpoints("other.chunks.example", 1)}); err == nil {
+		t.Fatal("ApplyChanges() expected error but got none")
+	}
+	if sent := fake.count(http.MethodPost) - posts; sent != 1 {
+		t.Errorf("ApplyChanges() sent %d create requests for a bad request, want 1", sent)
+	}
+}
+
+func TestApplyChangesResumesChunks(t *testing.T) {
+	fake, srv := newFakeDesec(t, "chunks.example")
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"chunks.example"}, DefaultTTL: 3600, BulkChunkSize: 2})
+
+	// deSEC becomes unavailable after the first chunk
+	fake.failWith(func(r *http.Request) int {
+		if r.Method == http.MethodPost && fake.countLocked(http.MethodPost) > 1 {
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	})
+	changes := plan.Changes{Create: chunkEndpoints("chunks.example", 5)}
+	if err := client.ApplyChanges(changes); err == nil {
+		t.Fatal("ApplyChanges() expected error but got none")
+	}
+	if _, ok := fake.get("chunks.example", "host0", "A"); !ok {
+		t.Fatal("the first chunk was not created")
+	}
+
+	// The retry of the same changes skips the first chunk, still in deSEC,
+	// instead of sending it again, without reporting it as applied
+	fake.failWith(nil)
+	posts := fake.count(http.MethodPost)
+	if err := client.ApplyChanges(changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if sent := fake.count(http.MethodPost) - posts; sent != 2 {
+		t.Errorf("ApplyChanges() sent %d create requests when resuming, want 2", sent)
+	}
+	for _, rrset := range client.LastApply().Zones[0].RRSets {
+		want := ResultApplied
+		if rrset.Name == "host0.chunks.example" || rrset.Name == "host1.chunks.example" {
+			want = ResultSkipped
+		}
+		if rrset.Status != want {
+			t.Errorf("%s/%s status = %q, want %q", rrset.Name, rrset.Type, rrset.Status, want)
+		}
+	}
+	for i := range 5 {
+		if _, ok := fake.get("chunks.example", fmt.Sprintf("host%d", i), "A"); !ok {
+			t.Errorf("host%d/A was not created", i)
+		}
+	}
+	if len(client.chunksWritten) != 0 {
+		t.Errorf("chunk progress = %v, want it cleared after a complete apply", client.chunksWritten)
+	}
+}
+
+func TestApplyChangesResendsChunksMissingFromDeSEC(t *testing.T) {
+	fake, srv := newFakeDesec(t, "chunks.example")
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"chunks.example"}, DefaultTTL: 3600, BulkChunkSize: 2})
+
+	fake.failWith(func(r *http.Request) int {
+		if r.Method == http.MethodPost && fake.countLocked(http.MethodPost) > 1 {
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	})
+	changes := plan.Changes{Create: chunkEndpoints("chunks.example", 5)}
+	if err := client.ApplyChanges(changes); err == nil {
+		t.Fatal("ApplyChanges() expected error but got none")
+	}
+
+	// An RRset of the first chunk is deleted before the retry, which sends
+	// the chunk again
+	fake.remove("chunks.example", "host1", "A")
+	fake.failWith(nil)
+	posts := fake.count(http.MethodPost)
+	if err := client.ApplyChanges(changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if sent := fake.count(http.MethodPost) - posts; sent != 3 {
+		t.Errorf("ApplyChanges() sent %d create requests, want 3", sent)
+	}
+	if _, ok := fake.get("chunks.example", "host1", "A"); !ok {
+		t.Error("host1/A was not created again")
+	}
+}
+
+func TestWriteRequestsAreRetried(t *testing.T) {
+	// The deletion sent again after a rejection is retried like a chunk
+	fake, srv := newFakeDesec(t, "example.com")
+	fake.put("example.com", desec.RRSet{SubName: "api", Type: "A", TTL: 3600, Records: []string{"192.0.2.2"}})
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600, BulkChunkRetries: 1})
+	client.chunkBackoff = time.Millisecond
+	fake.failWith(func(r *http.Request) int {
+		switch {
+		case r.Method != http.MethodPut:
+			return 0
+		case fake.countLocked(http.MethodPut) == 1:
+			return http.StatusBadRequest
+		case fake.countLocked(http.MethodPut) == 2:
+			return http.StatusTooManyRequests
+		}
+		return 0
+	})
+	err := client.ApplyChanges(plan.Changes{Delete: []*endpoint.Endpoint{
+		{DNSName: "www.example.com", RecordType: "A", RecordTTL: 3600, Targets: endpoint.Targets{"192.0.2.1"}},
+		{DNSName: "api.example.com", RecordType: "A", RecordTTL: 3600, Targets: endpoint.Targets{"192.0.2.2"}},
+	}})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if puts := fake.count(http.MethodPut); puts != 3 {
+		t.Errorf("ApplyChanges() sent %d deletions, want 3", puts)
+	}
+	if _, ok := fake.get("example.com", "api", "A"); ok {
+		t.Error("api/A still exists")
+	}
+
+	// So is the update of a delegation
+	fake, client = newDelegationTestClient(t, false)
+	client.chunkRetries = 1
+	client.chunkBackoff = time.Millisecond
+	fake.failWith(func(r *http.Request) int {
+		if r.Method == http.MethodPut && fake.countLocked(http.MethodPut) == 1 {
+			return http.StatusTooManyRequests
+		}
+		return 0
+	})
+	if _, err := client.SyncDelegations(); err != nil {
+		t.Fatalf("SyncDelegations() error = %v", err)
+	}
+	if puts := fake.count(http.MethodPut); puts != 2 {
+		t.Errorf("SyncDelegations() sent %d updates, want 2", puts)
+	}
+}
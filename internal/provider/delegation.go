@@ -0,0 +1,260 @@
+package provider
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nrdcg/desec"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const recordTypeDS = "DS"
+
+// DelegationStatus compares the delegation of a child zone with the NS and DS
+// RRsets published for it in its parent zone
+type DelegationStatus struct {
+	Parent      string   `json:"parent"`
+	Child       string   `json:"child"`
+	NS          []string `json:"ns"`
+	DS          []string `json:"ds"`
+	PublishedNS []string `json:"publishedNS"`
+	PublishedDS []string `json:"publishedDS"`
+	InSync      bool     `json:"inSync"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// delegation is a managed zone whose parent zone is managed as well
+type delegation struct {
+	parent string
+	child  string
+}
+
+// findDelegations pairs every managed deSEC domain with its closest managed
+// parent. Only domains listed in the domain filters are considered.
+func findDelegations(domains []desec.Domain, domainFilters []string) []delegation {
+	var managed []string
+	for _, domain := range domains {
+		name := normalizeName(domain.Name)
+		for _, filter := range domainFilters {
+			if normalizeName(filter) == name {
+				managed = append(managed, name)
+				break
+			}
+		}
+	}
+	slices.Sort(managed)
+
+	var delegations []delegation
+	for _, child := range managed {
+		var parent string
+		for _, candidate := range managed {
+			if strings.HasSuffix(child, "."+candidate) && len(candidate) > len(parent) {
+				parent = candidate
+			}
+		}
+		if parent != "" {
+			delegations = append(delegations, delegation{parent: parent, child: child})
+		}
+	}
+	return delegations
+}
+
+// SyncDelegations publishes the NS and DS RRsets of every managed child zone in
+// its managed parent zone, and reports the delegations that had drifted
+func (d *DesecClient) SyncDelegations() ([]DelegationStatus, error) {
+	return d.delegationStatuses(true)
+}
+
+// DelegationStatuses reports the delegations between managed zones without
+// changing them
+func (d *DesecClient) DelegationStatuses() ([]DelegationStatus, error) {
+	return d.delegationStatuses(false)
+}
+
+func (d *DesecClient) delegationStatuses(sync bool) ([]DelegationStatus, error) {
+	domains, err := d.GetDomains()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []DelegationStatus
+	var errs []error
+	for _, pair := range findDelegations(domains, d.domainFilters) {
+		status, toUpdate, err := d.checkDelegation(pair)
+		if err == nil && sync && len(toUpdate) > 0 {
+			err = d.updateDelegation(pair, &status, toUpdate)
+		}
+		if err != nil {
+			log.Errorf("failed to check delegation of %s in %s: %v", pair.child, pair.parent, err)
+			status.Error = err.Error()
+			errs = append(errs, err)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, errors.Join(errs...)
+}
+
+// checkDelegation compares the delegation of one child zone with its parent and
+// returns the RRsets to write to the parent to fix it
+func (d *DesecClient) checkDelegation(pair delegation) (DelegationStatus, []desec.RRSet, error) {
+	status := DelegationStatus{Parent: pair.parent, Child: pair.child}
+
+	ns, ds, err := d.childDelegation(pair.child)
+	if err != nil {
+		return status, nil, err
+	}
+	if len(ns) == 0 {
+		return status, nil, fmt.Errorf("zone %s has no NS records to delegate to", pair.child)
+	}
+	status.NS, status.DS = ns, ds
+
+	subname := extractSubname(pair.child, pair.parent)
+	filter := desec.RRSetFilter{SubName: subname, Type: desec.IgnoreFilter}
+	rrsets, err := d.client.Records.GetAll(d.ctx, pair.parent, &filter)
+	if err != nil {
+		return status, nil, err
+	}
+	published := make(map[string]desec.RRSet)
+	for _, rrset := range rrsets {
+		published[rrset.Type] = rrset
+	}
+	status.PublishedNS = canonicalTargets(endpoint.RecordTypeNS, published[endpoint.RecordTypeNS].Records)
+	status.PublishedDS = canonicalDS(published[recordTypeDS].Records)
+	slices.Sort(status.PublishedNS)
+
+	var toUpdate []desec.RRSet
+	for _, rrset := range []struct {
+		recordType         string
+		expected, observed []string
+	}{
+		{recordType: endpoint.RecordTypeNS, expected: status.NS, observed: status.PublishedNS},
+		{recordType: recordTypeDS, expected: status.DS, observed: status.PublishedDS},
+	} {
+		if slices.Equal(rrset.expected, rrset.observed) {
+			continue
+		}
+		log.Warnf("delegation drift for %s in %s: %s records are %v, expected %v",
+			pair.child, pair.parent, rrset.recordType, rrset.observed, rrset.expected)
+		ttl := d.ttlFor(pair.parent, pair.child, rrset.recordType, endpoint.TTL(published[rrset.recordType].TTL))
+		// Sending an RRset without records deletes it
+		toUpdate = append(toUpdate, desec.RRSet{SubName: subname, Type: rrset.recordType, TTL: ttl, Records: append([]string{}, rrset.expected...)})
+	}
+	status.InSync = len(toUpdate) == 0
+	return status, toUpdate, nil
+}
+
+// updateDelegation writes the delegation RRsets of a child zone to its parent
+func (d *DesecClient) updateDelegation(pair delegation, status *DelegationStatus, toUpdate []desec.RRSet) error {
+	if d.dryRun {
+		log.Infof("dryrun: would update delegation of %s in %s: %v", pair.child, pair.parent, toUpdate)
+		return nil
+	}
+	log.Infof("updating delegation of %s in %s: %v", pair.child, pair.parent, toUpdate)
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	err := d.writeUnchunked(pair.parent, "update delegation", toUpdate, nil, func(chunk []desec.RRSet) error {
+		return d.bulkUpdate(pair.parent, chunk)
+	})
+	if err != nil {
+		return err
+	}
+	d.recordDesired(pair.parent, toUpdate)
+	status.PublishedNS, status.PublishedDS = status.NS, status.DS
+	status.InSync = true
+	return nil
+}
+
+// childDelegation returns the NS records at the apex of a zone and the DS
+// records of its DNSSEC keys, both sorted
+func (d *DesecClient) childDelegation(child string) (ns, ds []string, err error) {
+	rrset, err := d.client.Records.Get(d.ctx, child, "", endpoint.RecordTypeNS)
+	if err != nil && !isNotFound(err) {
+		return nil, nil, err
+	}
+	if rrset != nil {
+		ns = canonicalTargets(endpoint.RecordTypeNS, rrset.Records)
+		slices.Sort(ns)
+	}
+
+	domain, err := d.client.Domains.Get(d.ctx, child)
+	if err != nil {
+		return nil, nil, err
+	}
+	var records []string
+	for _, key := range domain.Keys {
+		records = append(records, key.DS...)
+	}
+	return ns, canonicalDS(records), nil
+}
+
+// canonicalDS normalizes DS records and returns them sorted and deduplicated.
+// Records that can't be parsed are kept as they are.
+func canonicalDS(records []string) []string {
+	result := make([]string, 0, len(records))
+	for _, record := range records {
+		if parsed, err := parseDS(record); err == nil {
+			record = parsed
+		}
+		if !slices.Contains(result, record) {
+			result = append(result, record)
+		}
+	}
+	slices.Sort(result)
+	return result
+}
+
+// parseDS parses "<key tag> <algorithm> <digest type> <digest>", the digest
+// is lowercased and may be split by whitespace
+func parseDS(record string) (string, error) {
+	fields := strings.Fields(record)
+	if len(fields) < 4 {
+		return "", fmt.Errorf("expected \"<key tag> <algorithm> <digest type> <digest>\"")
+	}
+	keyTag, err := parseUint16("key tag", fields[0])
+	if err != nil {
+		return "", err
+	}
+	algorithm, err := parseUint8("algorithm", fields[1])
+	if err != nil {
+		return "", err
+	}
+	digestType, err := parseUint8("digest type", fields[2])
+	if err != nil {
+		return "", err
+	}
+	digest := strings.ToLower(strings.Join(fields[3:], ""))
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", fmt.Errorf("digest is not hexadecimal")
+	}
+	return strings.Join([]string{keyTag, algorithm, digestType, digest}, " "), nil
+}
+
+// isNotFound reports whether an API call failed because the object doesn't exist
+func isNotFound(err error) bool {
+	var apiErr *desec.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// RunDelegationSync syncs the delegations now and then every interval until
+// the context is done
+func (d *DesecClient) RunDelegationSync(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.SyncDelegations(); err != nil {
+			log.Errorf("failed to sync delegations: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
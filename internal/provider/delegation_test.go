@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+)
+
+func TestFindDelegations(t *testing.T) {
+	domains := []desec.Domain{
+		{Name: "example.com"},
+		{Name: "team.example.com"},
+		{Name: "dev.team.example.com"},
+		{Name: "unmanaged.example.com"},
+		{Name: "other.org"},
+	}
+	filters := []string{"example.com", "team.example.com.", "dev.team.example.com", "other.org", "missing.other.org"}
+
+	expected := []delegation{
+		{parent: "team.example.com", child: "dev.team.example.com"},
+		{parent: "example.com", child: "team.example.com"},
+	}
+	if result := findDelegations(domains, filters); !reflect.DeepEqual(result, expected) {
+		t.Errorf("findDelegations() = %v, want %v", result, expected)
+	}
+}
+
+func TestParseDS(t *testing.T) {
+	result, err := parseDS("02371 13 2 1F987CC6583E9279 6ABC86FF3A03CBD5")
+	if err != nil || result != "2371 13 2 1f987cc6583e92796abc86ff3a03cbd5" {
+		t.Errorf("parseDS() = %q, %v", result, err)
+	}
+	if _, err := parseDS("2371 13 2 not-hex"); err == nil {
+		t.Errorf("parseDS() expected an error for a non hexadecimal digest")
+	}
+}
+
+func newDelegationTestClient(t *testing.T, dryRun bool) (*fakeDesec, *DesecClient) {
+	t.Helper()
+	fake, srv := newFakeDesec(t, "example.com", "team.example.com")
+	fake.put("team.example.com", desec.RRSet{SubName: "", Type: "NS", TTL: 3600, Records: []string{"ns2.desec.org.", "ns1.desec.io."}})
+	fake.setKeys("team.example.com", []desec.DomainKey{
+		{DS: []string{"2371 13 2 1F987CC6583E92796ABC86FF3A03CBD5", "2371 13 4 AABB"}},
+	})
+	client := newTestClient(t, srv, config.Config{
+		DomainFilters: []string{"example.com", "team.example.com"},
+		DefaultTTL:    3600,
+		DryRun:        dryRun,
+	})
+	return fake, client
+}
+
+func TestSyncDelegations(t *testing.T) {
+	fake, client := newDelegationTestClient(t, false)
+
+	statuses, err := client.SyncDelegations()
+	if err != nil {
+		t.Fatalf("SyncDelegations() error = %v", err)
+	}
+	if len(statuses) != 1 || !statuses[0].InSync || len(statuses[0].PublishedNS) != 2 {
+		t.Fatalf("SyncDelegations() = %+v, want one delegation in sync", statuses)
+	}
+	if rrset, _ := fake.get("example.com", "team", "NS"); !reflect.DeepEqual(rrset.Records, []string{"ns1.desec.io.", "ns2.desec.org."}) {
+		t.Errorf("published NS = %v", rrset.Records)
+	}
+	expectedDS := []string{"2371 13 2 1f987cc6583e92796abc86ff3a03cbd5", "2371 13 4 aabb"}
+	if rrset, _ := fake.get("example.com", "team", "DS"); !reflect.DeepEqual(rrset.Records, expectedDS) {
+		t.Errorf("published DS = %v, want %v", rrset.Records, expectedDS)
+	}
+
+	// Nothing is written while the delegation is in sync
+	writes := fake.writes()
+	if _, err := client.SyncDelegations(); err != nil || fake.writes() != writes {
+		t.Errorf("SyncDelegations() = %v with %d writes, want no write", err, fake.writes()-writes)
+	}
+
+	// A stale DS is replaced
+	fake.put("example.com", desec.RRSet{SubName: "team", Type: "DS", TTL: 3600, Records: []string{"1 13 2 abcd"}})
+	if _, err := client.SyncDelegations(); err != nil {
+		t.Fatalf("SyncDelegations() error = %v", err)
+	}
+	if rrset, _ := fake.get("example.com", "team", "DS"); !reflect.DeepEqual(rrset.Records, expectedDS) {
+		t.Errorf("published DS = %v, want %v", rrset.Records, expectedDS)
+	}
+}
+
+func TestSyncDelegationsDryRunReportsDrift(t *testing.T) {
+	fake, client := newDelegationTestClient(t, true)
+
+	statuses, err := client.SyncDelegations()
+	if err != nil {
+		t.Fatalf("SyncDelegations() error = %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].InSync || len(statuses[0].PublishedNS) != 0 || len(statuses[0].DS) != 2 {
+		t.Errorf("SyncDelegations() = %+v, want one drifted delegation", statuses)
+	}
+	if writes := fake.writes(); writes != 0 {
+		t.Errorf("dry run sent %d write requests, want none", writes)
+	}
+}
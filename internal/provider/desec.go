@@ -2,12 +2,18 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
 	"github.com/nrdcg/desec"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/publicsuffix"
+	"golang.org/x/time/rate"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
 )
@@ -17,32 +23,114 @@ type DesecClient struct {
 	ctx           context.Context
 	dryRun        bool
 	defaultTTL    int
+	ttlPolicy     config.TTLPolicy
 	domainFilters []string
+	reverseZones  []string
+	dsResolver    DSResolver
+
+	// compareAndSwap checks the records to update or delete before writing
+	compareAndSwap bool
+
+	// partialApply keeps applying the other zones when one fails
+	partialApply bool
+	lastApplyMu  sync.Mutex
+	lastApply    *ApplyResult
+
+	// Bulk writes are sent by writer, without retries of its own: every
+	// write request goes through sendChunk, which waits for the rate limiter
+	// and alone retries it, honouring the delay asked by deSEC. They are
+	// chunked by writeChunks, and the chunks written by a failed attempt are
+	// skipped on retry while deSEC still holds them.
+	writer        *desec.Client
+	chunkSize     int
+	chunkRetries  int
+	chunkBackoff  time.Duration
+	writeLimiter  *rate.Limiter
+	chunkMu       sync.Mutex
+	chunksWritten map[string]time.Time
+
+	aliasMode bool
+	resolver  Resolver
+	aliasMu   sync.Mutex
+	aliases   map[string]alias
+
+	// The alias refresher runs in ALIAS mode, or once a record opts in
+	aliasRefreshCtx      context.Context
+	aliasRefreshInterval time.Duration
+	aliasRefreshOnce     sync.Once
+
+	// Records marked as not managed by the last endpoints adjusted
+	unmanagedMu sync.Mutex
+	unmanaged   map[string]struct{}
+
+	// Minimum TTL of every zone, loaded from the domain list
+	zoneMu         sync.RWMutex
+	zoneMinTTLs    map[string]int
+	zoneTTLsLoaded time.Time
+
+	// Last state applied to the RRsets of every zone, checked for drift.
+	// writeMu is held by the writes to the zones until their state is
+	// recorded, and by the drift checks, so that a check never mistakes a
+	// write in progress for drift and reverts it.
+	writeMu       sync.Mutex
+	desiredMu     sync.Mutex
+	desired       map[string]map[rrsetKey]desec.RRSet
+	driftReports  map[string]DriftReport
+	driftAutoHeal bool
 }
 
 const (
-	minimumTTL = 3600 // Minimum TTL for desec is 3600 seconds
+	minimumTTL  = 3600 // Default minimum TTL of deSEC domains, used until the zone's own is known
+	apiRetryMax = 2    // Retries of a failed deSEC request by the client itself, except bulk writes
 )
 
 func CreateDesecClient(config config.Config) (*DesecClient, error) {
-	if config.DefaultTTL < minimumTTL {
-		log.Warnf("default TTL %d is less than the minimum required TTL %d, setting to %d", config.DefaultTTL, minimumTTL, minimumTTL)
+	// Lower defaults are still raised to the minimum TTL of each zone
+	if config.DefaultTTL <= 0 {
+		log.Warnf("default TTL %d is not positive, setting to %d", config.DefaultTTL, minimumTTL)
 		config.DefaultTTL = minimumTTL
 	}
+	if config.DefaultTTL > maximumTTL {
+		log.Warnf("default TTL %d is more than the maximum allowed TTL %d, setting to %d", config.DefaultTTL, maximumTTL, maximumTTL)
+		config.DefaultTTL = maximumTTL
+	}
 
 	ctx := context.Background()
 	client := &DesecClient{
-		client:        desec.New(config.APIToken, desec.ClientOptions{RetryMax: 2}),
-		ctx:           ctx,
-		dryRun:        config.DryRun,
-		defaultTTL:    config.DefaultTTL,
-		domainFilters: config.DomainFilters,
+		client:         newAPIClient(config.APIToken, apiRetryMax),
+		writer:         newAPIClient(config.APIToken, 0),
+		ctx:            ctx,
+		dryRun:         config.DryRun,
+		defaultTTL:     config.DefaultTTL,
+		ttlPolicy:      config.TTLPolicy,
+		domainFilters:  config.DomainFilters,
+		reverseZones:   config.ReverseZones,
+		dsResolver:     NewDSResolver(config.DNSSECResolver),
+		compareAndSwap: config.CompareAndSwap,
+		partialApply:   config.PartialApply,
+		chunkSize:      config.BulkChunkSize,
+		chunkRetries:   config.BulkChunkRetries,
+		chunkBackoff:   chunkRetryBackoff,
+		writeLimiter:   newWriteLimiter(config.WriteRateLimit, config.WriteRateBurst),
+		chunksWritten:  make(map[string]time.Time),
+		aliasMode:      config.AliasMode,
+		resolver:       NewResolver(config.AliasResolver),
+		aliases:        make(map[string]alias),
+		desired:        make(map[string]map[rrsetKey]desec.RRSet),
+		driftReports:   make(map[string]DriftReport),
+		driftAutoHeal:  config.DriftAutoHeal,
 	}
 	return client, nil
 }
 
+// GetDomains lists the deSEC domains and caches their minimum TTL
 func (d *DesecClient) GetDomains() ([]desec.Domain, error) {
-	return d.client.Domains.GetAll(d.ctx)
+	domains, err := d.client.Domains.GetAll(d.ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.cacheZoneTTLs(domains)
+	return domains, nil
 }
 
 func (d *DesecClient) GetRecords(domain string) ([]desec.RRSet, error) {
@@ -52,102 +140,318 @@ func (d *DesecClient) GetRecords(domain string) ([]desec.RRSet, error) {
 // GetEndpoints fetches all RRSets for a domain and converts them to external-dns Endpoints.
 func (d *DesecClient) GetEndpoints(domain string) ([]*endpoint.Endpoint, error) {
 	log.Debugf("fetching records for domain %s", domain)
+	// Keep the minimum TTLs used by AdjustEndpoints and ApplyChanges up to date
+	d.refreshZoneTTLs()
 	rrsets, err := d.client.Records.GetAll(d.ctx, domain, nil)
 	if err != nil {
-		return nil, err
+		return nil, requestError(err)
 	}
 	log.Debugf("fetched %d rrsets for domain %s", len(rrsets), domain)
 
+	// RRsets shared by set identifiers are split back using the ownership metadata
+	ownership := parseSetOwnership(rrsets)
+
 	endpoints := make([]*endpoint.Endpoint, 0, len(rrsets))
 	for _, rrset := range rrsets {
-		ep := convertRRSetToEndpoint(&rrset, domain)
-		log.Debugf("converted rrset %s/%s -> endpoint %s/%s (targets: %v, ttl: %d)",
-			rrset.SubName, rrset.Type, ep.DNSName, ep.RecordType, ep.Targets, ep.RecordTTL)
-		endpoints = append(endpoints, ep)
+		if isSetOwnershipRRSet(&rrset) || isPTROwnershipRRSet(&rrset) {
+			continue
+		}
+		for _, ep := range splitRRSet(&rrset, domain, ownership) {
+			// Unmanaged records are hidden so external-dns doesn't plan to delete them
+			if d.isUnmanaged(ep) {
+				log.Debugf("hiding unmanaged record %s/%s", ep.DNSName, ep.RecordType)
+				continue
+			}
+			log.Debugf("converted rrset %s/%s -> endpoint %s/%s (set: %q, targets: %v, ttl: %d)",
+				rrset.SubName, rrset.Type, ep.DNSName, ep.RecordType, ep.SetIdentifier, ep.Targets, ep.RecordTTL)
+			endpoints = append(endpoints, ep)
+		}
 	}
 	return endpoints, nil
 }
 
+// zoneChanges holds the RRsets to create, update and delete in a single zone
+type zoneChanges struct {
+	create []desec.RRSet
+	update []desec.RRSet
+	delete []desec.RRSet
+}
+
+// ApplyChanges applies the changes of external-dns to deSEC. Failed deSEC
+// requests are returned as RequestErrors. When some zones were applied and
+// others not, a PartialApplyError is returned. The outcome of every zone and
+// RRset is kept as the last apply result.
 func (d *DesecClient) ApplyChanges(changes plan.Changes) error {
+	result := &ApplyResult{StartedAt: time.Now(), Zones: []ZoneResult{}}
+	err := result.finish(requestError(d.applyChanges(changes, result)))
+	if err == nil {
+		d.resetChunkProgress()
+	}
+
+	d.lastApplyMu.Lock()
+	d.lastApply = result
+	d.lastApplyMu.Unlock()
+	return err
+}
+
+// LastApply returns the result of the last ApplyChanges, nil before the first
+func (d *DesecClient) LastApply() *ApplyResult {
+	d.lastApplyMu.Lock()
+	defer d.lastApplyMu.Unlock()
+	return d.lastApply
+}
+
+// applyChanges applies the changes zone by zone, adding their outcome to the
+// result. Unless in partial apply mode, the zones after a failed one are
+// skipped. The error of the first zone that failed is returned.
+func (d *DesecClient) applyChanges(changes plan.Changes, result *ApplyResult) error {
 	log.Debugf("applying changes: %d creates, %d updates, %d deletes",
 		len(changes.Create), len(changes.UpdateNew), len(changes.Delete))
 
-	// Create new records
-	for domain, endpoints := range d.mapEndpointsByHostname(changes.Create) {
-		var toCreate []desec.RRSet
+	changes = d.filterUnmanagedChanges(changes)
+
+	// Refuse to overwrite records changed since external-dns read them
+	if d.compareAndSwap {
+		if err := d.checkConflicts(changes); err != nil {
+			return err
+		}
+	}
+
+	if d.aliasMode {
+		flattened, err := d.flattenAliasChanges(changes)
+		if err != nil {
+			log.Errorf("failed to flatten apex CNAMEs: %v", err)
+			return err
+		}
+		changes = flattened
+	}
+
+	zones := make(map[string]*zoneChanges)
+	zone := func(domain string) *zoneChanges {
+		if zones[domain] == nil {
+			zones[domain] = &zoneChanges{}
+		}
+		return zones[domain]
+	}
+
+	// Endpoints sharing an RRset through set identifiers are merged
+	plain, merged := d.splitSetIdentifierChanges(changes)
+
+	for domain, endpoints := range d.mapEndpointsByHostname(plain.Create) {
+		zc := zone(domain)
 		for _, endpoint := range endpoints {
-			toCreate = append(toCreate, *convertEndpointToRRSet(endpoint, domain, d.defaultTTL))
+			zc.create = append(zc.create, *d.convertEndpoint(endpoint, domain))
 		}
+	}
+	for domain, endpoints := range d.mapEndpointsByHostname(plain.UpdateNew) {
+		zc := zone(domain)
+		for _, endpoint := range endpoints {
+			zc.update = append(zc.update, *d.convertEndpoint(endpoint, domain))
+		}
+	}
+	for domain, endpoints := range d.mapEndpointsByHostname(plain.Delete) {
+		zc := zone(domain)
+		for _, endpoint := range endpoints {
+			zc.delete = append(zc.delete, *d.convertEndpoint(endpoint, domain))
+		}
+	}
+	if err := d.mergeSetIdentifierChanges(merged, zone); err != nil {
+		return err
+	}
+	if err := d.planPTRChanges(changes, zone); err != nil {
+		return err
+	}
+
+	var failed error
+	var failedZone string
+	for _, domain := range slices.Sorted(maps.Keys(zones)) {
+		zc := zones[domain]
+		zc.sort()
+		zoneResult := newZoneResult(domain, zc)
+		if failed != nil && !d.partialApply {
+			zoneResult.skip(fmt.Sprintf("not applied after zone %s failed", failedZone))
+		} else if err := d.applyZoneChanges(domain, zc, zoneResult); err != nil {
+			err = requestError(err)
+			zoneResult.Status, zoneResult.Error = ResultFailed, err.Error()
+			if failed == nil {
+				failed, failedZone = err, domain
+			}
+		} else {
+			zoneResult.Status = ResultApplied
+		}
+		result.Zones = append(result.Zones, *zoneResult)
+	}
+	return failed
+}
+
+// applyZoneChanges creates, then updates, then deletes the RRsets of a zone.
+// RRsets replacing one of a conflicting type at the same name are written
+// first, together with the deletion of the RRset they replace.
+func (d *DesecClient) applyZoneChanges(domain string, zc *zoneChanges, result *ZoneResult) error {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
 
+	// Replace RRsets by ones of a conflicting type in a single request, never
+	// chunked, which deSEC applies atomically
+	if swaps := zc.takeTypeConflicts(); len(swaps) > 0 {
 		if d.dryRun {
-			log.Infof("dryrun: would create %d records for domain %s: %v", len(toCreate), domain, toCreate)
+			log.Infof("dryrun: would replace records of conflicting types for domain %s: %v", domain, swaps)
+			result.set(swaps, ResultSkipped, reasonDryRun)
 		} else {
-			log.Debugf("creating %d records for domain %s: %v", len(toCreate), domain, toCreate)
-			_, err := d.client.Records.BulkCreate(d.ctx, domain, toCreate)
+			log.Debugf("replacing records of conflicting types for domain %s: %v", domain, swaps)
+			err := d.writeUnchunked(domain, "swap", swaps, result, func(chunk []desec.RRSet) error {
+				return d.bulkUpdate(domain, chunk)
+			})
 			if err != nil {
-				log.Errorf("failed to create records for domain %s: %v, payload: %v", domain, err, toCreate)
 				return err
 			}
-			log.Debugf("successfully created %d records for domain %s", len(toCreate), domain)
+			d.recordDesired(domain, swaps)
 		}
 	}
 
-	// Update existing records
-	for domain, endpoints := range d.mapEndpointsByHostname(changes.UpdateNew) {
-		var toUpdate []desec.RRSet
-		for _, endpoint := range endpoints {
-			toUpdate = append(toUpdate, *convertEndpointToRRSet(endpoint, domain, d.defaultTTL))
-		}
-
+	// Create new records
+	if toCreate := zc.create; len(toCreate) > 0 {
 		if d.dryRun {
-			log.Infof("dryrun: would update %d records for domain %s: %v", len(toUpdate), domain, toUpdate)
+			log.Infof("dryrun: would create %d records for domain %s: %v", len(toCreate), domain, toCreate)
+			result.set(toCreate, ResultSkipped, reasonDryRun)
 		} else {
-			log.Debugf("updating %d records for domain %s: %v", len(toUpdate), domain, toUpdate)
-			_, err := d.client.Records.BulkUpdate(d.ctx, desec.FullResource, domain, toUpdate)
+			log.Debugf("creating %d records for domain %s: %v", len(toCreate), domain, toCreate)
+			err := d.writeChunks(domain, "create", toCreate, result, func(chunk []desec.RRSet) error {
+				return d.createRRSets(domain, chunk)
+			})
 			if err != nil {
-				log.Errorf("failed to update records for domain %s: %v, payload: %v", domain, err, toUpdate)
 				return err
 			}
-			log.Debugf("successfully updated %d records for domain %s", len(toUpdate), domain)
+			log.Debugf("successfully created %d records for domain %s", len(toCreate), domain)
+			d.recordDesired(domain, toCreate)
 		}
 	}
 
-	// Delete records
-	for domain, endpoints := range d.mapEndpointsByHostname(changes.Delete) {
-		var toDelete []desec.RRSet
-		for _, endpoint := range endpoints {
-			toDelete = append(toDelete, *convertEndpointToRRSet(endpoint, domain, d.defaultTTL))
+	// Update existing records, skipping the unchanged ones
+	if toUpdate := zc.update; len(toUpdate) > 0 {
+		changed := d.minimizeUpdates(domain, toUpdate)
+		result.set(toUpdate, ResultSkipped, reasonUnchanged)
+		result.set(changed, ResultSkipped, reasonNotSent)
+		if err := d.updateRRSets(domain, changed, result); err != nil {
+			return err
+		}
+		if !d.dryRun {
+			d.recordDesired(domain, toUpdate)
 		}
+	}
 
+	// Delete records
+	if toDelete := zc.delete; len(toDelete) > 0 {
 		if d.dryRun {
 			log.Infof("dryrun: would delete %d records for domain %s: %v", len(toDelete), domain, toDelete)
+			result.set(toDelete, ResultSkipped, reasonDryRun)
 		} else {
 			log.Debugf("deleting %d records for domain %s: %v", len(toDelete), domain, toDelete)
-			err := d.client.Records.BulkDelete(d.ctx, domain, toDelete)
+			err := d.writeChunks(domain, "delete", toDelete, result, func(chunk []desec.RRSet) error {
+				return d.deleteRRSets(domain, chunk)
+			})
 			if err != nil {
-				log.Errorf("failed to delete records for domain %s: %v, payload: %v", domain, err, toDelete)
 				return err
 			}
 			log.Debugf("successfully deleted %d records for domain %s", len(toDelete), domain)
+			d.recordDeleted(domain, toDelete)
 		}
 	}
 
 	return nil
 }
 
+// createRRSets creates RRsets in a single bulk request. When some already
+// exist, like after a retried request that timed out, the RRsets are
+// written again with a bulk update, replacing the existing ones. Both
+// requests are sent through sendChunk.
+func (d *DesecClient) createRRSets(domain string, rrsets []desec.RRSet) error {
+	err := d.sendChunk(func() error {
+		_, err := d.writer.Records.BulkCreate(d.ctx, domain, rrsets)
+		return err
+	})
+	if err == nil {
+		return nil
+	}
+	colliding := collidingRRSets(err, rrsets)
+	if len(colliding) == 0 {
+		return err
+	}
+	for _, rrset := range colliding {
+		log.Infof("%s/%s already exists in domain %s, updating it instead of creating it", rrset.SubName, rrset.Type, domain)
+	}
+	return d.bulkUpdate(domain, rrsets)
+}
+
+// deleteRRSets deletes RRsets in a single bulk request. RRsets already gone
+// count as deleted: when the request is rejected, the ones still in the zone
+// are deleted again. Both requests are sent through sendChunk.
+func (d *DesecClient) deleteRRSets(domain string, rrsets []desec.RRSet) error {
+	err := d.sendChunk(func() error {
+		return d.writer.Records.BulkDelete(d.ctx, domain, rrsets)
+	})
+	if err == nil || isTemporary(err) {
+		return err
+	}
+	if isNotFound(err) {
+		log.Infof("domain %s not found, its %d RRsets to delete are already gone", domain, len(rrsets))
+		return nil
+	}
+
+	current, readErr := d.GetRecords(domain)
+	if readErr != nil {
+		return err
+	}
+	existing := make(map[rrsetKey]bool, len(current))
+	for _, rrset := range current {
+		existing[rrsetKey{subname: rrset.SubName, recordType: rrset.Type}] = true
+	}
+	remaining := slices.DeleteFunc(slices.Clone(rrsets), func(rrset desec.RRSet) bool {
+		if existing[rrsetKey{subname: rrset.SubName, recordType: rrset.Type}] {
+			return false
+		}
+		log.Infof("%s/%s is already gone from domain %s, counting it as deleted", rrset.SubName, rrset.Type, domain)
+		return true
+	})
+	switch len(remaining) {
+	case len(rrsets):
+		return err
+	case 0:
+		return nil
+	default:
+		return d.sendChunk(func() error {
+			return d.writer.Records.BulkDelete(d.ctx, domain, remaining)
+		})
+	}
+}
+
 // AdjustEndpoints adjusts endpoints to be compatible with deSEC requirements.
 // This method is called by external-dns on every reconciliation loop BEFORE
 // change detection.
-// - Ensures TTL meets the minimum requirement (3600 seconds)
-// - Adds trailing dots to CNAME targets
+// - Sets TTLs from the TTL policy, between the minimum TTL of the zone and the maximum TTL
+// - Canonicalizes targets like the records returned by GetEndpoints
+// - Replaces apex CNAMEs by the addresses of their target in ALIAS mode
 // - Filters out endpoints that don't match the domain filters
+// - Applies and strips the deSEC provider-specific properties (desec/ttl, ...)
 func (d *DesecClient) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
 	if endpoints == nil {
 		return []*endpoint.Endpoint{}, nil
 	}
 
+	adjustedEndpoints, unmanaged := d.adjustEndpoints(endpoints, d.flattenAlias)
+	d.unmanagedMu.Lock()
+	d.unmanaged = unmanaged
+	d.unmanagedMu.Unlock()
+	return adjustedEndpoints, nil
+}
+
+// adjustEndpoints adjusts endpoints like AdjustEndpoints, flattening apex
+// CNAMEs with flatten, and returns them along with the keys of the records
+// not to manage. It doesn't change the state of the client itself.
+func (d *DesecClient) adjustEndpoints(endpoints []*endpoint.Endpoint, flatten func(ep *endpoint.Endpoint, domain string) ([]*endpoint.Endpoint, error)) ([]*endpoint.Endpoint, map[string]struct{}) {
 	log.Debugf("adjusting %d endpoints", len(endpoints))
 	adjustedEndpoints := make([]*endpoint.Endpoint, 0, len(endpoints))
+	unmanaged := make(map[string]struct{})
 
 	for _, ep := range endpoints {
 		if ep == nil {
@@ -171,29 +475,67 @@ func (d *DesecClient) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoi
 			ProviderSpecific: ep.ProviderSpecific,
 		}
 
-		// Adjust TTL to meet minimum requirement
-		if adjusted.RecordTTL == 0 || int(adjusted.RecordTTL) < minimumTTL {
-			log.Debugf("adjusting TTL for %s/%s: %d -> %d", ep.DNSName, ep.RecordType, ep.RecordTTL, d.defaultTTL)
-			adjusted.RecordTTL = endpoint.TTL(d.defaultTTL)
+		// Consume the deSEC provider-specific properties so the planner doesn't
+		// see them as a difference with the records read from deSEC
+		// An endpoint that can't be adjusted is skipped and its current records
+		// are left alone, instead of failing the endpoints of every zone
+		options, others, unknown, err := parseRecordOptions(ep.ProviderSpecific)
+		if err != nil {
+			log.Warnf("skipping %s/%s and leaving its records unchanged: %v", ep.DNSName, ep.RecordType, err)
+			unmanaged[endpointKey(ep)] = struct{}{}
+			continue
+		}
+		for _, name := range unknown {
+			log.Warnf("ignoring unknown provider-specific property %s of %s/%s", name, ep.DNSName, ep.RecordType)
+		}
+		if len(others) != len(ep.ProviderSpecific) {
+			adjusted.ProviderSpecific = others
+		}
+		if options.doNotManage {
+			log.Debugf("leaving unmanaged record %s/%s alone", ep.DNSName, ep.RecordType)
+			unmanaged[endpointKey(ep)] = struct{}{}
+			continue
+		}
+
+		// Adjust TTL to the TTL policy and the limits of the zone
+		limits, reason := d.ttlLimits(matchedDomain, ep.DNSName, ep.RecordType)
+		if options.ttl > 0 {
+			limits = d.storedTTLLimits(matchedDomain, ep.DNSName, ep.RecordType)
+			reason = fmt.Sprintf("provider-specific TTL, zone minimum %d", limits.min)
+			adjusted.RecordTTL = options.ttl
 		}
+		adjusted.RecordTTL = endpoint.TTL(limits.clamp(adjusted.RecordTTL))
+		log.Debugf("TTL for %s/%s: %d -> %d (%s)", ep.DNSName, ep.RecordType, ep.RecordTTL, adjusted.RecordTTL, reason)
 
-		// Copy and adjust targets
-		adjusted.Targets = make(endpoint.Targets, len(ep.Targets))
-		for i, target := range ep.Targets {
-			rec := target
-			// Ensure CNAME records end with a dot
-			if ep.RecordType == "CNAME" && !strings.HasSuffix(rec, ".") {
-				log.Debugf("appending trailing dot to CNAME target for %s: %s -> %s.", ep.DNSName, rec, rec)
-				rec = rec + "."
+		// Canonicalize targets the same way records read from deSEC are
+		adjusted.Targets = canonicalTargets(ep.RecordType, ep.Targets)
+		if !slices.Equal(adjusted.Targets, ep.Targets) {
+			log.Debugf("canonicalized targets for %s/%s: %v -> %v", ep.DNSName, ep.RecordType, ep.Targets, adjusted.Targets)
+		}
+
+		// Publish apex CNAMEs as the A and AAAA records of their target
+		aliasMode := d.aliasMode
+		if options.alias != nil {
+			aliasMode = *options.alias
+		}
+		if aliasMode && isApexCNAME(adjusted, matchedDomain) {
+			flattened, err := flatten(adjusted, matchedDomain)
+			if err != nil {
+				log.Warnf("skipping %s/%s and leaving its records unchanged: %v", ep.DNSName, ep.RecordType, err)
+				for _, recordType := range []string{endpoint.RecordTypeA, endpoint.RecordTypeAAAA} {
+					unmanaged[endpointKey(&endpoint.Endpoint{DNSName: ep.DNSName, RecordType: recordType, SetIdentifier: ep.SetIdentifier})] = struct{}{}
+				}
+				continue
 			}
-			adjusted.Targets[i] = rec
+			adjustedEndpoints = append(adjustedEndpoints, flattened...)
+			continue
 		}
 
 		adjustedEndpoints = append(adjustedEndpoints, adjusted)
 	}
 
 	log.Debugf("adjusted %d endpoints (filtered from %d)", len(adjustedEndpoints), len(endpoints))
-	return adjustedEndpoints, nil
+	return adjustedEndpoints, unmanaged
 }
 
 // findMatchingDomain finds the longest matching domain from the domain filters
@@ -241,43 +583,39 @@ func (d *DesecClient) mapEndpointsByHostname(endpoints []*endpoint.Endpoint) map
 		result[matchedDomain] = append(result[matchedDomain], ep)
 	}
 
-	for domain, eps := range result {
-		log.Debugf("domain %s: %d endpoints", domain, len(eps))
+	for _, domain := range slices.Sorted(maps.Keys(result)) {
+		log.Debugf("domain %s: %d endpoints", domain, len(result[domain]))
 	}
 
 	return result
 }
 
+// convertEndpoint converts an adjusted Endpoint to an RRSet
+func (d *DesecClient) convertEndpoint(ep *endpoint.Endpoint, domain string) *desec.RRSet {
+	return convertEndpointToRRSet(ep, domain, d.storedTTLLimits(domain, ep.DNSName, ep.RecordType))
+}
+
 // convertEndpointToRRSet converts an Endpoint to an RRSet
-// domain should be the matched domain filter for this endpoint
-func convertEndpointToRRSet(ep *endpoint.Endpoint, domain string, defaultTTL int) *desec.RRSet {
+// domain should be the matched domain filter for this endpoint and limits the
+// TTL limits of its record
+func convertEndpointToRRSet(ep *endpoint.Endpoint, domain string, limits ttlLimits) *desec.RRSet {
 	if ep == nil {
 		return nil
 	}
 
 	subname := extractSubname(ep.DNSName, domain)
 
-	records := make([]string, len(ep.Targets))
-	for i, target := range ep.Targets {
-		rec := target
-		// Ensure CNAME records end with a dot
-		if ep.RecordType == "CNAME" && !strings.HasSuffix(rec, ".") {
-			rec = rec + "."
-		}
-		records[i] = rec
-	}
-
-	// Use default TTL if the endpoint's TTL is empty or less than minimum TTL
-	ttl := int(ep.RecordTTL)
-	if ep.RecordTTL == 0 || ep.RecordTTL < minimumTTL {
-		ttl = defaultTTL
+	targets := canonicalTargets(ep.RecordType, ep.Targets)
+	records := make([]string, len(targets))
+	for i, target := range targets {
+		records[i] = recordText(ep.RecordType, target)
 	}
 
 	return &desec.RRSet{
 		SubName: subname,
 		Type:    ep.RecordType,
 		Records: records,
-		TTL:     ttl,
+		TTL:     limits.clamp(ep.RecordTTL),
 	}
 }
 
@@ -296,13 +634,10 @@ func convertRRSetToEndpoint(rrset *desec.RRSet, domain string) *endpoint.Endpoin
 	}
 	dnsName = strings.TrimSuffix(dnsName, ".") + "."
 
-	targets := make(endpoint.Targets, len(rrset.Records))
-	copy(targets, rrset.Records)
-
 	return &endpoint.Endpoint{
 		DNSName:    dnsName,
 		RecordType: rrset.Type,
-		Targets:    targets,
+		Targets:    canonicalTargets(rrset.Type, rrset.Records),
 		RecordTTL:  endpoint.TTL(rrset.TTL),
 	}
 }
@@ -381,7 +381,7 @@ func TestConvertEndpointToRRSetExtended(t *testing.T) {
 			expected: &desec.RRSet{
 				SubName: "_dmarc",
 				Type:    "TXT",
-				Records: []string{"v=DMARC1; p=reject"},
+				Records: []string{`"v=DMARC1; p=reject"`},
 				TTL:     3600,
 			},
 		},
@@ -451,7 +451,7 @@ func TestConvertEndpointToRRSetExtended(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := convertEndpointToRRSet(tt.input, tt.domain, 3600)
+			result := convertEndpointToRRSet(tt.input, tt.domain, testTTLLimits)
 			if !reflect.DeepEqual(result, tt.expected) {
 				t.Errorf("convertEndpointToRRSet() = %+v, want %+v", result, tt.expected)
 			}
@@ -487,7 +487,7 @@ func TestConvertRRSetToEndpointExtended(t *testing.T) {
 			input: &desec.RRSet{
 				SubName: "_dmarc",
 				Type:    "TXT",
-				Records: []string{"v=DMARC1; p=reject"},
+				Records: []string{`"v=DMARC1; p=reject"`},
 				TTL:     3600,
 			},
 			domain: "example.com",
@@ -947,7 +947,7 @@ func TestSubDomainConvertEndpointToRRSet(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := convertEndpointToRRSet(tt.input, tt.domain, 3600)
+			result := convertEndpointToRRSet(tt.input, tt.domain, testTTLLimits)
 			if !reflect.DeepEqual(result, tt.expected) {
 				t.Errorf("convertEndpointToRRSet() = %+v, want %+v", result, tt.expected)
 			}
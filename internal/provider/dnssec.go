@@ -0,0 +1,236 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	dsLookupTimeout = 5 * time.Second
+	dnsTypeDS       = dnsmessage.Type(43)
+)
+
+// DSResolver looks up the DS records published for a zone by its parent
+type DSResolver interface {
+	LookupDS(ctx context.Context, zone string) ([]string, error)
+}
+
+// DNSSECKey is a DNSSEC key of a zone along with its DS records
+type DNSSECKey struct {
+	DNSKey  string   `json:"dnskey"`
+	Flags   int      `json:"flags"`
+	KeyType string   `json:"keyType"`
+	DS      []string `json:"ds"`
+}
+
+// ParentDS compares the DS records published by the parent of a zone with the
+// ones deSEC expects
+type ParentDS struct {
+	Published []string `json:"published"`
+	// Status is "ok" when every published DS belongs to the zone, "missing"
+	// when none is published, "mismatch" when a published DS is unknown and
+	// "error" when the lookup failed
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// DNSSECStatus describes the DNSSEC setup of a managed zone
+type DNSSECStatus struct {
+	Zone       string            `json:"zone"`
+	DS         []string          `json:"ds"`
+	Keys       []DNSSECKey       `json:"keys"`
+	Delegation *DelegationStatus `json:"delegation,omitempty"`
+	ParentDS   *ParentDS         `json:"parentDS,omitempty"`
+}
+
+// DNSSECStatuses lists the DS records, keys and delegation status of every
+// managed zone. With checkParent, the DS records published by the parent of
+// each zone are looked up and compared as well.
+func (d *DesecClient) DNSSECStatuses(checkParent bool) ([]DNSSECStatus, error) {
+	domains, err := d.GetDomains()
+	if err != nil {
+		return nil, err
+	}
+	// Failed delegation checks are reported in their status
+	delegations, err := d.DelegationStatuses()
+	if err != nil {
+		log.Warnf("failed to check some delegations: %v", err)
+	}
+
+	var statuses []DNSSECStatus
+	for _, listed := range domains {
+		zone := normalizeName(listed.Name)
+		if !slices.ContainsFunc(d.domainFilters, func(filter string) bool { return normalizeName(filter) == zone }) {
+			continue
+		}
+		// Keys are only returned when fetching a single domain
+		domain, err := d.client.Domains.Get(d.ctx, listed.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		status := DNSSECStatus{Zone: zone, Keys: []DNSSECKey{}}
+		var records []string
+		for _, key := range domain.Keys {
+			status.Keys = append(status.Keys, DNSSECKey{DNSKey: key.DNSKey, Flags: key.Flags, KeyType: key.KeyType, DS: canonicalDS(key.DS)})
+			records = append(records, key.DS...)
+		}
+		status.DS = canonicalDS(records)
+		for i := range delegations {
+			if delegations[i].Child == zone {
+				status.Delegation = &delegations[i]
+			}
+		}
+		if checkParent {
+			status.ParentDS = d.checkParentDS(zone, status.DS)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// checkParentDS compares the DS records the parent publishes with the expected ones
+func (d *DesecClient) checkParentDS(zone string, expected []string) *ParentDS {
+	ctx, cancel := context.WithTimeout(d.ctx, dsLookupTimeout)
+	defer cancel()
+
+	published, err := d.dsResolver.LookupDS(ctx, zone)
+	if err != nil {
+		return &ParentDS{Published: []string{}, Status: "error", Error: err.Error()}
+	}
+	result := &ParentDS{Published: canonicalDS(published), Status: "ok"}
+	switch {
+	case len(result.Published) == 0:
+		result.Status = "missing"
+	case slices.ContainsFunc(result.Published, func(ds string) bool { return !slices.Contains(expected, ds) }):
+		result.Status = "mismatch"
+	}
+	return result
+}
+
+// dnsDSResolver queries DS records from a recursive DNS server
+type dnsDSResolver struct {
+	address string
+}
+
+// NewDSResolver returns a DS resolver querying the DNS server at address
+// (host:port), or the first nameserver of /etc/resolv.conf when it is empty
+func NewDSResolver(address string) DSResolver {
+	if address == "" {
+		address = systemNameserver()
+	}
+	return &dnsDSResolver{address: address}
+}
+
+// systemNameserver returns the first nameserver of /etc/resolv.conf
+func systemNameserver() string {
+	file, err := os.Open("/etc/resolv.conf")
+	if err == nil {
+		defer func() { _ = file.Close() }()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
+
+func (r *dnsDSResolver) LookupDS(ctx context.Context, zone string) ([]string, error) {
+	name, err := dnsmessage.NewName(canonicalHostname(zone))
+	if err != nil {
+		return nil, err
+	}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(rand.Uint32()), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: dnsTypeDS, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := r.exchange(ctx, "udp", packed)
+	if err == nil && response.Truncated {
+		response, err = r.exchange(ctx, "tcp", packed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query DS of %s from %s: %w", zone, r.address, err)
+	}
+	if response.ID != query.ID {
+		return nil, fmt.Errorf("unexpected response id from %s", r.address)
+	}
+	switch response.RCode {
+	case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+	default:
+		return nil, fmt.Errorf("DS query of %s failed: %s", zone, response.RCode)
+	}
+
+	var records []string
+	for _, answer := range response.Answers {
+		unknown, ok := answer.Body.(*dnsmessage.UnknownResource)
+		if answer.Header.Type != dnsTypeDS || !ok || len(unknown.Data) < 5 {
+			continue
+		}
+		data := unknown.Data
+		records = append(records, fmt.Sprintf("%d %d %d %s", binary.BigEndian.Uint16(data), data[2], data[3], hex.EncodeToString(data[4:])))
+	}
+	return records, nil
+}
+
+// exchange sends a packed query and reads the response, with the two bytes
+// length prefix over TCP
+func (r *dnsDSResolver) exchange(ctx context.Context, network string, packed []byte) (*dnsmessage.Message, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, r.address)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	buf := make([]byte, 65535)
+	var n int
+	if network == "tcp" {
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(packed))), packed...)); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return nil, err
+		}
+		n = int(binary.BigEndian.Uint16(buf))
+		if _, err := io.ReadFull(conn, buf[:n]); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(packed); err != nil {
+			return nil, err
+		}
+		if n, err = conn.Read(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	var response dnsmessage.Message
+	if err := response.Unpack(buf[:n]); err != nil {
+		return nil, fmt.Errorf("invalid DNS response: %w", err)
+	}
+	return &response, nil
+}
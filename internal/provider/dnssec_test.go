@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// staticDSResolver returns fixed DS records per zone
+type staticDSResolver map[string][]string
+
+func (r staticDSResolver) LookupDS(_ context.Context, zone string) ([]string, error) {
+	records, ok := r[zone]
+	if !ok {
+		return nil, errors.New("timeout")
+	}
+	return records, nil
+}
+
+func TestDNSSECStatuses(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com", "team.example.com", "other.org", "unmanaged.net")
+	fake.put("team.example.com", desec.RRSet{SubName: "", Type: "NS", TTL: 3600, Records: []string{"ns1.desec.io."}})
+	fake.setKeys("example.com", []desec.DomainKey{{DNSKey: "257 3 13 AAAA", Flags: 257, KeyType: "csk", DS: []string{"1 13 2 AB", "1 13 4 CD"}}})
+	fake.setKeys("team.example.com", []desec.DomainKey{{DNSKey: "257 3 13 BBBB", Flags: 257, KeyType: "csk", DS: []string{"2 13 2 EF"}}})
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com", "team.example.com", "other.org"}, DefaultTTL: 3600})
+	client.dsResolver = staticDSResolver{
+		"example.com":      {"1 13 2 ab"},
+		"team.example.com": {"9 13 2 ff"},
+	}
+
+	statuses, err := client.DNSSECStatuses(true)
+	if err != nil {
+		t.Fatalf("DNSSECStatuses() error = %v", err)
+	}
+	if len(statuses) != 3 {
+		t.Fatalf("DNSSECStatuses() returned %d zones, want 3", len(statuses))
+	}
+
+	apex := statuses[0]
+	if apex.Zone != "example.com" || !reflect.DeepEqual(apex.DS, []string{"1 13 2 ab", "1 13 4 cd"}) || len(apex.Keys) != 1 || apex.Keys[0].Flags != 257 {
+		t.Errorf("example.com status = %+v", apex)
+	}
+	if apex.Delegation != nil || apex.ParentDS.Status != "ok" {
+		t.Errorf("example.com delegation = %+v, parent DS = %+v, want no delegation and an ok parent DS", apex.Delegation, apex.ParentDS)
+	}
+
+	team := statuses[1]
+	if team.Delegation == nil || team.Delegation.Parent != "example.com" || team.Delegation.InSync {
+		t.Errorf("team.example.com delegation = %+v, want an unsynced delegation in example.com", team.Delegation)
+	}
+	if team.ParentDS.Status != "mismatch" {
+		t.Errorf("team.example.com parent DS = %+v, want a mismatch", team.ParentDS)
+	}
+
+	if other := statuses[2]; other.ParentDS.Status != "error" || other.ParentDS.Error == "" {
+		t.Errorf("other.org parent DS = %+v, want an error", other.ParentDS)
+	}
+
+	// Without the parent check no DS lookup is done
+	statuses, err = client.DNSSECStatuses(false)
+	if err != nil || statuses[0].ParentDS != nil {
+		t.Errorf("DNSSECStatuses(false) = %+v, %v, want no parent DS", statuses, err)
+	}
+}
+
+func TestLookupDS(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	go serveTestDNS(conn, map[dnsmessage.Type]dnsmessage.ResourceBody{
+		dnsTypeDS: &dnsmessage.UnknownResource{Type: dnsTypeDS, Data: []byte{0x09, 0x43, 13, 2, 0x1f, 0x98}},
+	})
+
+	records, err := NewDSResolver(conn.LocalAddr().String()).LookupDS(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("LookupDS() error = %v", err)
+	}
+	if !reflect.DeepEqual(records, []string{"2371 13 2 1f98"}) {
+		t.Errorf("LookupDS() = %v, want [2371 13 2 1f98]", records)
+	}
+}
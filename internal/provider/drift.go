@@ -0,0 +1,229 @@
+package provider
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/metrics"
+	"github.com/nrdcg/desec"
+	log "github.com/sirupsen/logrus"
+)
+
+// Kinds of drift between the last state applied and deSEC
+const (
+	// DriftAdded is an RRset deleted by the webhook that exists again
+	DriftAdded = "added"
+	// DriftRemoved is an RRset written by the webhook that no longer exists
+	DriftRemoved = "removed"
+	// DriftModified is an RRset whose records or TTL changed
+	DriftModified = "modified"
+)
+
+// DriftRRSet is the TTL and records of an RRset
+type DriftRRSet struct {
+	TTL     int      `json:"ttl"`
+	Records []string `json:"records"`
+}
+
+// Drift is an RRset differing from the last state the webhook applied
+type Drift struct {
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Kind    string      `json:"kind"`
+	Desired *DriftRRSet `json:"desired,omitempty"`
+	Actual  *DriftRRSet `json:"actual,omitempty"`
+}
+
+// DriftReport is the result of the last drift check of a zone
+type DriftReport struct {
+	Zone      string    `json:"zone"`
+	CheckedAt time.Time `json:"checkedAt"`
+	// Tracked is the number of RRsets with a known desired state
+	Tracked int     `json:"tracked"`
+	Drifts  []Drift `json:"drifts"`
+	// Healed is set when the drifted RRsets were restored
+	Healed bool   `json:"healed,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// recordDesired remembers the RRsets written to a zone as its desired state.
+// RRsets without records were deleted.
+func (d *DesecClient) recordDesired(domain string, rrsets []desec.RRSet) {
+	zone := normalizeName(domain)
+	d.desiredMu.Lock()
+	defer d.desiredMu.Unlock()
+	if d.desired[zone] == nil {
+		d.desired[zone] = make(map[rrsetKey]desec.RRSet)
+	}
+	for _, rrset := range rrsets {
+		d.desired[zone][rrsetKey{subname: rrset.SubName, recordType: rrset.Type}] = desec.RRSet{
+			SubName: rrset.SubName,
+			Type:    rrset.Type,
+			TTL:     rrset.TTL,
+			Records: driftRecords(rrset.Type, rrset.Records),
+		}
+	}
+}
+
+// recordDeleted remembers the RRsets deleted from a zone
+func (d *DesecClient) recordDeleted(domain string, rrsets []desec.RRSet) {
+	deleted := make([]desec.RRSet, len(rrsets))
+	for i, rrset := range rrsets {
+		deleted[i] = desec.RRSet{SubName: rrset.SubName, Type: rrset.Type}
+	}
+	d.recordDesired(domain, deleted)
+}
+
+// CheckDrift compares every zone the webhook wrote to with its last applied
+// state. Drifts are logged, exported as metrics and restored in auto-heal mode.
+func (d *DesecClient) CheckDrift() []DriftReport {
+	d.desiredMu.Lock()
+	zones := slices.Sorted(maps.Keys(d.desired))
+	d.desiredMu.Unlock()
+
+	reports := make([]DriftReport, 0, len(zones))
+	for _, zone := range zones {
+		report := d.checkZoneDrift(zone)
+		reports = append(reports, report)
+	}
+
+	d.desiredMu.Lock()
+	for _, report := range reports {
+		d.driftReports[report.Zone] = report
+	}
+	d.desiredMu.Unlock()
+	return reports
+}
+
+// DriftReports returns the report of the last drift check of every zone,
+// running a check first when check is set
+func (d *DesecClient) DriftReports(check bool) []DriftReport {
+	if check {
+		return d.CheckDrift()
+	}
+	d.desiredMu.Lock()
+	defer d.desiredMu.Unlock()
+	reports := slices.Collect(maps.Values(d.driftReports))
+	slices.SortFunc(reports, func(a, b DriftReport) int { return cmp.Compare(a.Zone, b.Zone) })
+	return reports
+}
+
+// checkZoneDrift compares the RRsets of a zone with their last applied state
+func (d *DesecClient) checkZoneDrift(zone string) DriftReport {
+	report := DriftReport{Zone: zone, CheckedAt: time.Now(), Drifts: []Drift{}}
+
+	// Applies wait for the check and the heal, so the desired state stays the
+	// one the records are compared with
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+
+	d.desiredMu.Lock()
+	desired := maps.Clone(d.desired[zone])
+	d.desiredMu.Unlock()
+	report.Tracked = len(desired)
+
+	rrsets, err := d.GetRecords(zone)
+	if err != nil {
+		log.Errorf("failed to check drift of zone %s: %v", zone, err)
+		report.Error = err.Error()
+		metrics.DriftChecks.WithLabelValues(zone, "error").Inc()
+		return report
+	}
+	actual := make(map[rrsetKey]desec.RRSet, len(rrsets))
+	for _, rrset := range rrsets {
+		actual[rrsetKey{subname: rrset.SubName, recordType: rrset.Type}] = rrset
+	}
+
+	var toHeal []desec.RRSet
+	counts := map[string]int{DriftAdded: 0, DriftRemoved: 0, DriftModified: 0}
+	for _, key := range slices.SortedFunc(maps.Keys(desired), compareRRSetKeys) {
+		want := desired[key]
+		drift := Drift{Name: zone, Type: key.recordType}
+		if key.subname != "" {
+			drift.Name = key.subname + "." + zone
+		}
+		live, exists := actual[key]
+		switch {
+		case len(want.Records) == 0 && !exists:
+			continue
+		case len(want.Records) == 0:
+			drift.Kind = DriftAdded
+		case !exists:
+			drift.Kind = DriftRemoved
+		case live.TTL != want.TTL || !slices.Equal(driftRecords(live.Type, live.Records), want.Records):
+			drift.Kind = DriftModified
+		default:
+			continue
+		}
+		if len(want.Records) > 0 {
+			drift.Desired = &DriftRRSet{TTL: want.TTL, Records: want.Records}
+		}
+		if exists {
+			drift.Actual = &DriftRRSet{TTL: live.TTL, Records: driftRecords(live.Type, live.Records)}
+		}
+		log.Warnf("drift in zone %s: %s/%s was %s outside of the webhook", zone, drift.Name, drift.Type, drift.Kind)
+		report.Drifts = append(report.Drifts, drift)
+		counts[drift.Kind]++
+		// Sending an RRset without records deletes it
+		toHeal = append(toHeal, desec.RRSet{SubName: want.SubName, Type: want.Type, TTL: want.TTL, Records: append([]string{}, want.Records...)})
+	}
+
+	for kind, count := range counts {
+		metrics.DriftRRsets.WithLabelValues(zone, kind).Set(float64(count))
+	}
+	if len(report.Drifts) == 0 {
+		metrics.DriftChecks.WithLabelValues(zone, "ok").Inc()
+		return report
+	}
+	metrics.DriftChecks.WithLabelValues(zone, "drift").Inc()
+
+	if d.driftAutoHeal {
+		if err := d.healDrift(zone, toHeal); err != nil {
+			log.Errorf("failed to heal drift of zone %s: %v, payload: %v", zone, err, toHeal)
+			report.Error = err.Error()
+		} else {
+			report.Healed = !d.dryRun
+		}
+	}
+	return report
+}
+
+// healDrift restores drifted RRsets to their last applied state
+func (d *DesecClient) healDrift(zone string, rrsets []desec.RRSet) error {
+	if d.dryRun {
+		log.Infof("dryrun: would restore %d drifted RRsets of zone %s: %v", len(rrsets), zone, rrsets)
+		return nil
+	}
+	log.Infof("restoring %d drifted RRsets of zone %s: %v", len(rrsets), zone, rrsets)
+	err := d.writeChunks(zone, "restore", rrsets, nil, func(chunk []desec.RRSet) error {
+		return d.bulkUpdate(zone, chunk)
+	})
+	if err != nil {
+		return err
+	}
+	metrics.DriftHealed.WithLabelValues(zone).Add(float64(len(rrsets)))
+	return nil
+}
+
+// driftRecords returns the canonical records of an RRset, sorted
+func driftRecords(recordType string, records []string) []string {
+	return slices.Sorted(slices.Values(canonicalTargets(recordType, records)))
+}
+
+// RunDriftCheck checks the zones for drift every interval until the context
+// is done
+func (d *DesecClient) RunDriftCheck(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.CheckDrift()
+		}
+	}
+}
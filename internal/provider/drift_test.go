@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestCheckDrift(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	fake.put("example.com", desec.RRSet{SubName: "old", Type: "A", TTL: 3600, Records: []string{"192.0.2.3"}})
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600, DriftAutoHeal: true})
+
+	err := client.ApplyChanges(plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+			{DNSName: "api.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.2"}},
+			{DNSName: "same.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.4"}},
+		},
+		Delete: []*endpoint.Endpoint{
+			{DNSName: "old.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.3"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	// Edits made outside of the webhook
+	fake.put("example.com", desec.RRSet{SubName: "www", Type: "A", TTL: 3600, Records: []string{"192.0.2.9"}})
+	fake.put("example.com", desec.RRSet{SubName: "old", Type: "A", TTL: 3600, Records: []string{"192.0.2.3"}})
+	fake.mu.Lock()
+	delete(fake.rrsets["example.com"], rrsetKey{"api", "A"})
+	fake.mu.Unlock()
+
+	reports := client.CheckDrift()
+	if len(reports) != 1 {
+		t.Fatalf("CheckDrift() = %+v, want one report", reports)
+	}
+	report := reports[0]
+	if report.Zone != "example.com" || report.Tracked != 4 || !report.Healed {
+		t.Errorf("CheckDrift() report = %+v", report)
+	}
+	kinds := make(map[string]string)
+	for _, drift := range report.Drifts {
+		kinds[drift.Name] = drift.Kind
+	}
+	expected := map[string]string{"api.example.com": DriftRemoved, "old.example.com": DriftAdded, "www.example.com": DriftModified}
+	if len(kinds) != len(expected) {
+		t.Errorf("CheckDrift() drifts = %v, want %v", kinds, expected)
+	}
+	for name, kind := range expected {
+		if kinds[name] != kind {
+			t.Errorf("CheckDrift() drift of %s = %q, want %q", name, kinds[name], kind)
+		}
+	}
+
+	// Auto-heal restored the applied state
+	if rrset, ok := fake.get("example.com", "www", "A"); !ok || rrset.Records[0] != "192.0.2.1" {
+		t.Errorf("www.example.com was not restored: %v", rrset)
+	}
+	if _, ok := fake.get("example.com", "api", "A"); !ok {
+		t.Error("api.example.com was not restored")
+	}
+	if _, ok := fake.get("example.com", "old", "A"); ok {
+		t.Error("old.example.com was not deleted again")
+	}
+	if reports := client.CheckDrift(); len(reports[0].Drifts) != 0 {
+		t.Errorf("CheckDrift() after healing = %+v, want no drift", reports[0].Drifts)
+	}
+	if reports := client.DriftReports(false); len(reports) != 1 || len(reports[0].Drifts) != 0 {
+		t.Errorf("DriftReports() = %+v, want the last report", reports)
+	}
+}
+
+func TestCheckDriftWaitsForApply(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600, DriftAutoHeal: true})
+	www := &endpoint.Endpoint{DNSName: "www.example.com", RecordType: "A", RecordTTL: 3600, Targets: endpoint.Targets{"192.0.2.1"}}
+	if err := client.ApplyChanges(plan.Changes{Create: []*endpoint.Endpoint{www}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	// A check starting while the update is written must not see it as drift
+	reports := make(chan []DriftReport, 1)
+	started := false
+	fake.failWith(func(r *http.Request) int {
+		if r.Method == http.MethodPut && !started {
+			started = true
+			go func() { reports <- client.CheckDrift() }()
+		}
+		return 0
+	})
+	updated := &endpoint.Endpoint{DNSName: "www.example.com", RecordType: "A", RecordTTL: 3600, Targets: endpoint.Targets{"192.0.2.2"}}
+	if err := client.ApplyChanges(plan.Changes{UpdateOld: []*endpoint.Endpoint{www}, UpdateNew: []*endpoint.Endpoint{updated}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	report := (<-reports)[0]
+	if len(report.Drifts) != 0 || report.Healed {
+		t.Errorf("CheckDrift() during an apply = %+v, want no drift", report)
+	}
+	if rrset, _ := fake.get("example.com", "www", "A"); !reflect.DeepEqual(rrset.Records, []string{"192.0.2.2"}) {
+		t.Errorf("www/A = %v, want the applied [192.0.2.2]", rrset.Records)
+	}
+}
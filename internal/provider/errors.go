@@ -0,0 +1,256 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nrdcg/desec"
+)
+
+// Kinds of failed deSEC requests, matched with errors.Is
+var (
+	// ErrThrottled is a request refused by the deSEC rate limits
+	ErrThrottled = errors.New("throttled by deSEC")
+	// ErrUnauthorized is a request refused for an invalid or revoked token,
+	// or a token not allowed to make it
+	ErrUnauthorized = errors.New("unauthorized by deSEC")
+	// ErrInvalid is a request deSEC refused as invalid, like records it
+	// doesn't accept
+	ErrInvalid = errors.New("rejected by deSEC")
+	// ErrConflict is a change conflicting with the current state of deSEC
+	ErrConflict = errors.New("conflict with deSEC")
+	// ErrNotFound is a domain or RRset missing from deSEC
+	ErrNotFound = errors.New("not found in deSEC")
+	// ErrUnavailable is a request deSEC failed to answer
+	ErrUnavailable = errors.New("deSEC is unavailable")
+)
+
+// RequestError is a failed deSEC request
+type RequestError struct {
+	// Kind is one of the Err kinds of failed requests
+	Kind       error
+	StatusCode int
+	// RetryAfter is the delay deSEC asked to wait before retrying, if any
+	RetryAfter time.Duration
+	// Messages are the error messages of deSEC
+	Messages []string
+	Err      error
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// requestError classifies an error of a deSEC request. Errors not coming from
+// a request are returned as is.
+func requestError(err error) error {
+	var requestErr *RequestError
+	if err == nil || errors.As(err, &requestErr) || errors.Is(err, ErrConflict) || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	requestErr = &RequestError{Err: err}
+	var respErr *responseError
+	var apiErr *desec.APIError
+	var urlErr *url.Error
+	switch {
+	case errors.As(err, &respErr):
+		requestErr.StatusCode = respErr.StatusCode
+		requestErr.RetryAfter = respErr.RetryAfter
+	case errors.As(err, &apiErr):
+		requestErr.StatusCode = apiErr.StatusCode
+	case errors.As(err, &urlErr):
+		// No response came back
+	default:
+		return err
+	}
+	if messages, ok := rrsetErrorMessages(err); ok {
+		requestErr.Messages = slices.Concat(messages...)
+	}
+
+	switch status := requestErr.StatusCode; {
+	case status == http.StatusTooManyRequests:
+		requestErr.Kind = ErrThrottled
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		requestErr.Kind = ErrUnauthorized
+	case status == http.StatusNotFound:
+		requestErr.Kind = ErrNotFound
+	case status == http.StatusConflict || status == http.StatusPreconditionFailed:
+		requestErr.Kind = ErrConflict
+	case status >= http.StatusBadRequest && status < http.StatusInternalServerError:
+		requestErr.Kind = ErrInvalid
+	default:
+		requestErr.Kind = ErrUnavailable
+	}
+	return requestErr
+}
+
+// responseError is a throttled or failed response of deSEC. The retrying
+// client drops these responses once out of retries, their status and
+// Retry-After delay are kept by returning them as errors instead.
+type responseError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Body       []byte
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// statusTransport turns throttled and failed responses into responseErrors
+type statusTransport struct {
+	next http.RoundTripper
+}
+
+func (t statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < http.StatusInternalServerError) {
+		return resp, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return nil, &responseError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: retryAfter(resp.Header.Get("Retry-After"), body),
+		Body:       body,
+	}
+}
+
+// throttledDelay matches the delay in the message of throttled requests, like
+// "Request was throttled. Expected available in 5 seconds."
+var throttledDelay = regexp.MustCompile(`available in (\d+) seconds?`)
+
+// retryAfter returns the delay of a Retry-After header, in seconds or as a
+// date, or else the one in the message of a throttled request
+func retryAfter(header string, body []byte) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return max(time.Until(date), 0)
+	}
+	if match := throttledDelay.FindSubmatch(body); match != nil {
+		seconds, _ := strconv.Atoi(string(match[1]))
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
+
+// newAPIClient returns a deSEC client retrying failed requests retryMax times
+func newAPIClient(token string, retryMax int) *desec.Client {
+	return desec.New(token, desec.ClientOptions{
+		RetryMax:   retryMax,
+		HTTPClient: &http.Client{Transport: statusTransport{next: http.DefaultTransport}},
+	})
+}
+
+// existsMessages are the deSEC validation messages of an RRset created while
+// another one with the same name and type exists
+var existsMessages = []string{"same subdomain and type exists", "already exists"}
+
+// apiErrorBody returns the status and the JSON body of a deSEC error response
+func apiErrorBody(err error) (int, []byte, bool) {
+	var respErr *responseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode, respErr.Body, true
+	}
+	var apiErr *desec.APIError
+	if !errors.As(err, &apiErr) || apiErr.Unwrap() == nil {
+		return 0, nil, false
+	}
+	// The client wraps raw error bodies as "body: <body>"
+	body, ok := strings.CutPrefix(apiErr.Unwrap().Error(), "body: ")
+	return apiErr.StatusCode, []byte(body), ok
+}
+
+// rrsetErrorMessages returns the messages of a failed bulk request, by RRset.
+// deSEC answers with a list holding the errors of every RRset sent, empty for
+// the valid ones, or with a single object for the whole request, returned as
+// the messages of its only RRset.
+func rrsetErrorMessages(err error) ([][]string, bool) {
+	_, body, ok := apiErrorBody(err)
+	if !ok {
+		return nil, false
+	}
+	var list []any
+	if json.Unmarshal(body, &list) == nil {
+		messages := make([][]string, len(list))
+		for i, item := range list {
+			messages[i] = errorStrings(item)
+		}
+		return messages, true
+	}
+	var object map[string]any
+	if json.Unmarshal(body, &object) == nil {
+		return [][]string{errorStrings(object)}, true
+	}
+	return nil, false
+}
+
+// errorStrings collects the messages of a deSEC error object, whose fields
+// hold a message, a list of messages or nested objects
+func errorStrings(value any) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		var messages []string
+		for _, item := range value {
+			messages = append(messages, errorStrings(item)...)
+		}
+		return messages
+	case map[string]any:
+		var messages []string
+		for _, key := range slices.Sorted(maps.Keys(value)) {
+			messages = append(messages, errorStrings(value[key])...)
+		}
+		return messages
+	default:
+		return nil
+	}
+}
+
+// collidingRRSets returns the RRsets a bulk creation failed on because they
+// already exist. It returns nil when any RRset failed for another reason, or
+// when the errors can't be matched with the RRsets sent.
+func collidingRRSets(err error, rrsets []desec.RRSet) []desec.RRSet {
+	messages, ok := rrsetErrorMessages(err)
+	if !ok || len(messages) != len(rrsets) {
+		return nil
+	}
+	var colliding []desec.RRSet
+	for i, rrsetMessages := range messages {
+		if len(rrsetMessages) == 0 {
+			continue
+		}
+		for _, message := range rrsetMessages {
+			if !isExistsMessage(message) {
+				return nil
+			}
+		}
+		colliding = append(colliding, rrsets[i])
+	}
+	return colliding
+}
+
+// isExistsMessage reports whether a message rejects an RRset that exists
+func isExistsMessage(message string) bool {
+	message = strings.ToLower(message)
+	return slices.ContainsFunc(existsMessages, func(exists string) bool { return strings.Contains(message, exists) })
+}
@@ -0,0 +1,169 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestCollidingRRSets(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	fake.put("example.com", desec.RRSet{SubName: "www", Type: "A", TTL: 3600, Records: []string{"192.0.2.1"}})
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}})
+
+	rrsets := []desec.RRSet{
+		{SubName: "api", Type: "A", TTL: 3600, Records: []string{"192.0.2.2"}},
+		{SubName: "www", Type: "A", TTL: 3600, Records: []string{"192.0.2.3"}},
+	}
+	_, err := client.client.Records.BulkCreate(context.Background(), "example.com", rrsets)
+	if err == nil {
+		t.Fatal("BulkCreate() expected error but got none")
+	}
+	if colliding := collidingRRSets(err, rrsets); !reflect.DeepEqual(colliding, rrsets[1:]) {
+		t.Errorf("collidingRRSets() = %v, want %v", colliding, rrsets[1:])
+	}
+
+	// Other validation errors are not collisions
+	fake.failWith(func(r *http.Request) int { return http.StatusBadRequest })
+	_, err = client.client.Records.BulkCreate(context.Background(), "example.com", rrsets[:1])
+	if err == nil {
+		t.Fatal("BulkCreate() expected error but got none")
+	}
+	if messages, ok := rrsetErrorMessages(err); !ok || !reflect.DeepEqual(messages, [][]string{{"Bad Request"}}) {
+		t.Errorf("rrsetErrorMessages() = %v, %v, want [[Bad Request]]", messages, ok)
+	}
+	if colliding := collidingRRSets(err, rrsets[:1]); colliding != nil {
+		t.Errorf("collidingRRSets() = %v, want none", colliding)
+	}
+}
+
+func TestApplyChangesCreatesExistingRRSets(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	fake.put("example.com", desec.RRSet{SubName: "www", Type: "A", TTL: 3600, Records: []string{"192.0.2.1"}})
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600})
+
+	err := client.ApplyChanges(plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "www.example.com", RecordType: "A", RecordTTL: 3600, Targets: endpoint.Targets{"192.0.2.3"}},
+		{DNSName: "api.example.com", RecordType: "A", RecordTTL: 3600, Targets: endpoint.Targets{"192.0.2.2"}},
+	}})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	for subname, want := range map[string]string{"www": "192.0.2.3", "api": "192.0.2.2"} {
+		if rrset, ok := fake.get("example.com", subname, "A"); !ok || !reflect.DeepEqual(rrset.Records, []string{want}) {
+			t.Errorf("%s/A = %v, %v, want [%s]", subname, rrset.Records, ok, want)
+		}
+	}
+}
+
+func TestApplyChangesDeletesAbsentRRSets(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	fake.put("example.com", desec.RRSet{SubName: "api", Type: "A", TTL: 3600, Records: []string{"192.0.2.2"}})
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600})
+
+	// The deletion is rejected once as www/A is gone
+	rejected := false
+	fake.failWith(func(r *http.Request) int {
+		if r.Method == http.MethodPut && !rejected {
+			rejected = true
+			return http.StatusBadRequest
+		}
+		return 0
+	})
+	err := client.ApplyChanges(plan.Changes{Delete: []*endpoint.Endpoint{
+		{DNSName: "www.example.com", RecordType: "A", RecordTTL: 3600, Targets: endpoint.Targets{"192.0.2.1"}},
+		{DNSName: "api.example.com", RecordType: "A", RecordTTL: 3600, Targets: endpoint.Targets{"192.0.2.2"}},
+	}})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if _, ok := fake.get("example.com", "api", "A"); ok {
+		t.Error("api/A still exists")
+	}
+	if puts := fake.count(http.MethodPut); puts != 2 {
+		t.Errorf("ApplyChanges() sent %d deletions, want 2", puts)
+	}
+
+	// Deleting only absent RRsets succeeds
+	rejected = false
+	if err := client.ApplyChanges(plan.Changes{Delete: []*endpoint.Endpoint{
+		{DNSName: "www.example.com", RecordType: "A", RecordTTL: 3600, Targets: endpoint.Targets{"192.0.2.1"}},
+	}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+}
+
+func TestRequestError(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600})
+
+	for status, kind := range map[int]error{
+		http.StatusTooManyRequests:    ErrThrottled,
+		http.StatusServiceUnavailable: ErrUnavailable,
+		http.StatusUnauthorized:       ErrUnauthorized,
+		http.StatusForbidden:          ErrUnauthorized,
+		http.StatusConflict:           ErrConflict,
+	} {
+		fake.failWith(func(r *http.Request) int { return status })
+		_, err := client.GetEndpoints("example.com")
+		var requestErr *RequestError
+		if !errors.As(err, &requestErr) || !errors.Is(err, kind) || requestErr.StatusCode != status {
+			t.Errorf("GetEndpoints() with status %d error = %v, want %v", status, err, kind)
+		}
+	}
+	fake.failWith(nil)
+
+	if _, err := client.GetEndpoints("example.org"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetEndpoints() of a missing domain error = %v, want %v", err, ErrNotFound)
+	}
+
+	fake.failWith(func(r *http.Request) int {
+		if r.Method == http.MethodPost {
+			return http.StatusBadRequest
+		}
+		return 0
+	})
+	err := client.ApplyChanges(plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "www.example.com", RecordType: "A", RecordTTL: 3600, Targets: endpoint.Targets{"192.0.2.1"}},
+	}})
+	var requestErr *RequestError
+	if !errors.As(err, &requestErr) || !errors.Is(err, ErrInvalid) || !reflect.DeepEqual(requestErr.Messages, []string{"Bad Request"}) {
+		t.Errorf("ApplyChanges() error = %v, want %v with the deSEC messages", err, ErrInvalid)
+	}
+
+	conflict := &ConflictError{}
+	if err := requestError(conflict); err != conflict || !errors.Is(err, ErrConflict) {
+		t.Errorf("requestError() of a conflict = %v, want it unchanged", err)
+	}
+	other := errors.New("failed to resolve alias target")
+	if err := requestError(other); err != other {
+		t.Errorf("requestError() of another error = %v, want it unchanged", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header   string
+		body     string
+		expected time.Duration
+	}{
+		{header: "3", expected: 3 * time.Second},
+		{body: `{"detail": "Request was throttled. Expected available in 12 seconds."}`, expected: 12 * time.Second},
+		{header: "invalid", body: `{"detail": "Request was throttled. Expected available in 1 second."}`, expected: time.Second},
+		{header: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), expected: 0},
+		{expected: 0},
+	}
+	for _, tt := range tests {
+		if delay := retryAfter(tt.header, []byte(tt.body)); delay != tt.expected {
+			t.Errorf("retryAfter(%q, %q) = %v, want %v", tt.header, tt.body, delay, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package provider
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+)
+
+// fakeDesec is an in-memory deSEC API serving the domain and RRset endpoints
+// used by the provider
+type fakeDesec struct {
+	mu       sync.Mutex
+	domains  []desec.Domain
+	rrsets   map[string]map[rrsetKey]desec.RRSet
+	requests []string
+	// fail returns the status failing a request, or 0 to serve it
+	fail func(r *http.Request) int
+}
+
+func newFakeDesec(t *testing.T, domains ...string) (*fakeDesec, *httptest.Server) {
+	t.Helper()
+	fake := &fakeDesec{rrsets: make(map[string]map[rrsetKey]desec.RRSet)}
+	for _, domain := range domains {
+		fake.domains = append(fake.domains, desec.Domain{Name: domain, MinimumTTL: minimumTTL})
+		fake.rrsets[domain] = make(map[rrsetKey]desec.RRSet)
+	}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return fake, srv
+}
+
+// newTestClient creates a client talking to the given fake deSEC server
+func newTestClient(t *testing.T, srv *httptest.Server, cfg config.Config) *DesecClient {
+	t.Helper()
+	if cfg.APIToken == "" {
+		cfg.APIToken = "test-token"
+	}
+	client, err := CreateDesecClient(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	// Retries are left to the tests
+	client.client = newAPIClient(cfg.APIToken, 0)
+	client.client.BaseURL = srv.URL + "/"
+	client.writer.BaseURL = srv.URL + "/"
+	return client
+}
+
+// put stores an RRset as if it had been created through the API
+func (f *fakeDesec) put(domain string, rrset desec.RRSet) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rrset.Domain = domain
+	f.rrsets[domain][rrsetKey{subname: rrset.SubName, recordType: rrset.Type}] = rrset
+}
+
+// remove deletes a stored RRset as if it had been deleted outside the webhook
+func (f *fakeDesec) remove(domain, subname, recordType string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.rrsets[domain], rrsetKey{subname: subname, recordType: recordType})
+}
+
+// setKeys sets the DNSSEC keys of a domain
+func (f *fakeDesec) setKeys(domain string, keys []desec.DomainKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.domains {
+		if f.domains[i].Name == domain {
+			f.domains[i].Keys = keys
+		}
+	}
+}
+
+// setMinimumTTL sets the minimum TTL of a domain
+func (f *fakeDesec) setMinimumTTL(domain string, ttl int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.domains {
+		if f.domains[i].Name == domain {
+			f.domains[i].MinimumTTL = ttl
+		}
+	}
+}
+
+// writes returns the number of requests that modified RRsets
+func (f *fakeDesec) writes() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	writes := 0
+	for _, request := range f.requests {
+		if !strings.HasPrefix(request, http.MethodGet+" ") {
+			writes++
+		}
+	}
+	return writes
+}
+
+// failWith sets the function failing requests, nil serves every request
+func (f *fakeDesec) failWith(fail func(r *http.Request) int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = fail
+}
+
+// count returns the number of requests with the given method
+func (f *fakeDesec) count(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.countLocked(method)
+}
+
+// countLocked is count for callers holding the lock, like fail
+func (f *fakeDesec) countLocked(method string) int {
+	count := 0
+	for _, request := range f.requests {
+		if strings.HasPrefix(request, method+" ") {
+			count++
+		}
+	}
+	return count
+}
+
+// get returns a stored RRset
+func (f *fakeDesec) get(domain, subname, recordType string) (desec.RRSet, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rrset, ok := f.rrsets[domain][rrsetKey{subname: subname, recordType: recordType}]
+	return rrset, ok
+}
+
+func (f *fakeDesec) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	if f.fail != nil {
+		if status := f.fail(r); status != 0 {
+			w.Header().Set("Retry-After", "0")
+			writeFakeJSON(w, status, map[string]string{"detail": http.StatusText(status)})
+			return
+		}
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "domains" && r.Method == http.MethodGet:
+		writeFakeJSON(w, http.StatusOK, f.domains)
+	case len(parts) == 2 && parts[0] == "domains" && r.Method == http.MethodGet:
+		for _, domain := range f.domains {
+			if domain.Name == parts[1] {
+				writeFakeJSON(w, http.StatusOK, domain)
+				return
+			}
+		}
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+	case len(parts) == 3 && parts[0] == "domains" && parts[2] == "rrsets":
+		f.serveRRSets(w, r, parts[1])
+	case len(parts) == 5 && parts[0] == "domains" && parts[2] == "rrsets" && r.Method == http.MethodGet:
+		subname := parts[3]
+		if subname == desec.ApexZone {
+			subname = ""
+		}
+		if rrset, ok := f.rrsets[parts[1]][rrsetKey{subname, parts[4]}]; ok {
+			writeFakeJSON(w, http.StatusOK, rrset)
+			return
+		}
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+	default:
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+	}
+}
+
+func (f *fakeDesec) serveRRSets(w http.ResponseWriter, r *http.Request, domain string) {
+	zone, ok := f.rrsets[domain]
+	if !ok {
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"detail": "Not found."})
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		rrsets := make([]desec.RRSet, 0, len(zone))
+		for _, rrset := range zone {
+			if recordType := r.URL.Query().Get("type"); recordType != "" && rrset.Type != recordType {
+				continue
+			}
+			if query := r.URL.Query(); query.Has("subname") && rrset.SubName != query.Get("subname") {
+				continue
+			}
+			rrsets = append(rrsets, rrset)
+		}
+		slices.SortFunc(rrsets, func(a, b desec.RRSet) int {
+			return compareRRSetKeys(rrsetKey{a.SubName, a.Type}, rrsetKey{b.SubName, b.Type})
+		})
+		writeFakeJSON(w, http.StatusOK, rrsets)
+		return
+	}
+
+	var rrsets []desec.RRSet
+	if err := json.NewDecoder(r.Body).Decode(&rrsets); err != nil {
+		writeFakeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		// Errors are listed by RRset, empty for the valid ones
+		rrsetErrors := make([]map[string][]string, len(rrsets))
+		failed := false
+		for i, rrset := range rrsets {
+			rrsetErrors[i] = map[string][]string{}
+			if _, exists := zone[rrsetKey{rrset.SubName, rrset.Type}]; exists {
+				rrsetErrors[i]["non_field_errors"] = []string{"Another RRset with the same subdomain and type exists for this domain."}
+				failed = true
+			}
+		}
+		if failed {
+			writeFakeJSON(w, http.StatusBadRequest, rrsetErrors)
+			return
+		}
+		updated := maps.Clone(zone)
+		for _, rrset := range rrsets {
+			rrset.Domain = domain
+			updated[rrsetKey{rrset.SubName, rrset.Type}] = rrset
+		}
+		if !f.commit(w, domain, updated) {
+			return
+		}
+		writeFakeJSON(w, http.StatusCreated, rrsets)
+	case http.MethodPut, http.MethodPatch:
+		updated := maps.Clone(zone)
+		for _, rrset := range rrsets {
+			key := rrsetKey{rrset.SubName, rrset.Type}
+			if len(rrset.Records) == 0 {
+				delete(updated, key)
+				continue
+			}
+			if r.Method == http.MethodPatch && rrset.TTL == 0 {
+				rrset.TTL = zone[key].TTL
+			}
+			rrset.Domain = domain
+			updated[key] = rrset
+		}
+		if !f.commit(w, domain, updated) {
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, rrsets)
+	default:
+		writeFakeJSON(w, http.StatusMethodNotAllowed, map[string]string{"detail": "Method not allowed."})
+	}
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// commit stores the RRsets of a zone written by a bulk request, which deSEC
+// applies atomically, unless a CNAME shares its name with another RRset
+func (f *fakeDesec) commit(w http.ResponseWriter, domain string, zone map[rrsetKey]desec.RRSet) bool {
+	for key := range zone {
+		for other := range zone {
+			if key.subname == other.subname && key.recordType == "CNAME" && other.recordType != "CNAME" {
+				writeFakeJSON(w, http.StatusBadRequest, []map[string][]string{{
+					"non_field_errors": {"RRset with conflicting type present: " + other.recordType + ". (No other RRsets are allowed alongside CNAME.)"},
+				}})
+				return false
+			}
+		}
+	}
+	f.rrsets[domain] = zone
+	return true
+}
@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// DiffZone computes the changes turning the records of a managed zone into the
+// desired endpoints, adjusted like the ones of external-dns. Endpoints of other
+// zones are skipped. With prune, the records missing from the desired
+// endpoints are deleted. The apex NS records maintained by deSEC are never
+// changed. Changes are sorted by name, type and set identifier.
+func (d *DesecClient) DiffZone(zone string, desired []*endpoint.Endpoint, prune bool) (plan.Changes, error) {
+	zone = normalizeName(zone)
+	if !slices.Contains(d.ManagedZones(), zone) {
+		return plan.Changes{}, fmt.Errorf("%w: %s", ErrZoneNotManaged, zone)
+	}
+
+	var inZone []*endpoint.Endpoint
+	for _, ep := range desired {
+		if findMatchingDomain(ep.DNSName, d.domainFilters) != zone {
+			log.Warnf("skipping %s/%s outside of zone %s", ep.DNSName, ep.RecordType, zone)
+			continue
+		}
+		inZone = append(inZone, ep)
+	}
+	if err := ValidateEndpoints(inZone); err != nil {
+		return plan.Changes{}, err
+	}
+
+	// Reading the zone first loads its minimum TTL used by AdjustEndpoints
+	current, err := d.GetEndpoints(zone)
+	if err != nil {
+		return plan.Changes{}, err
+	}
+	adjusted, err := d.AdjustEndpoints(inZone)
+	if err != nil {
+		return plan.Changes{}, err
+	}
+
+	isApexNS := func(ep *endpoint.Endpoint) bool {
+		return ep.RecordType == endpoint.RecordTypeNS && normalizeName(ep.DNSName) == zone
+	}
+	existing := make(map[string]*endpoint.Endpoint, len(current))
+	for _, ep := range current {
+		if !isApexNS(ep) {
+			existing[endpointKey(ep)] = ep
+		}
+	}
+
+	var changes plan.Changes
+	seen := make(map[string]bool, len(adjusted))
+	for _, ep := range adjusted {
+		key := endpointKey(ep)
+		if seen[key] {
+			return plan.Changes{}, fmt.Errorf("duplicate endpoint %s/%s", ep.DNSName, ep.RecordType)
+		}
+		seen[key] = true
+		if isApexNS(ep) {
+			log.Infof("skipping apex NS records of %s maintained by deSEC", zone)
+			continue
+		}
+
+		previous, ok := existing[key]
+		switch {
+		case !ok:
+			changes.Create = append(changes.Create, ep)
+		case previous.RecordTTL != ep.RecordTTL || !slices.Equal(slices.Sorted(slices.Values(previous.Targets)), slices.Sorted(slices.Values(ep.Targets))):
+			changes.UpdateOld = append(changes.UpdateOld, previous)
+			changes.UpdateNew = append(changes.UpdateNew, ep)
+		}
+	}
+	if prune {
+		for key, ep := range existing {
+			if !seen[key] {
+				changes.Delete = append(changes.Delete, ep)
+			}
+		}
+	}
+
+	sortChanges(&changes)
+	return changes, nil
+}
+
+// sortChanges sorts every list of changes by name, type and set identifier,
+// the updates by pairs of old and new endpoints
+func sortChanges(changes *plan.Changes) {
+	byKey := func(a, b *endpoint.Endpoint) int {
+		return cmp.Compare(endpointKey(a), endpointKey(b))
+	}
+	slices.SortFunc(changes.Create, byKey)
+	slices.SortFunc(changes.Delete, byKey)
+
+	// Updates are sorted as pairs, so every old endpoint stays next to its new one
+	if len(changes.UpdateOld) != len(changes.UpdateNew) {
+		return
+	}
+	order := make([]int, len(changes.UpdateNew))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Or(byKey(changes.UpdateNew[a], changes.UpdateNew[b]), byKey(changes.UpdateOld[a], changes.UpdateOld[b]))
+	})
+	updateOld := make([]*endpoint.Endpoint, len(order))
+	updateNew := make([]*endpoint.Endpoint, len(order))
+	for i, j := range order {
+		updateOld[i], updateNew[i] = changes.UpdateOld[j], changes.UpdateNew[j]
+	}
+	changes.UpdateOld, changes.UpdateNew = updateOld, updateNew
+}
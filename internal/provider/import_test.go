@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestDiffZone(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	fake.put("example.com", desec.RRSet{SubName: "", Type: "NS", TTL: 3600, Records: []string{"ns1.desec.io.", "ns2.desec.org."}})
+	fake.put("example.com", desec.RRSet{SubName: "same", Type: "A", TTL: 3600, Records: []string{"192.0.2.2", "192.0.2.1"}})
+	fake.put("example.com", desec.RRSet{SubName: "changed", Type: "A", TTL: 3600, Records: []string{"192.0.2.1"}})
+	fake.put("example.com", desec.RRSet{SubName: "extra", Type: "A", TTL: 3600, Records: []string{"192.0.2.1"}})
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600})
+
+	desired := []*endpoint.Endpoint{
+		{DNSName: "new.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.3"}},
+		{DNSName: "same.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1", "192.0.2.2"}, RecordTTL: 3600},
+		{DNSName: "changed.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 7200},
+		{DNSName: "example.com", RecordType: "NS", Targets: endpoint.Targets{"ns1.example.net"}},
+		{DNSName: "www.example.org", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+	}
+
+	changes, err := client.DiffZone("example.com", desired, false)
+	if err != nil {
+		t.Fatalf("DiffZone() error = %v", err)
+	}
+	names := func(endpoints []*endpoint.Endpoint) []string {
+		var result []string
+		for _, ep := range endpoints {
+			result = append(result, normalizeName(ep.DNSName))
+		}
+		return result
+	}
+	if created := names(changes.Create); !reflect.DeepEqual(created, []string{"new.example.com"}) {
+		t.Errorf("DiffZone() Create = %v", created)
+	}
+	if updated := names(changes.UpdateNew); !reflect.DeepEqual(updated, []string{"changed.example.com"}) {
+		t.Errorf("DiffZone() UpdateNew = %v", updated)
+	}
+	if changes.UpdateOld[0].RecordTTL != 3600 || changes.UpdateNew[0].RecordTTL != 7200 {
+		t.Errorf("DiffZone() update TTL %d -> %d, want 3600 -> 7200", changes.UpdateOld[0].RecordTTL, changes.UpdateNew[0].RecordTTL)
+	}
+	if len(changes.Delete) != 0 {
+		t.Errorf("DiffZone() without prune Delete = %v", names(changes.Delete))
+	}
+
+	changes, err = client.DiffZone("example.com", desired, true)
+	if err != nil {
+		t.Fatalf("DiffZone() error = %v", err)
+	}
+	if deleted := names(changes.Delete); !reflect.DeepEqual(deleted, []string{"extra.example.com"}) {
+		t.Errorf("DiffZone() with prune Delete = %v, want only extra.example.com", deleted)
+	}
+
+	if _, err := client.DiffZone("example.org", desired, false); !errors.Is(err, ErrZoneNotManaged) {
+		t.Errorf("DiffZone() of an unmanaged zone error = %v, want %v", err, ErrZoneNotManaged)
+	}
+	duplicate := []*endpoint.Endpoint{desired[0], desired[0]}
+	if _, err := client.DiffZone("example.com", duplicate, false); err == nil {
+		t.Error("DiffZone() with duplicate endpoints expected error but got none")
+	}
+}
+
+func TestSortChangesKeepsUpdatePairs(t *testing.T) {
+	changes := plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{
+			{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+			{DNSName: "api.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.3"}},
+		},
+		UpdateNew: []*endpoint.Endpoint{
+			{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.2"}},
+			{DNSName: "api.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.4"}},
+		},
+	}
+	sortChanges(&changes)
+	for i := range changes.UpdateNew {
+		if changes.UpdateOld[i].DNSName != changes.UpdateNew[i].DNSName {
+			t.Errorf("update %d pairs %s with %s", i, changes.UpdateOld[i].DNSName, changes.UpdateNew[i].DNSName)
+		}
+	}
+	if changes.UpdateNew[0].DNSName != "api.example.com" || changes.UpdateOld[0].Targets[0] != "192.0.2.3" {
+		t.Errorf("updates = %v -> %v, want api.example.com first", changes.UpdateOld, changes.UpdateNew)
+	}
+}
@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// sort orders the RRsets of every change by name and type, so the changes of
+// a zone are always sent in the same order
+func (zc *zoneChanges) sort() {
+	sortRRSets(zc.create)
+	sortRRSets(zc.update)
+	sortRRSets(zc.delete)
+}
+
+// sortRRSets orders RRsets by name, deletions first, then by type
+func sortRRSets(rrsets []desec.RRSet) {
+	slices.SortStableFunc(rrsets, func(a, b desec.RRSet) int {
+		return cmp.Or(
+			cmp.Compare(a.SubName, b.SubName),
+			cmp.Compare(min(len(a.Records), 1), min(len(b.Records), 1)),
+			cmp.Compare(a.Type, b.Type),
+		)
+	})
+}
+
+// takeTypeConflicts removes the created RRsets that can't coexist with an
+// RRset deleted at the same name, like an A record replacing a CNAME, along
+// with those deletions. They are returned as a single list, ordered with the
+// deletions first, to be written in one request.
+func (zc *zoneChanges) takeTypeConflicts() []desec.RRSet {
+	deleted := make(map[string][]string)
+	for _, rrset := range zc.delete {
+		deleted[rrset.SubName] = append(deleted[rrset.SubName], rrset.Type)
+	}
+
+	var swaps []desec.RRSet
+	replaced := make(map[rrsetKey]bool)
+	zc.create = slices.DeleteFunc(zc.create, func(rrset desec.RRSet) bool {
+		conflicting := false
+		for _, recordType := range deleted[rrset.SubName] {
+			if typesConflict(rrset.Type, recordType) {
+				replaced[rrsetKey{subname: rrset.SubName, recordType: recordType}] = true
+				conflicting = true
+			}
+		}
+		if conflicting {
+			swaps = append(swaps, rrset)
+		}
+		return conflicting
+	})
+	zc.delete = slices.DeleteFunc(zc.delete, func(rrset desec.RRSet) bool {
+		if replaced[rrsetKey{subname: rrset.SubName, recordType: rrset.Type}] {
+			// Sending an RRset without records deletes it
+			swaps = append(swaps, desec.RRSet{SubName: rrset.SubName, Type: rrset.Type, Records: []string{}})
+			return true
+		}
+		return false
+	})
+	sortRRSets(swaps)
+	return swaps
+}
+
+// typesConflict reports whether RRsets of two types can't exist at the same
+// name: a CNAME excludes every other type
+func typesConflict(a, b string) bool {
+	return a != b && (a == endpoint.RecordTypeCNAME || b == endpoint.RecordTypeCNAME)
+}
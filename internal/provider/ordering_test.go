@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestTakeTypeConflicts(t *testing.T) {
+	zc := &zoneChanges{
+		create: []desec.RRSet{
+			{SubName: "www", Type: "A", TTL: 3600, Records: []string{"192.0.2.1"}},
+			{SubName: "www", Type: "AAAA", TTL: 3600, Records: []string{"2001:db8::1"}},
+			{SubName: "api", Type: "CNAME", TTL: 3600, Records: []string{"lb.example.net."}},
+			{SubName: "mail", Type: "A", TTL: 3600, Records: []string{"192.0.2.2"}},
+		},
+		delete: []desec.RRSet{
+			{SubName: "www", Type: "CNAME", TTL: 3600, Records: []string{"lb.example.net."}},
+			{SubName: "api", Type: "A", TTL: 3600, Records: []string{"192.0.2.3"}},
+			{SubName: "mail", Type: "MX", TTL: 3600, Records: []string{"10 mx.example.net."}},
+		},
+	}
+
+	swaps := zc.takeTypeConflicts()
+	expected := []desec.RRSet{
+		{SubName: "api", Type: "A", Records: []string{}},
+		{SubName: "api", Type: "CNAME", TTL: 3600, Records: []string{"lb.example.net."}},
+		{SubName: "www", Type: "CNAME", Records: []string{}},
+		{SubName: "www", Type: "A", TTL: 3600, Records: []string{"192.0.2.1"}},
+		{SubName: "www", Type: "AAAA", TTL: 3600, Records: []string{"2001:db8::1"}},
+	}
+	if !reflect.DeepEqual(swaps, expected) {
+		t.Errorf("takeTypeConflicts() =\n%v\nwant\n%v", swaps, expected)
+	}
+	if len(zc.create) != 1 || zc.create[0].SubName != "mail" {
+		t.Errorf("creates left = %v, want mail/A only", zc.create)
+	}
+	if len(zc.delete) != 1 || zc.delete[0].SubName != "mail" {
+		t.Errorf("deletes left = %v, want mail/MX only", zc.delete)
+	}
+}
+
+func TestApplyChangesReplacesConflictingTypes(t *testing.T) {
+	// The replacements are sent in a single request, even when chunking is on
+	for _, chunkSize := range []int{0, 1} {
+		t.Run(fmt.Sprintf("chunk size %d", chunkSize), func(t *testing.T) {
+			fake, srv := newFakeDesec(t, "example.com")
+			fake.put("example.com", desec.RRSet{SubName: "www", Type: "CNAME", TTL: 3600, Records: []string{"lb.example.net."}})
+			fake.put("example.com", desec.RRSet{SubName: "api", Type: "A", TTL: 3600, Records: []string{"192.0.2.3"}})
+			client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600, BulkChunkSize: chunkSize})
+
+			err := client.ApplyChanges(plan.Changes{
+				Create: []*endpoint.Endpoint{
+					{DNSName: "www.example.com", RecordType: "A", RecordTTL: 3600, Targets: endpoint.Targets{"192.0.2.1"}},
+					{DNSName: "api.example.com", RecordType: "CNAME", RecordTTL: 3600, Targets: endpoint.Targets{"lb.example.net"}},
+				},
+				Delete: []*endpoint.Endpoint{
+					{DNSName: "www.example.com", RecordType: "CNAME", RecordTTL: 3600, Targets: endpoint.Targets{"lb.example.net"}},
+					{DNSName: "api.example.com", RecordType: "A", RecordTTL: 3600, Targets: endpoint.Targets{"192.0.2.3"}},
+				},
+			})
+			if err != nil {
+				t.Fatalf("ApplyChanges() error = %v", err)
+			}
+
+			if _, ok := fake.get("example.com", "www", "CNAME"); ok {
+				t.Error("www/CNAME still exists")
+			}
+			if rrset, ok := fake.get("example.com", "www", "A"); !ok || !reflect.DeepEqual(rrset.Records, []string{"192.0.2.1"}) {
+				t.Errorf("www/A = %v, %v, want [192.0.2.1]", rrset.Records, ok)
+			}
+			if _, ok := fake.get("example.com", "api", "A"); ok {
+				t.Error("api/A still exists")
+			}
+			if rrset, ok := fake.get("example.com", "api", "CNAME"); !ok || !reflect.DeepEqual(rrset.Records, []string{"lb.example.net."}) {
+				t.Errorf("api/CNAME = %v, %v, want [lb.example.net.]", rrset.Records, ok)
+			}
+			if puts, writes := fake.count(http.MethodPut), fake.writes(); puts != 1 || writes != 1 {
+				t.Errorf("ApplyChanges() sent %d writes with %d bulk replacements, want a single one", writes, puts)
+			}
+		})
+	}
+}
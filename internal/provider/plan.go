@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// defaultManagedRecordTypes is the default --managed-record-types of external-dns
+var defaultManagedRecordTypes = []string{endpoint.RecordTypeA, endpoint.RecordTypeAAAA, endpoint.RecordTypeCNAME}
+
+// PlanOptions mirror the external-dns flags the planner depends on
+type PlanOptions struct {
+	Ownership OwnershipOptions
+	// Policy is sync, upsert-only or create-only, sync when empty
+	Policy string
+	// ManagedRecordTypes default to A, AAAA and CNAME like in external-dns
+	ManagedRecordTypes []string
+	ExcludeRecordTypes []string
+}
+
+// Plan computes the changes external-dns would send for the desired endpoints,
+// TXT registry records included, and returns the endpoints dropped as invalid.
+// Like the external-dns controller, the records of the managed zones go
+// through the TXT registry, the desired endpoints are filtered and adjusted
+// like by the adjustendpoints handler of the webhook and both go through the
+// planner.
+// Nothing is written, and the state of the client is left unchanged: the
+// records not to manage aren't remembered and apex CNAMEs are flattened into
+// the addresses already published when there are some.
+func (d *DesecClient) Plan(desired []*endpoint.Endpoint, options PlanOptions) (plan.Changes, []EndpointError, error) {
+	policyName := options.Policy
+	if policyName == "" {
+		policyName = "sync"
+	}
+	policy, ok := plan.Policies[policyName]
+	if !ok {
+		return plan.Changes{}, nil, fmt.Errorf("unknown policy %q", policyName)
+	}
+	managedTypes := options.ManagedRecordTypes
+	if len(managedTypes) == 0 {
+		managedTypes = defaultManagedRecordTypes
+	}
+	ownerID := options.Ownership.OwnerID
+	if ownerID == "" {
+		ownerID = defaultOwnerID
+	}
+
+	var current []*endpoint.Endpoint
+	zones := d.ManagedZones()
+	for _, zone := range zones {
+		endpoints, err := d.GetEndpoints(zone)
+		if err != nil {
+			return plan.Changes{}, nil, fmt.Errorf("failed to get records for domain %s: %w", zone, err)
+		}
+		current = append(current, endpoints...)
+	}
+	valid, invalid := FilterValidEndpoints(desired)
+	adjusted, unmanaged := d.adjustEndpoints(valid, d.previewAlias(current))
+
+	// Records not to manage are hidden, as GetEndpoints does once they are
+	// remembered
+	current = slices.DeleteFunc(current, func(ep *endpoint.Endpoint) bool {
+		_, ok := unmanaged[endpointKey(ep)]
+		return ok
+	})
+	recorder := &registryProvider{records: current}
+	txtRegistry, err := newTXTRegistry(recorder, options.Ownership)
+	if err != nil {
+		return plan.Changes{}, nil, err
+	}
+	records, err := txtRegistry.Records(context.Background())
+	if err != nil {
+		return plan.Changes{}, nil, err
+	}
+
+	calculated := (&plan.Plan{
+		Policies:       []plan.Policy{policy},
+		Current:        records,
+		Desired:        adjusted,
+		DomainFilter:   endpoint.MatchAllDomainFilters{endpoint.NewDomainFilter(zones)},
+		ManagedRecords: managedTypes,
+		ExcludeRecords: options.ExcludeRecordTypes,
+		OwnerID:        ownerID,
+	}).Calculate()
+	if !calculated.Changes.HasChanges() {
+		return plan.Changes{}, invalid, nil
+	}
+
+	// The registry adds its TXT records to the changes it passes on
+	if err := txtRegistry.ApplyChanges(context.Background(), calculated.Changes); err != nil {
+		return plan.Changes{}, nil, err
+	}
+	changes := recorder.changes
+	sortChanges(&changes)
+	return changes, invalid, nil
+}
@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestPlan(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	fake.put("example.com", desec.RRSet{SubName: "www", Type: "A", TTL: 3600, Records: []string{"192.0.2.1"}})
+	fake.put("example.com", desec.RRSet{SubName: "a-www", Type: "TXT", TTL: 3600, Records: []string{`"heritage=external-dns,external-dns/owner=cluster"`}})
+	fake.put("example.com", desec.RRSet{SubName: "old", Type: "A", TTL: 3600, Records: []string{"192.0.2.3"}})
+	fake.put("example.com", desec.RRSet{SubName: "a-old", Type: "TXT", TTL: 3600, Records: []string{`"heritage=external-dns,external-dns/owner=cluster"`}})
+	fake.put("example.com", desec.RRSet{SubName: "manual", Type: "A", TTL: 3600, Records: []string{"192.0.2.9"}})
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600})
+
+	desired := []*endpoint.Endpoint{
+		{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.2"}},
+		{DNSName: "new.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.4"}},
+		{DNSName: "bad.example.com", RecordType: "A", Targets: endpoint.Targets{"not an address"}},
+	}
+	changes, invalid, err := client.Plan(desired, PlanOptions{Ownership: OwnershipOptions{OwnerID: "cluster"}})
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	// Invalid endpoints are dropped like by the webhook
+	if len(invalid) != 1 || invalid[0].DNSName != "bad.example.com" || invalid[0].Reason == "" {
+		t.Errorf("Plan() invalid = %+v, want bad.example.com with its reason", invalid)
+	}
+
+	keys := func(endpoints []*endpoint.Endpoint) []string {
+		var result []string
+		for _, ep := range endpoints {
+			result = append(result, normalizeName(ep.DNSName)+"/"+ep.RecordType)
+		}
+		return result
+	}
+	// The record without an owner is left alone
+	if created := keys(changes.Create); !reflect.DeepEqual(created, []string{"a-new.example.com/TXT", "new.example.com/A"}) {
+		t.Errorf("Plan() Create = %v", created)
+	}
+	if updated := keys(changes.UpdateNew); !slices.Contains(updated, "www.example.com/A") {
+		t.Errorf("Plan() UpdateNew = %v, want www.example.com/A", updated)
+	}
+	if deleted := keys(changes.Delete); !reflect.DeepEqual(deleted, []string{"a-old.example.com/TXT", "old.example.com/A"}) {
+		t.Errorf("Plan() Delete = %v", deleted)
+	}
+
+	// Another owner changes nothing it doesn't own
+	changes, _, err = client.Plan(nil, PlanOptions{Ownership: OwnershipOptions{OwnerID: "other"}})
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if len(changes.Create)+len(changes.UpdateNew)+len(changes.Delete) > 0 {
+		t.Errorf("Plan() for another owner = %+v, want no changes", changes)
+	}
+
+	if _, _, err := client.Plan(desired, PlanOptions{Policy: "yolo"}); err == nil {
+		t.Error("Plan() with an unknown policy expected error but got none")
+	}
+}
+
+// unexpectedResolver fails the test on every lookup
+type unexpectedResolver struct {
+	t *testing.T
+}
+
+func (r unexpectedResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	r.t.Errorf("unexpected lookup of %s", host)
+	return nil, errors.New("unexpected lookup")
+}
+
+func TestPlanLeavesClientState(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	owned := `"heritage=external-dns,external-dns/owner=cluster"`
+	fake.put("example.com", desec.RRSet{SubName: "", Type: "A", TTL: 3600, Records: []string{"192.0.2.1"}})
+	fake.put("example.com", desec.RRSet{SubName: "a", Type: "TXT", TTL: 3600, Records: []string{owned}})
+	fake.put("example.com", desec.RRSet{SubName: "manual", Type: "A", TTL: 3600, Records: []string{"192.0.2.9"}})
+	fake.put("example.com", desec.RRSet{SubName: "a-manual", Type: "TXT", TTL: 3600, Records: []string{owned}})
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600, AliasMode: true})
+	// The published addresses are used instead of resolving the target
+	client.resolver = unexpectedResolver{t}
+
+	desired := []*endpoint.Endpoint{
+		{DNSName: "example.com", RecordType: "CNAME", Targets: endpoint.Targets{"lb.example.net"}, RecordTTL: 3600},
+		{DNSName: "manual.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.9"}, ProviderSpecific: endpoint.ProviderSpecific{
+			{Name: "desec/do-not-manage", Value: "true"},
+		}},
+	}
+	changes, _, err := client.Plan(desired, PlanOptions{Ownership: OwnershipOptions{OwnerID: "cluster"}})
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if changes.HasChanges() {
+		t.Errorf("Plan() = %+v, want no changes", changes)
+	}
+	if len(client.unmanaged) != 0 || len(client.aliases) != 0 {
+		t.Errorf("Plan() changed the client state: unmanaged %v, aliases %v", client.unmanaged, client.aliases)
+	}
+}
@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// Provider-specific properties are read from the desec/ namespace, which
+// DNSEndpoint resources can set directly, and from webhook/desec-, where
+// external-dns puts the external-dns.alpha.kubernetes.io/webhook-desec-*
+// annotations
+const (
+	providerSpecificPrefix        = "desec/"
+	webhookProviderSpecificPrefix = "webhook/desec-"
+
+	propertyTTL         = "ttl"
+	propertyDoNotManage = "do-not-manage"
+	propertyAlias       = "alias"
+)
+
+// recordOptions are the deSEC provider-specific properties of an endpoint
+type recordOptions struct {
+	// ttl overrides the TTL policy, only the limits of the zone apply
+	ttl endpoint.TTL
+	// doNotManage leaves the record alone: it is neither created, updated nor deleted
+	doNotManage bool
+	// alias enables or disables ALIAS flattening, nil follows the ALIAS mode
+	alias *bool
+}
+
+// providerSpecificKey returns the deSEC key of a provider-specific property
+func providerSpecificKey(name string) (string, bool) {
+	if key, ok := strings.CutPrefix(name, providerSpecificPrefix); ok {
+		return key, true
+	}
+	return strings.CutPrefix(name, webhookProviderSpecificPrefix)
+}
+
+// parseRecordOptions reads the deSEC provider-specific properties and returns
+// the other properties along with the unknown deSEC keys
+func parseRecordOptions(properties endpoint.ProviderSpecific) (recordOptions, endpoint.ProviderSpecific, []string, error) {
+	var options recordOptions
+	var others endpoint.ProviderSpecific
+	var unknown []string
+	for _, property := range properties {
+		key, ok := providerSpecificKey(property.Name)
+		if !ok {
+			others = append(others, property)
+			continue
+		}
+		switch key {
+		case propertyTTL:
+			ttl, err := strconv.ParseInt(property.Value, 10, 32)
+			if err != nil || ttl <= 0 {
+				return recordOptions{}, nil, nil, fmt.Errorf("invalid %s %q: expected a positive number of seconds", property.Name, property.Value)
+			}
+			options.ttl = endpoint.TTL(ttl)
+		case propertyDoNotManage:
+			value, err := strconv.ParseBool(property.Value)
+			if err != nil {
+				return recordOptions{}, nil, nil, fmt.Errorf("invalid %s %q: expected a boolean", property.Name, property.Value)
+			}
+			options.doNotManage = value
+		case propertyAlias:
+			value, err := strconv.ParseBool(property.Value)
+			if err != nil {
+				return recordOptions{}, nil, nil, fmt.Errorf("invalid %s %q: expected a boolean", property.Name, property.Value)
+			}
+			options.alias = &value
+		default:
+			unknown = append(unknown, property.Name)
+		}
+	}
+	return options, others, unknown, nil
+}
+
+// endpointKey identifies an endpoint the way the external-dns planner does
+func endpointKey(ep *endpoint.Endpoint) string {
+	return normalizeName(ep.DNSName) + "/" + ep.RecordType + "/" + ep.SetIdentifier
+}
+
+// isUnmanaged reports whether an endpoint was marked as not managed, either by
+// its own properties or by the last endpoints adjusted
+func (d *DesecClient) isUnmanaged(ep *endpoint.Endpoint) bool {
+	if options, _, _, err := parseRecordOptions(ep.ProviderSpecific); err == nil && options.doNotManage {
+		return true
+	}
+	d.unmanagedMu.Lock()
+	defer d.unmanagedMu.Unlock()
+	_, ok := d.unmanaged[endpointKey(ep)]
+	return ok
+}
+
+// filterUnmanagedChanges drops the changes of records marked as not managed.
+// Updates are dropped along with the endpoint they replace.
+func (d *DesecClient) filterUnmanagedChanges(changes plan.Changes) plan.Changes {
+	filter := func(change string, eps []*endpoint.Endpoint) []*endpoint.Endpoint {
+		var result []*endpoint.Endpoint
+		for _, ep := range eps {
+			if ep != nil && d.isUnmanaged(ep) {
+				log.Infof("skipping %s of unmanaged record %s/%s", change, ep.DNSName, ep.RecordType)
+				continue
+			}
+			result = append(result, ep)
+		}
+		return result
+	}
+
+	filtered := plan.Changes{
+		Create: filter("create", changes.Create),
+		Delete: filter("delete", changes.Delete),
+	}
+	for i, ep := range changes.UpdateNew {
+		if i >= len(changes.UpdateOld) {
+			break
+		}
+		old := changes.UpdateOld[i]
+		if kept := filter("update", []*endpoint.Endpoint{old, ep}); len(kept) < 2 {
+			continue
+		}
+		filtered.UpdateOld = append(filtered.UpdateOld, old)
+		filtered.UpdateNew = append(filtered.UpdateNew, ep)
+	}
+	return filtered
+}
@@ -0,0 +1,153 @@
+package provider
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestParseRecordOptions(t *testing.T) {
+	enabled := true
+	tests := []struct {
+		name        string
+		properties  endpoint.ProviderSpecific
+		expectError bool
+		expected    recordOptions
+		others      endpoint.ProviderSpecific
+		unknown     []string
+	}{
+		{
+			name: "deSEC namespace",
+			properties: endpoint.ProviderSpecific{
+				{Name: "desec/ttl", Value: "60"},
+				{Name: "desec/alias", Value: "true"},
+				{Name: "aws/weight", Value: "10"},
+			},
+			expected: recordOptions{ttl: 60, alias: &enabled},
+			others:   endpoint.ProviderSpecific{{Name: "aws/weight", Value: "10"}},
+		},
+		{
+			name: "Webhook annotations",
+			properties: endpoint.ProviderSpecific{
+				{Name: "webhook/desec-do-not-manage", Value: "true"},
+				{Name: "webhook/desec-proxied", Value: "true"},
+				{Name: "webhook/other", Value: "x"},
+			},
+			expected: recordOptions{doNotManage: true},
+			others:   endpoint.ProviderSpecific{{Name: "webhook/other", Value: "x"}},
+			unknown:  []string{"webhook/desec-proxied"},
+		},
+		{name: "Invalid TTL", properties: endpoint.ProviderSpecific{{Name: "desec/ttl", Value: "1h"}}, expectError: true},
+		{name: "Negative TTL", properties: endpoint.ProviderSpecific{{Name: "desec/ttl", Value: "-60"}}, expectError: true},
+		{name: "Invalid boolean", properties: endpoint.ProviderSpecific{{Name: "desec/alias", Value: "yes please"}}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, others, unknown, err := parseRecordOptions(tt.properties)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("parseRecordOptions() expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRecordOptions() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(options, tt.expected) {
+				t.Errorf("parseRecordOptions() options = %+v, want %+v", options, tt.expected)
+			}
+			if !reflect.DeepEqual(others, tt.others) {
+				t.Errorf("parseRecordOptions() others = %v, want %v", others, tt.others)
+			}
+			if !reflect.DeepEqual(unknown, tt.unknown) {
+				t.Errorf("parseRecordOptions() unknown = %v, want %v", unknown, tt.unknown)
+			}
+		})
+	}
+}
+
+func TestAdjustEndpointsProviderSpecific(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	fake.setMinimumTTL("example.com", 60)
+	client := newTestClient(t, srv, config.Config{
+		DomainFilters: []string{"example.com"},
+		DefaultTTL:    3600,
+		TTLPolicy:     config.TTLPolicy{{Min: 1800}},
+	})
+	client.resolver = staticResolver{"lb.example.net": {netip.MustParseAddr("192.0.2.1")}}
+	if _, err := client.GetDomains(); err != nil {
+		t.Fatalf("GetDomains() error = %v", err)
+	}
+
+	adjusted, err := client.AdjustEndpoints([]*endpoint.Endpoint{
+		{DNSName: "low.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, ProviderSpecific: endpoint.ProviderSpecific{
+			{Name: "desec/ttl", Value: "30"},
+			{Name: "aws/weight", Value: "10"},
+		}},
+		{DNSName: "manual.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.2"}, ProviderSpecific: endpoint.ProviderSpecific{
+			{Name: "webhook/desec-do-not-manage", Value: "true"},
+		}},
+		{DNSName: "example.com", RecordType: "CNAME", Targets: endpoint.Targets{"lb.example.net"}, RecordTTL: 300, ProviderSpecific: endpoint.ProviderSpecific{
+			{Name: "desec/alias", Value: "true"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+
+	// The provider-specific TTL bypasses the policy but not the zone minimum,
+	// the unmanaged endpoint is dropped and the apex CNAME is flattened
+	expected := []*endpoint.Endpoint{
+		{DNSName: "low.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 60,
+			ProviderSpecific: endpoint.ProviderSpecific{{Name: "aws/weight", Value: "10"}}},
+		{DNSName: "example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 1800},
+	}
+	if !reflect.DeepEqual(adjusted, expected) {
+		t.Errorf("AdjustEndpoints() = %v, want %v", adjusted, expected)
+	}
+
+	// The unmanaged record is hidden from external-dns and never changed
+	fake.put("example.com", desec.RRSet{SubName: "manual", Type: "A", TTL: 3600, Records: []string{"192.0.2.9"}})
+	endpoints, err := client.GetEndpoints("example.com")
+	if err != nil {
+		t.Fatalf("GetEndpoints() error = %v", err)
+	}
+	for _, ep := range endpoints {
+		if ep.DNSName == "manual.example.com" {
+			t.Errorf("GetEndpoints() returned the unmanaged record %v", ep)
+		}
+	}
+	manual := &endpoint.Endpoint{DNSName: "manual.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.9"}, RecordTTL: 3600}
+	if err := client.ApplyChanges(plan.Changes{Delete: []*endpoint.Endpoint{manual}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if _, ok := fake.get("example.com", "manual", "A"); !ok {
+		t.Error("ApplyChanges() deleted the unmanaged record")
+	}
+}
+
+func TestAdjustEndpointsSkipsInvalidProviderSpecific(t *testing.T) {
+	client, err := CreateDesecClient(config.Config{APIToken: "test-token", DomainFilters: []string{"example.com"}, DefaultTTL: 3600})
+	if err != nil {
+		t.Fatalf("CreateDesecClient() error = %v", err)
+	}
+	invalid := &endpoint.Endpoint{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, ProviderSpecific: endpoint.ProviderSpecific{
+		{Name: "desec/ttl", Value: "soon"},
+	}}
+	adjusted, err := client.AdjustEndpoints([]*endpoint.Endpoint{
+		invalid,
+		{DNSName: "api.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.2"}},
+	})
+	if err != nil || len(adjusted) != 1 || adjusted[0].DNSName != "api.example.com" {
+		t.Errorf("AdjustEndpoints() = %v, %v, want only api.example.com", adjusted, err)
+	}
+	if !client.isUnmanaged(&endpoint.Endpoint{DNSName: "www.example.com", RecordType: "A"}) {
+		t.Error("the records of the skipped endpoint are not left alone")
+	}
+}
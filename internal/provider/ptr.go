@@ -0,0 +1,236 @@
+package provider
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/nrdcg/desec"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// reverseName returns the name of the PTR record of an address, e.g.
+// "1.2.0.192.in-addr.arpa" for 192.0.2.1
+func reverseName(addr netip.Addr) string {
+	addr = addr.Unmap()
+	var labels []string
+	if addr.Is4() {
+		for _, b := range addr.As4() {
+			labels = append(labels, fmt.Sprint(b))
+		}
+		slices.Reverse(labels)
+		return strings.Join(labels, ".") + ".in-addr.arpa"
+	}
+	const hexDigits = "0123456789abcdef"
+	for _, b := range addr.As16() {
+		labels = append(labels, string(hexDigits[b>>4]), string(hexDigits[b&0xf]))
+	}
+	slices.Reverse(labels)
+	return strings.Join(labels, ".") + ".ip6.arpa"
+}
+
+// ptrOwnershipSubname is the TXT RRset holding, for every reverse zone, the
+// hostnames of the PTR records written by the webhook. Only these records are
+// ever changed or removed.
+const ptrOwnershipSubname = "_external-dns-ptr"
+
+// ptrOwnership maps the subnames of PTR RRsets to the hostnames the webhook owns
+type ptrOwnership map[string][]string
+
+// isPTROwnershipRRSet reports whether an RRset is the PTR ownership metadata of its zone
+func isPTROwnershipRRSet(rrset *desec.RRSet) bool {
+	return rrset.SubName == ptrOwnershipSubname && rrset.Type == endpoint.RecordTypeTXT
+}
+
+// parsePTROwnership reads the PTR ownership metadata from the RRsets of a
+// reverse zone. Every metadata record is a URL encoded query, e.g.
+// "host=www.example.com.&name=1".
+func parsePTROwnership(rrsets []desec.RRSet) ptrOwnership {
+	ownership := make(ptrOwnership)
+	for i := range rrsets {
+		if !isPTROwnershipRRSet(&rrsets[i]) {
+			continue
+		}
+		for _, record := range rrsets[i].Records {
+			values, err := url.ParseQuery(txtContent(record))
+			if err != nil || values.Get("name") == "" || len(values["host"]) == 0 {
+				log.Warnf("ignoring invalid PTR ownership record %s", record)
+				continue
+			}
+			ownership[values.Get("name")] = canonicalTargets(endpoint.RecordTypePTR, values["host"])
+		}
+	}
+	return ownership
+}
+
+// records renders the PTR ownership metadata, sorted
+func (o ptrOwnership) records() []string {
+	var records []string
+	for name, hosts := range o {
+		if len(hosts) == 0 {
+			continue
+		}
+		values := url.Values{"name": {name}, "host": hosts}
+		records = append(records, txtRecord(values.Encode()))
+	}
+	slices.Sort(records)
+	return records
+}
+
+// ptrHosts tracks, for every PTR name, the hostnames to add (true) or remove (false)
+type ptrHosts map[string]map[string]bool
+
+// collect records the addresses of A and AAAA endpoints
+func (p ptrHosts) collect(eps []*endpoint.Endpoint, add bool) {
+	for _, ep := range eps {
+		if ep == nil || (ep.RecordType != endpoint.RecordTypeA && ep.RecordType != endpoint.RecordTypeAAAA) {
+			continue
+		}
+		// Wildcards don't name a single host
+		if strings.HasPrefix(ep.DNSName, "*.") {
+			continue
+		}
+		host := canonicalHostname(ep.DNSName)
+		for _, target := range ep.Targets {
+			addr, err := netip.ParseAddr(target)
+			if err != nil {
+				continue
+			}
+			name := reverseName(addr)
+			if p[name] == nil {
+				p[name] = make(map[string]bool)
+			}
+			p[name][host] = add
+		}
+	}
+}
+
+// planPTRChanges maintains the PTR records matching the A and AAAA changes in
+// the configured reverse zones. A PTR RRset is only written when all of its
+// records were written by the webhook, as recorded in the ownership metadata
+// of the zone; other PTRs belong to someone else and are left alone.
+func (d *DesecClient) planPTRChanges(changes plan.Changes, zone func(domain string) *zoneChanges) error {
+	if len(d.reverseZones) == 0 {
+		return nil
+	}
+
+	// Removals first, so that an address moving between endpoints is kept
+	hosts := make(ptrHosts)
+	hosts.collect(changes.UpdateOld, false)
+	hosts.collect(changes.Delete, false)
+	hosts.collect(changes.Create, true)
+	hosts.collect(changes.UpdateNew, true)
+
+	byZone := make(map[string][]string)
+	for name := range hosts {
+		reverseZone := findMatchingDomain(name, d.reverseZones)
+		if reverseZone == "" {
+			log.Debugf("no reverse zone configured for %s", name)
+			continue
+		}
+		byZone[reverseZone] = append(byZone[reverseZone], name)
+	}
+
+	for _, reverseZone := range slices.Sorted(maps.Keys(byZone)) {
+		rrsets, err := d.GetRecords(reverseZone)
+		if err != nil {
+			log.Errorf("failed to fetch records of reverse zone %s: %v", reverseZone, err)
+			return err
+		}
+		current := make(map[string]desec.RRSet, len(rrsets))
+		var metadata *desec.RRSet
+		for i, rrset := range rrsets {
+			switch {
+			case rrset.Type == endpoint.RecordTypePTR:
+				current[rrset.SubName] = rrset
+			case isPTROwnershipRRSet(&rrset):
+				metadata = &rrsets[i]
+			}
+		}
+		ownership := parsePTROwnership(rrsets)
+
+		zc := zone(reverseZone)
+		names := byZone[reverseZone]
+		slices.Sort(names)
+		for _, name := range names {
+			subname := extractSubname(name, reverseZone)
+			existing, exists := current[subname]
+			records := canonicalTargets(endpoint.RecordTypePTR, existing.Records)
+
+			if foreign := foreignHostnames(records, ownership[subname]); len(foreign) > 0 {
+				log.Warnf("not updating PTR %s, its records %v were not written by the webhook", name, foreign)
+				continue
+			}
+
+			next := slices.DeleteFunc(slices.Clone(records), func(host string) bool {
+				add, changed := hosts[name][host]
+				return changed && !add
+			})
+			for _, host := range slices.Sorted(maps.Keys(hosts[name])) {
+				if hosts[name][host] && !slices.Contains(next, host) {
+					next = append(next, host)
+				}
+			}
+			if slices.Equal(records, next) {
+				continue
+			}
+			if len(next) > 0 {
+				ownership[subname] = next
+			} else {
+				delete(ownership, subname)
+			}
+
+			if d.dryRun {
+				log.Infof("dryrun: would change PTR %s: %v -> %v", name, records, next)
+			} else {
+				log.Debugf("changing PTR %s: %v -> %v", name, records, next)
+			}
+			ttl := d.ttlFor(reverseZone, name, endpoint.RecordTypePTR, endpoint.TTL(existing.TTL))
+			rrset := desec.RRSet{SubName: subname, Type: endpoint.RecordTypePTR, TTL: ttl, Records: next}
+			switch {
+			case len(next) == 0:
+				zc.delete = append(zc.delete, rrset)
+			case exists:
+				zc.update = append(zc.update, rrset)
+			default:
+				zc.create = append(zc.create, rrset)
+			}
+		}
+
+		// Persist the ownership metadata when it changed
+		records := ownership.records()
+		var previous []string
+		if metadata != nil {
+			previous = slices.Sorted(slices.Values(metadata.Records))
+		}
+		if slices.Equal(records, previous) {
+			continue
+		}
+		rrset := desec.RRSet{SubName: ptrOwnershipSubname, Type: endpoint.RecordTypeTXT, TTL: d.ttlFor(reverseZone, ptrOwnershipSubname+"."+reverseZone, endpoint.RecordTypeTXT, 0), Records: records}
+		switch {
+		case len(records) == 0:
+			zc.delete = append(zc.delete, rrset)
+		case metadata != nil:
+			zc.update = append(zc.update, rrset)
+		default:
+			zc.create = append(zc.create, rrset)
+		}
+	}
+	return nil
+}
+
+// foreignHostnames returns the hostnames of a PTR RRset not owned by the webhook
+func foreignHostnames(hosts, owned []string) []string {
+	var foreign []string
+	for _, host := range hosts {
+		if !slices.Contains(owned, host) {
+			foreign = append(foreign, host)
+		}
+	}
+	return foreign
+}
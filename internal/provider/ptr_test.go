@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestReverseName(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		{addr: "192.0.2.1", expected: "1.2.0.192.in-addr.arpa"},
+		{addr: "::ffff:192.0.2.1", expected: "1.2.0.192.in-addr.arpa"},
+		{addr: "2001:db8::1", expected: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if result := reverseName(netip.MustParseAddr(tt.addr)); result != tt.expected {
+				t.Errorf("reverseName(%s) = %s, want %s", tt.addr, result, tt.expected)
+			}
+		})
+	}
+}
+
+func newPTRTestClient(t *testing.T, dryRun bool) (*fakeDesec, *DesecClient) {
+	t.Helper()
+	fake, srv := newFakeDesec(t, "example.com", "2.0.192.in-addr.arpa", "8.b.d.0.1.0.0.2.ip6.arpa")
+	client := newTestClient(t, srv, config.Config{
+		DomainFilters: []string{"example.com"},
+		ReverseZones:  []string{"2.0.192.in-addr.arpa", "8.b.d.0.1.0.0.2.ip6.arpa"},
+		DefaultTTL:    3600,
+		DryRun:        dryRun,
+	})
+	return fake, client
+}
+
+func TestApplyChangesManagesPTRRecords(t *testing.T) {
+	fake, client := newPTRTestClient(t, false)
+
+	www := &endpoint.Endpoint{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 3600}
+	www6 := &endpoint.Endpoint{DNSName: "www.example.com", RecordType: "AAAA", Targets: endpoint.Targets{"2001:db8::1"}, RecordTTL: 3600}
+	if err := client.ApplyChanges(plan.Changes{Create: []*endpoint.Endpoint{www, www6}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if rrset, ok := fake.get("2.0.192.in-addr.arpa", "1", "PTR"); !ok || !reflect.DeepEqual(rrset.Records, []string{"www.example.com."}) {
+		t.Errorf("PTR 192.0.2.1 = %v, want [www.example.com.]", rrset.Records)
+	}
+	subname6 := "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0"
+	if rrset, ok := fake.get("8.b.d.0.1.0.0.2.ip6.arpa", subname6, "PTR"); !ok || !reflect.DeepEqual(rrset.Records, []string{"www.example.com."}) {
+		t.Errorf("PTR 2001:db8::1 = %v, want [www.example.com.]", rrset.Records)
+	}
+	if rrset, ok := fake.get("2.0.192.in-addr.arpa", ptrOwnershipSubname, "TXT"); !ok || !reflect.DeepEqual(rrset.Records, []string{`"host=www.example.com.&name=1"`}) {
+		t.Errorf("PTR ownership = %v, want the PTR of 192.0.2.1", rrset.Records)
+	}
+
+	// Moving the address moves the PTR
+	moved := &endpoint.Endpoint{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.2"}, RecordTTL: 3600}
+	if err := client.ApplyChanges(plan.Changes{UpdateOld: []*endpoint.Endpoint{www}, UpdateNew: []*endpoint.Endpoint{moved}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if _, ok := fake.get("2.0.192.in-addr.arpa", "1", "PTR"); ok {
+		t.Errorf("PTR 192.0.2.1 was not deleted")
+	}
+	if rrset, ok := fake.get("2.0.192.in-addr.arpa", "2", "PTR"); !ok || !reflect.DeepEqual(rrset.Records, []string{"www.example.com."}) {
+		t.Errorf("PTR 192.0.2.2 = %v, want [www.example.com.]", rrset.Records)
+	}
+
+	if err := client.ApplyChanges(plan.Changes{Delete: []*endpoint.Endpoint{moved, www6}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if _, ok := fake.get("2.0.192.in-addr.arpa", "2", "PTR"); ok {
+		t.Errorf("PTR 192.0.2.2 was not deleted")
+	}
+	if _, ok := fake.get("8.b.d.0.1.0.0.2.ip6.arpa", subname6, "PTR"); ok {
+		t.Errorf("PTR 2001:db8::1 was not deleted")
+	}
+	if _, ok := fake.get("2.0.192.in-addr.arpa", ptrOwnershipSubname, "TXT"); ok {
+		t.Errorf("PTR ownership was not deleted with the last PTR")
+	}
+}
+
+func TestApplyChangesKeepsHandMadePTRRecords(t *testing.T) {
+	fake, client := newPTRTestClient(t, false)
+	// A PTR pointing into a managed domain, but not written by the webhook
+	handMade := desec.RRSet{SubName: "7", Type: "PTR", TTL: 3600, Records: []string{"gw.example.com."}}
+	fake.put("2.0.192.in-addr.arpa", handMade)
+
+	gw := &endpoint.Endpoint{DNSName: "gw.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.7"}, RecordTTL: 3600}
+	web := &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.7"}, RecordTTL: 3600}
+	if err := client.ApplyChanges(plan.Changes{Create: []*endpoint.Endpoint{web}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if rrset, _ := fake.get("2.0.192.in-addr.arpa", "7", "PTR"); !reflect.DeepEqual(rrset.Records, handMade.Records) {
+		t.Errorf("hand-made PTR = %v, want it unchanged", rrset.Records)
+	}
+	if err := client.ApplyChanges(plan.Changes{Delete: []*endpoint.Endpoint{gw}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if rrset, ok := fake.get("2.0.192.in-addr.arpa", "7", "PTR"); !ok || !reflect.DeepEqual(rrset.Records, handMade.Records) {
+		t.Errorf("hand-made PTR = %v, want it kept", rrset.Records)
+	}
+	if _, ok := fake.get("2.0.192.in-addr.arpa", ptrOwnershipSubname, "TXT"); ok {
+		t.Errorf("PTR ownership was written for a hand-made PTR")
+	}
+}
+
+func TestApplyChangesKeepsForeignPTRRecords(t *testing.T) {
+	fake, client := newPTRTestClient(t, false)
+	foreign := desec.RRSet{SubName: "5", Type: "PTR", TTL: 3600, Records: []string{"mail.other.org."}}
+	fake.put("2.0.192.in-addr.arpa", foreign)
+
+	changes := plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "mail.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.5"}, RecordTTL: 3600},
+		// No reverse zone is configured for this address
+		{DNSName: "ext.example.com", RecordType: "A", Targets: endpoint.Targets{"198.51.100.1"}, RecordTTL: 3600},
+	}}
+	if err := client.ApplyChanges(changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if rrset, _ := fake.get("2.0.192.in-addr.arpa", "5", "PTR"); !reflect.DeepEqual(rrset.Records, foreign.Records) {
+		t.Errorf("foreign PTR = %v, want it unchanged", rrset.Records)
+	}
+	if err := client.ApplyChanges(plan.Changes{Delete: changes.Create}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if _, ok := fake.get("2.0.192.in-addr.arpa", "5", "PTR"); !ok {
+		t.Errorf("foreign PTR was deleted")
+	}
+}
+
+func TestApplyChangesPTRDryRun(t *testing.T) {
+	fake, client := newPTRTestClient(t, true)
+
+	err := client.ApplyChanges(plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 3600},
+	}})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if writes := fake.writes(); writes != 0 {
+		t.Errorf("dry run sent %d write requests, want none", writes)
+	}
+}
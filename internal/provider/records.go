@@ -0,0 +1,321 @@
+package provider
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	recordTypeCAA   = "CAA"
+	recordTypeSSHFP = "SSHFP"
+
+	maxCAATagLength = 15 // RFC 8659 section 4.1
+)
+
+// recordHandler holds the rules for the record data of one record type
+type recordHandler struct {
+	// parse validates a target and returns its canonical form
+	parse func(target string) (string, error)
+	// render converts a canonical target to the record text stored by deSEC,
+	// nil when both are the same
+	render func(target string) string
+}
+
+// recordHandlers lists the record types supported by the provider.
+// Endpoints of any other type are rejected by validation.
+var recordHandlers = map[string]recordHandler{
+	endpoint.RecordTypeA:     {parse: parseA},
+	endpoint.RecordTypeAAAA:  {parse: parseAAAA},
+	endpoint.RecordTypeCNAME: {parse: parseHostname},
+	endpoint.RecordTypeNS:    {parse: parseHostname},
+	endpoint.RecordTypePTR:   {parse: parseHostname},
+	endpoint.RecordTypeTXT:   {parse: parseTXT, render: txtRecord},
+	recordTypeSPF:            {parse: parseTXT, render: txtRecord},
+	endpoint.RecordTypeMX:    {parse: parseMX},
+	endpoint.RecordTypeSRV:   {parse: parseSRV},
+	recordTypeCAA:            {parse: parseCAA},
+	endpoint.RecordTypeNAPTR: {parse: parseNAPTR},
+	recordTypeSSHFP:          {parse: parseSSHFP},
+	recordTypeSVCB:           {parse: parseSVCB},
+	recordTypeHTTPS:          {parse: parseSVCB},
+}
+
+// supportedRecordTypes returns the supported record types, sorted
+func supportedRecordTypes() []string {
+	types := make([]string, 0, len(recordHandlers))
+	for recordType := range recordHandlers {
+		types = append(types, recordType)
+	}
+	slices.Sort(types)
+	return types
+}
+
+func parseA(target string) (string, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(target))
+	if err != nil || !addr.Is4() {
+		return "", fmt.Errorf("not an IPv4 address")
+	}
+	return addr.String(), nil
+}
+
+func parseAAAA(target string) (string, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(target))
+	if err != nil || !addr.Is6() || addr.Zone() != "" {
+		return "", fmt.Errorf("not an IPv6 address")
+	}
+	return addr.String(), nil
+}
+
+func parseHostname(target string) (string, error) {
+	target = strings.TrimSpace(target)
+	if err := validateHostname(target); err != nil {
+		return "", err
+	}
+	return canonicalHostname(target), nil
+}
+
+// parseTargetHostname is like parseHostname, but also accepts the root name "."
+// used by MX (RFC 7505), SRV and NAPTR to say that there is no target
+func parseTargetHostname(target string) (string, error) {
+	if target == "." {
+		return target, nil
+	}
+	return parseHostname(target)
+}
+
+func parseTXT(target string) (string, error) {
+	if strings.TrimSpace(target) == "" {
+		return "", fmt.Errorf("empty TXT content")
+	}
+	return txtContent(target), nil
+}
+
+// parseMX parses "<preference> <exchange>"
+func parseMX(target string) (string, error) {
+	fields := strings.Fields(target)
+	if len(fields) != 2 {
+		return "", fmt.Errorf("expected \"<preference> <exchange>\"")
+	}
+	preference, err := parseUint16("preference", fields[0])
+	if err != nil {
+		return "", err
+	}
+	exchange, err := parseTargetHostname(fields[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid exchange: %w", err)
+	}
+	return preference + " " + exchange, nil
+}
+
+// parseSRV parses "<priority> <weight> <port> <target>"
+func parseSRV(target string) (string, error) {
+	fields := strings.Fields(target)
+	if len(fields) != 4 {
+		return "", fmt.Errorf("expected \"<priority> <weight> <port> <target>\"")
+	}
+	numbers := make([]string, 3)
+	for i, field := range []string{"priority", "weight", "port"} {
+		number, err := parseUint16(field, fields[i])
+		if err != nil {
+			return "", err
+		}
+		numbers[i] = number
+	}
+	host, err := parseTargetHostname(fields[3])
+	if err != nil {
+		return "", fmt.Errorf("invalid target: %w", err)
+	}
+	return strings.Join(numbers, " ") + " " + host, nil
+}
+
+// parseCAA parses "<flags> <tag> <value>" as defined in RFC 8659. The tag is
+// lowercased and the value always quoted.
+func parseCAA(target string) (string, error) {
+	fields, err := rdataFields(target)
+	if err != nil {
+		return "", err
+	}
+	if len(fields) != 3 || fields[0].quoted || fields[1].quoted {
+		return "", fmt.Errorf("expected \"<flags> <tag> \\\"<value>\\\"\"")
+	}
+	flags, err := parseUint8("flags", fields[0].value)
+	if err != nil {
+		return "", err
+	}
+
+	tag := strings.ToLower(fields[1].value)
+	if tag == "" || len(tag) > maxCAATagLength {
+		return "", fmt.Errorf("tag must be 1 to %d characters long", maxCAATagLength)
+	}
+	for _, c := range tag {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return "", fmt.Errorf("tag %q must be alphanumeric", tag)
+		}
+	}
+
+	value := fields[2].value
+	switch tag {
+	case "issue", "issuewild":
+		// The issuer domain may be empty, to forbid issuance, and followed by parameters
+		issuer := strings.TrimSpace(strings.SplitN(value, ";", 2)[0])
+		if issuer != "" {
+			if err := validateHostname(issuer); err != nil {
+				return "", fmt.Errorf("invalid issuer domain: %w", err)
+			}
+		}
+	case "iodef":
+		if !strings.HasPrefix(value, "mailto:") && !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+			return "", fmt.Errorf("iodef value must be a mailto:, http:// or https:// URL")
+		}
+	}
+
+	return flags + " " + tag + " " + quoteCharacterString(value), nil
+}
+
+// parseNAPTR parses "<order> <preference> <flags> <service> <regexp> <replacement>"
+// as defined in RFC 3403. Flags, service and regexp are always quoted.
+func parseNAPTR(target string) (string, error) {
+	fields, err := rdataFields(target)
+	if err != nil {
+		return "", err
+	}
+	if len(fields) != 6 || fields[0].quoted || fields[1].quoted || fields[5].quoted {
+		return "", fmt.Errorf("expected \"<order> <preference> \\\"<flags>\\\" \\\"<service>\\\" \\\"<regexp>\\\" <replacement>\"")
+	}
+	order, err := parseUint16("order", fields[0].value)
+	if err != nil {
+		return "", err
+	}
+	preference, err := parseUint16("preference", fields[1].value)
+	if err != nil {
+		return "", err
+	}
+
+	flags := strings.ToUpper(fields[2].value)
+	for _, c := range flags {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return "", fmt.Errorf("flags %q must be alphanumeric", flags)
+		}
+	}
+	service := fields[3].value
+	regexp := fields[4].value
+
+	replacement, err := parseTargetHostname(fields[5].value)
+	if err != nil {
+		return "", fmt.Errorf("invalid replacement: %w", err)
+	}
+	if regexp != "" && replacement != "." {
+		return "", fmt.Errorf("regexp and replacement are mutually exclusive")
+	}
+
+	return strings.Join([]string{
+		order,
+		preference,
+		quoteCharacterString(flags),
+		quoteCharacterString(service),
+		quoteCharacterString(regexp),
+		replacement,
+	}, " "), nil
+}
+
+// sshfpFingerprintLengths maps SSHFP fingerprint types to their length in bytes (RFC 4255, RFC 6594)
+var sshfpFingerprintLengths = map[string]int{
+	"1": 20, // SHA-1
+	"2": 32, // SHA-256
+}
+
+// sshfpAlgorithms lists the SSHFP key algorithms (RFC 4255, RFC 6594, RFC 7479, RFC 8709)
+var sshfpAlgorithms = []string{"1", "2", "3", "4", "6"}
+
+// parseSSHFP parses "<algorithm> <fingerprint type> <fingerprint>".
+// The fingerprint is lowercased and may be split by whitespace.
+func parseSSHFP(target string) (string, error) {
+	fields := strings.Fields(target)
+	if len(fields) < 3 {
+		return "", fmt.Errorf("expected \"<algorithm> <fingerprint type> <fingerprint>\"")
+	}
+	algorithm, err := parseUint8("algorithm", fields[0])
+	if err != nil {
+		return "", err
+	}
+	if !slices.Contains(sshfpAlgorithms, algorithm) {
+		return "", fmt.Errorf("unknown algorithm %s", algorithm)
+	}
+	fpType, err := parseUint8("fingerprint type", fields[1])
+	if err != nil {
+		return "", err
+	}
+	length, ok := sshfpFingerprintLengths[fpType]
+	if !ok {
+		return "", fmt.Errorf("unknown fingerprint type %s", fpType)
+	}
+
+	fingerprint := strings.ToLower(strings.Join(fields[2:], ""))
+	decoded, err := hex.DecodeString(fingerprint)
+	if err != nil {
+		return "", fmt.Errorf("fingerprint is not hexadecimal")
+	}
+	if len(decoded) != length {
+		return "", fmt.Errorf("fingerprint is %d bytes long, expected %d for type %s", len(decoded), length, fpType)
+	}
+	return algorithm + " " + fpType + " " + fingerprint, nil
+}
+
+// parseUint16 parses a 16 bit number and returns it without leading zeros
+func parseUint16(field, value string) (string, error) {
+	number, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s %q", field, value)
+	}
+	return strconv.FormatUint(number, 10), nil
+}
+
+// parseUint8 parses an 8 bit number and returns it without leading zeros
+func parseUint8(field, value string) (string, error) {
+	number, err := strconv.ParseUint(value, 10, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s %q", field, value)
+	}
+	return strconv.FormatUint(number, 10), nil
+}
+
+// rdataField is a single whitespace separated field of record data
+type rdataField struct {
+	value  string
+	quoted bool
+}
+
+// rdataFields splits record data into fields. Quoted fields may contain
+// whitespace and escapes, their value is unquoted.
+func rdataFields(text string) ([]rdataField, error) {
+	var fields []rdataField
+	i := 0
+	for {
+		for i < len(text) && isSpace(text[i]) {
+			i++
+		}
+		if i == len(text) {
+			return fields, nil
+		}
+		if text[i] == '"' {
+			value, next, err := readCharacterString(text, i)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, rdataField{value: value, quoted: true})
+			i = next
+			continue
+		}
+		start := i
+		for i < len(text) && !isSpace(text[i]) {
+			i++
+		}
+		fields = append(fields, rdataField{value: text[start:i]})
+	}
+}
@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestRecordHandlers(t *testing.T) {
+	sha1 := "123456789abcdef67890123456789abcdef67890"
+	sha256 := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name        string
+		recordType  string
+		target      string
+		expected    string
+		expectError bool
+	}{
+		// MX
+		{name: "MX", recordType: "MX", target: "10 Mail.Example.com", expected: "10 mail.example.com."},
+		{name: "MX null", recordType: "MX", target: "0 .", expected: "0 ."},
+		{name: "MX missing preference", recordType: "MX", target: "mail.example.com", expectError: true},
+		{name: "MX preference out of range", recordType: "MX", target: "65536 mail.example.com", expectError: true},
+		{name: "MX invalid exchange", recordType: "MX", target: "10 mail_server!.example.com", expectError: true},
+
+		// SRV
+		{name: "SRV", recordType: "SRV", target: "10 60 5060 SIP.example.com", expected: "10 60 5060 sip.example.com."},
+		{name: "SRV no service", recordType: "SRV", target: "0 0 0 .", expected: "0 0 0 ."},
+		{name: "SRV missing port", recordType: "SRV", target: "10 60 sip.example.com", expectError: true},
+		{name: "SRV invalid weight", recordType: "SRV", target: "10 heavy 5060 sip.example.com", expectError: true},
+
+		// CAA
+		{name: "CAA issue", recordType: "CAA", target: `0 issue "letsencrypt.org"`, expected: `0 issue "letsencrypt.org"`},
+		{name: "CAA tag case and unquoted value", recordType: "CAA", target: "0 ISSUE letsencrypt.org", expected: `0 issue "letsencrypt.org"`},
+		{name: "CAA issue with parameters", recordType: "CAA", target: `0 issue "letsencrypt.org; validationmethods=dns-01"`, expected: `0 issue "letsencrypt.org; validationmethods=dns-01"`},
+		{name: "CAA forbid issuance", recordType: "CAA", target: `0 issuewild ";"`, expected: `0 issuewild ";"`},
+		{name: "CAA critical flag", recordType: "CAA", target: `128 iodef "mailto:security@example.com"`, expected: `128 iodef "mailto:security@example.com"`},
+		{name: "CAA invalid iodef", recordType: "CAA", target: `0 iodef "security@example.com"`, expectError: true},
+		{name: "CAA invalid issuer", recordType: "CAA", target: `0 issue "lets encrypt"`, expectError: true},
+		{name: "CAA invalid tag", recordType: "CAA", target: `0 is-sue "letsencrypt.org"`, expectError: true},
+		{name: "CAA quoted tag", recordType: "CAA", target: `0 "issue" "letsencrypt.org"`, expectError: true},
+		{name: "CAA flags out of range", recordType: "CAA", target: `256 issue "letsencrypt.org"`, expectError: true},
+		{name: "CAA missing value", recordType: "CAA", target: `0 issue`, expectError: true},
+		{name: "CAA unterminated value", recordType: "CAA", target: `0 issue "letsencrypt.org`, expectError: true},
+
+		// NAPTR
+		{name: "NAPTR replacement", recordType: "NAPTR", target: `100 10 "s" "SIP+D2U" "" _sip._udp.Example.com`, expected: `100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`},
+		{name: "NAPTR regexp", recordType: "NAPTR", target: `100 50 "u" "E2U+sip" "!^.*$!sip:info@example.com!" .`, expected: `100 50 "U" "E2U+sip" "!^.*$!sip:info@example.com!" .`},
+		{name: "NAPTR unquoted fields", recordType: "NAPTR", target: `100 10 S SIP+D2U "" _sip._udp.example.com.`, expected: `100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`},
+		{name: "NAPTR regexp and replacement", recordType: "NAPTR", target: `100 50 "u" "E2U+sip" "!^.*$!sip:info@example.com!" sip.example.com.`, expectError: true},
+		{name: "NAPTR invalid flags", recordType: "NAPTR", target: `100 10 "s!" "SIP+D2U" "" _sip._udp.example.com.`, expectError: true},
+		{name: "NAPTR missing fields", recordType: "NAPTR", target: `100 10 "s" "SIP+D2U"`, expectError: true},
+
+		// SSHFP
+		{name: "SSHFP SHA-1", recordType: "SSHFP", target: "1 1 " + strings.ToUpper(sha1), expected: "1 1 " + sha1},
+		{name: "SSHFP SHA-256 split", recordType: "SSHFP", target: "4 2 " + sha256[:32] + " " + sha256[32:], expected: "4 2 " + sha256},
+		{name: "SSHFP wrong fingerprint length", recordType: "SSHFP", target: "1 2 " + sha1, expectError: true},
+		{name: "SSHFP unknown algorithm", recordType: "SSHFP", target: "5 1 " + sha1, expectError: true},
+		{name: "SSHFP unknown fingerprint type", recordType: "SSHFP", target: "1 3 " + sha1, expectError: true},
+		{name: "SSHFP not hexadecimal", recordType: "SSHFP", target: "1 1 " + strings.Repeat("zz", 20), expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, ok := recordHandlers[tt.recordType]
+			if !ok {
+				t.Fatalf("no handler for %s", tt.recordType)
+			}
+			result, err := handler.parse(tt.target)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("parse(%q) = %q, expected error", tt.target, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse(%q) unexpected error = %v", tt.target, err)
+			}
+			if result != tt.expected {
+				t.Errorf("parse(%q) = %q, want %q", tt.target, result, tt.expected)
+			}
+			// The canonical form must parse to itself
+			if again, err := handler.parse(result); err != nil || again != result {
+				t.Errorf("parse(%q) = %q, %v, want it unchanged", result, again, err)
+			}
+		})
+	}
+}
+
+func TestValidateUnsupportedRecordType(t *testing.T) {
+	err := ValidateEndpoints([]*endpoint.Endpoint{
+		{DNSName: "example.com", RecordType: "LOC", Targets: endpoint.Targets{"52 22 23.000 N 4 53 32.000 E -2.00m"}},
+	})
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Endpoints) != 1 {
+		t.Fatalf("ValidateEndpoints() error = %v, want a single invalid endpoint", err)
+	}
+	reason := validationErr.Endpoints[0].Reason
+	if !strings.Contains(reason, "unsupported record type LOC") || !strings.Contains(reason, "SSHFP") {
+		t.Errorf("ValidateEndpoints() reason = %q, want it to name the type and the supported types", reason)
+	}
+}
+
+func TestConvertEndpointToRRSetNormalizesEmbeddedHostnames(t *testing.T) {
+	tests := []struct {
+		recordType string
+		target     string
+		expected   string
+	}{
+		{recordType: "MX", target: "10 mail.example.com", expected: "10 mail.example.com."},
+		{recordType: "SRV", target: "10 60 5060 sip.example.com", expected: "10 60 5060 sip.example.com."},
+		{recordType: "NAPTR", target: `100 10 "S" "SIP+D2U" "" _sip._udp.example.com`, expected: `100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`},
+		{recordType: "CAA", target: `0 issue letsencrypt.org`, expected: `0 issue "letsencrypt.org"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.recordType, func(t *testing.T) {
+			rrset := convertEndpointToRRSet(&endpoint.Endpoint{
+				DNSName:    "example.com",
+				RecordType: tt.recordType,
+				Targets:    endpoint.Targets{tt.target},
+			}, "example.com", testTTLLimits)
+			if len(rrset.Records) != 1 || rrset.Records[0] != tt.expected {
+				t.Errorf("convertEndpointToRRSet() records = %v, want [%s]", rrset.Records, tt.expected)
+			}
+		})
+	}
+}
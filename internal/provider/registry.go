@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"errors"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/registry"
+)
+
+// defaultOwnerID is the default --txt-owner-id of external-dns
+const defaultOwnerID = "default"
+
+// OwnershipOptions configure the external-dns TXT registry records written
+// along with imported records, so external-dns takes them over
+type OwnershipOptions struct {
+	OwnerID             string
+	TXTPrefix           string
+	TXTSuffix           string
+	WildcardReplacement string
+}
+
+// newTXTRegistry returns an external-dns TXT registry over a provider
+func newTXTRegistry(provider *registryProvider, options OwnershipOptions) (*registry.TXTRegistry, error) {
+	ownerID := options.OwnerID
+	if ownerID == "" {
+		ownerID = defaultOwnerID
+	}
+	return registry.NewTXTRegistry(provider, options.TXTPrefix, options.TXTSuffix, ownerID,
+		0, options.WildcardReplacement, nil, nil, false, nil, "")
+}
+
+// OwnershipRecords returns the TXT registry records external-dns expects for
+// the endpoints, generated by the external-dns TXT registry itself
+func OwnershipRecords(endpoints []*endpoint.Endpoint, options OwnershipOptions) ([]*endpoint.Endpoint, error) {
+	recorder := &registryProvider{}
+	txtRegistry, err := newTXTRegistry(recorder, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// The registry labels the endpoints it creates
+	created := make([]*endpoint.Endpoint, len(endpoints))
+	for i, ep := range endpoints {
+		created[i] = ep.DeepCopy()
+	}
+	if err := txtRegistry.ApplyChanges(context.Background(), &plan.Changes{Create: created}); err != nil {
+		return nil, err
+	}
+	return recorder.changes.Create[len(created):], nil
+}
+
+// RegistryEndpoints returns the endpoints of a zone labelled with their owner
+// and resource by the external-dns TXT registry, and the TXT registry records
+// apart, labelled with their own content
+func (d *DesecClient) RegistryEndpoints(zone string, options OwnershipOptions) ([]*endpoint.Endpoint, []*endpoint.Endpoint, error) {
+	records, err := d.GetEndpoints(zone)
+	if err != nil {
+		return nil, nil, err
+	}
+	txtRegistry, err := newTXTRegistry(&registryProvider{records: records}, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	endpoints, err := txtRegistry.Records(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The registry returns the records it got, minus its own
+	kept := make(map[*endpoint.Endpoint]bool, len(endpoints))
+	for _, ep := range endpoints {
+		kept[ep] = true
+	}
+	var registryRecords []*endpoint.Endpoint
+	for _, record := range records {
+		if kept[record] || len(record.Targets) == 0 {
+			continue
+		}
+		labels, err := endpoint.NewLabelsFromString(record.Targets[0], nil)
+		if err != nil && !errors.Is(err, endpoint.ErrInvalidHeritage) {
+			return nil, nil, err
+		}
+		record.Labels = labels
+		registryRecords = append(registryRecords, record)
+	}
+	return endpoints, registryRecords, nil
+}
+
+// registryProvider is an external-dns provider serving fixed records and
+// recording the changes applied, to run the external-dns TXT registry offline
+type registryProvider struct {
+	records []*endpoint.Endpoint
+	changes plan.Changes
+}
+
+func (p *registryProvider) Records(_ context.Context) ([]*endpoint.Endpoint, error) {
+	return p.records, nil
+}
+
+func (p *registryProvider) ApplyChanges(_ context.Context, changes *plan.Changes) error {
+	p.changes = *changes
+	return nil
+}
+
+func (p *registryProvider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	return endpoints, nil
+}
+
+func (p *registryProvider) GetDomainFilter() endpoint.DomainFilterInterface {
+	return &endpoint.DomainFilter{}
+}
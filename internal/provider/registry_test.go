@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestOwnershipRecords(t *testing.T) {
+	endpoints := []*endpoint.Endpoint{
+		{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 3600},
+	}
+	records, err := OwnershipRecords(endpoints, OwnershipOptions{OwnerID: "cluster", TXTPrefix: "txt-"})
+	if err != nil {
+		t.Fatalf("OwnershipRecords() error = %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("OwnershipRecords() = %v, want one record", records)
+	}
+	record := records[0]
+	if record.DNSName != "txt-a-www.example.com" || record.RecordType != endpoint.RecordTypeTXT {
+		t.Errorf("OwnershipRecords() = %s/%s, want txt-a-www.example.com/TXT", record.DNSName, record.RecordType)
+	}
+	expected := endpoint.Targets{`"heritage=external-dns,external-dns/owner=cluster"`}
+	if !reflect.DeepEqual(record.Targets, expected) {
+		t.Errorf("OwnershipRecords() targets = %v, want %v", record.Targets, expected)
+	}
+	if len(endpoints[0].Labels) != 0 {
+		t.Errorf("OwnershipRecords() modified the endpoints: %v", endpoints[0].Labels)
+	}
+}
+
+func TestRegistryEndpoints(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	fake.put("example.com", desec.RRSet{SubName: "www", Type: "A", TTL: 3600, Records: []string{"192.0.2.1"}})
+	fake.put("example.com", desec.RRSet{SubName: "a-www", Type: "TXT", TTL: 3600, Records: []string{`"heritage=external-dns,external-dns/owner=cluster,external-dns/resource=ingress/shop/www"`}})
+	fake.put("example.com", desec.RRSet{SubName: "", Type: "TXT", TTL: 3600, Records: []string{`"v=spf1 -all"`}})
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600})
+
+	endpoints, registryRecords, err := client.RegistryEndpoints("example.com", OwnershipOptions{})
+	if err != nil {
+		t.Fatalf("RegistryEndpoints() error = %v", err)
+	}
+	labels := make(map[string]string)
+	for _, ep := range endpoints {
+		labels[normalizeName(ep.DNSName)+"/"+ep.RecordType] = ep.Labels[endpoint.ResourceLabelKey]
+	}
+	expected := map[string]string{"www.example.com/A": "ingress/shop/www", "example.com/TXT": ""}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("RegistryEndpoints() resources = %v, want %v", labels, expected)
+	}
+	if len(registryRecords) != 1 || normalizeName(registryRecords[0].DNSName) != "a-www.example.com" {
+		t.Fatalf("RegistryEndpoints() registry records = %v, want a-www.example.com", registryRecords)
+	}
+	if owner := registryRecords[0].Labels[endpoint.OwnerLabelKey]; owner != "cluster" {
+		t.Errorf("RegistryEndpoints() registry record owner = %q, want cluster", owner)
+	}
+}
@@ -0,0 +1,197 @@
+package provider
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nrdcg/desec"
+	log "github.com/sirupsen/logrus"
+)
+
+// Statuses of the zones and RRsets of an apply
+const (
+	ResultApplied = "applied"
+	ResultSkipped = "skipped"
+	ResultFailed  = "failed"
+)
+
+// Statuses of an apply
+const (
+	// ApplyComplete is an apply of every zone
+	ApplyComplete = "complete"
+	// ApplyPartial is an apply with some zones applied and others not
+	ApplyPartial = "partial"
+	// ApplyFailed is an apply without any zone applied
+	ApplyFailed = "failed"
+)
+
+// Reasons of skipped RRsets
+const (
+	reasonNotSent   = "not sent after an earlier failure in the zone"
+	reasonDryRun    = "dry run"
+	reasonUnchanged = "unchanged"
+
+	reasonWrittenEarlier = "already in deSEC, written by an earlier attempt"
+)
+
+// RRSetResult is the outcome of the change of an RRset
+type RRSetResult struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ZoneResult is the outcome of the changes of a zone
+type ZoneResult struct {
+	Zone   string        `json:"zone"`
+	Status string        `json:"status"`
+	Error  string        `json:"error,omitempty"`
+	RRSets []RRSetResult `json:"rrsets"`
+
+	// index is the position of every RRset in RRSets
+	index map[rrsetKey]int
+}
+
+// ApplyResult is the outcome of an ApplyChanges
+type ApplyResult struct {
+	StartedAt time.Time `json:"startedAt"`
+	Status    string    `json:"status"`
+	// Error is set when the changes failed before reaching the zones
+	Error string       `json:"error,omitempty"`
+	Zones []ZoneResult `json:"zones"`
+}
+
+// PartialApplyError is returned when some zones were applied and others
+// failed or were not applied
+type PartialApplyError struct {
+	Result *ApplyResult
+	// Err is the error of the first zone that failed
+	Err error
+}
+
+func (e *PartialApplyError) Error() string {
+	failed := 0
+	for _, zone := range e.Result.Zones {
+		if zone.Status != ResultApplied {
+			failed++
+		}
+	}
+	return fmt.Sprintf("%d of %d zones not applied: %v", failed, len(e.Result.Zones), e.Err)
+}
+
+func (e *PartialApplyError) Unwrap() error {
+	return e.Err
+}
+
+// newZoneResult returns the result of the changes of a zone, with every RRset
+// skipped until its outcome is known
+func newZoneResult(zone string, zc *zoneChanges) *ZoneResult {
+	result := &ZoneResult{Zone: zone, RRSets: []RRSetResult{}, index: make(map[rrsetKey]int)}
+	changes := []struct {
+		action string
+		rrsets []desec.RRSet
+	}{{"create", zc.create}, {"update", zc.update}, {"delete", zc.delete}}
+	for _, change := range changes {
+		for _, rrset := range change.rrsets {
+			result.index[rrsetKey{subname: rrset.SubName, recordType: rrset.Type}] = len(result.RRSets)
+			result.RRSets = append(result.RRSets, RRSetResult{
+				Name:   rrsetName(rrset.SubName, zone),
+				Type:   rrset.Type,
+				Action: change.action,
+				Status: ResultSkipped,
+				Reason: reasonNotSent,
+			})
+		}
+	}
+	return result
+}
+
+// set records the outcome of RRsets of the zone. A nil result records nothing.
+func (r *ZoneResult) set(rrsets []desec.RRSet, status, reason string) {
+	if r == nil {
+		return
+	}
+	for _, rrset := range rrsets {
+		if i, ok := r.index[rrsetKey{subname: rrset.SubName, recordType: rrset.Type}]; ok {
+			r.RRSets[i].Status = status
+			r.RRSets[i].Reason = reason
+		}
+	}
+}
+
+// skip marks every RRset of the zone as skipped
+func (r *ZoneResult) skip(reason string) {
+	r.Status = ResultSkipped
+	for i := range r.RRSets {
+		r.RRSets[i].Status = ResultSkipped
+		r.RRSets[i].Reason = reason
+	}
+}
+
+// count returns the number of RRsets with a status
+func (r *ZoneResult) count(status string) int {
+	count := 0
+	for _, rrset := range r.RRSets {
+		if rrset.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// finish sets the status of the apply from the ones of its zones and returns
+// its error: nil when complete, the first error of a zone when no zone was
+// applied, or else a PartialApplyError
+func (r *ApplyResult) finish(err error) error {
+	applied := 0
+	for _, zone := range r.Zones {
+		if zone.Status == ResultApplied {
+			applied++
+		}
+	}
+	switch {
+	case err == nil:
+		r.Status = ApplyComplete
+	case applied == 0:
+		r.Status = ApplyFailed
+		if len(r.Zones) == 0 {
+			r.Error = err.Error()
+		}
+	default:
+		r.Status = ApplyPartial
+		err = &PartialApplyError{Result: r, Err: err}
+	}
+	r.log()
+	return err
+}
+
+// log logs the outcome of every zone and of the apply
+func (r *ApplyResult) log() {
+	applied := 0
+	for _, zone := range r.Zones {
+		message := fmt.Sprintf("zone %s %s: %d RRsets applied, %d skipped, %d failed", zone.Zone, zone.Status,
+			zone.count(ResultApplied), zone.count(ResultSkipped), zone.count(ResultFailed))
+		switch zone.Status {
+		case ResultFailed:
+			log.Errorf("%s: %s", message, zone.Error)
+		case ResultSkipped:
+			log.Warn(message)
+		default:
+			applied++
+			log.Debug(message)
+		}
+	}
+	if r.Status != ApplyComplete {
+		log.Warnf("apply %s: %d of %d zones applied", r.Status, applied, len(r.Zones))
+	}
+}
+
+// rrsetName returns the name of an RRset of a zone
+func rrsetName(subname, zone string) string {
+	if subname == "" {
+		return zone
+	}
+	return subname + "." + zone
+}
@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// zoneChangesOf returns changes creating www/A in every zone and updating
+// same/A in the last one, without changing it
+func zoneChangesOf(zones ...string) plan.Changes {
+	var changes plan.Changes
+	for _, zone := range zones {
+		changes.Create = append(changes.Create, &endpoint.Endpoint{DNSName: "www." + zone, RecordType: "A", RecordTTL: 3600, Targets: endpoint.Targets{"192.0.2.1"}})
+	}
+	same := &endpoint.Endpoint{DNSName: "same." + zones[len(zones)-1], RecordType: "A", RecordTTL: 3600, Targets: endpoint.Targets{"192.0.2.2"}}
+	changes.UpdateOld = []*endpoint.Endpoint{same}
+	changes.UpdateNew = []*endpoint.Endpoint{same}
+	return changes
+}
+
+// failZone fails the creations in a zone
+func failZone(zone string) func(r *http.Request) int {
+	return func(r *http.Request) int {
+		if r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/"+zone+"/") {
+			return http.StatusBadRequest
+		}
+		return 0
+	}
+}
+
+func TestApplyChangesResult(t *testing.T) {
+	zones := []string{"a.example", "b.example", "c.example"}
+	fake, srv := newFakeDesec(t, zones...)
+	fake.put("c.example", desec.RRSet{SubName: "same", Type: "A", TTL: 3600, Records: []string{"192.0.2.2"}})
+	fake.failWith(failZone("b.example"))
+	client := newTestClient(t, srv, config.Config{DomainFilters: zones, DefaultTTL: 3600})
+
+	if client.LastApply() != nil {
+		t.Fatal("LastApply() before any apply is not nil")
+	}
+	err := client.ApplyChanges(zoneChangesOf(zones...))
+	var partialErr *PartialApplyError
+	if !errors.As(err, &partialErr) || !errors.Is(err, ErrInvalid) {
+		t.Fatalf("ApplyChanges() error = %v, want a partial apply failed with %v", err, ErrInvalid)
+	}
+
+	result := client.LastApply()
+	if result != partialErr.Result || result.Status != ApplyPartial || len(result.Zones) != 3 {
+		t.Fatalf("LastApply() = %+v, want the partial result of 3 zones", result)
+	}
+	expected := []struct{ status, rrsetStatus, reason string }{
+		{ResultApplied, ResultApplied, ""},
+		{ResultFailed, ResultFailed, "create chunk 1/1 of b.example"},
+		{ResultSkipped, ResultSkipped, "not applied after zone b.example failed"},
+	}
+	for i, want := range expected {
+		zone := result.Zones[i]
+		if zone.Zone != zones[i] || zone.Status != want.status {
+			t.Errorf("zone %d = %s %s, want %s %s", i, zone.Zone, zone.Status, zones[i], want.status)
+		}
+		rrset := zone.RRSets[0]
+		if rrset.Name != "www."+zones[i] || rrset.Action != "create" || rrset.Status != want.rrsetStatus || !strings.HasPrefix(rrset.Reason, want.reason) {
+			t.Errorf("zone %s RRset = %+v, want %s with reason %q", zones[i], rrset, want.rrsetStatus, want.reason)
+		}
+	}
+	if _, ok := fake.get("c.example", "www", "A"); ok {
+		t.Error("www.c.example/A was created after the failure of b.example")
+	}
+}
+
+func TestApplyChangesPartialApply(t *testing.T) {
+	zones := []string{"a.example", "b.example", "c.example"}
+	fake, srv := newFakeDesec(t, zones...)
+	fake.put("c.example", desec.RRSet{SubName: "same", Type: "A", TTL: 3600, Records: []string{"192.0.2.2"}})
+	fake.failWith(failZone("a.example"))
+	client := newTestClient(t, srv, config.Config{DomainFilters: zones, DefaultTTL: 3600, PartialApply: true})
+
+	err := client.ApplyChanges(zoneChangesOf(zones...))
+	var partialErr *PartialApplyError
+	if !errors.As(err, &partialErr) {
+		t.Fatalf("ApplyChanges() error = %v, want a partial apply", err)
+	}
+	for _, zone := range zones[1:] {
+		if _, ok := fake.get(zone, "www", "A"); !ok {
+			t.Errorf("www.%s/A was not created", zone)
+		}
+	}
+
+	result := client.LastApply()
+	statuses := []string{result.Zones[0].Status, result.Zones[1].Status, result.Zones[2].Status}
+	if statuses[0] != ResultFailed || statuses[1] != ResultApplied || statuses[2] != ResultApplied {
+		t.Errorf("zone statuses = %v, want failed, applied, applied", statuses)
+	}
+	if same := result.Zones[2].RRSets[1]; same.Action != "update" || same.Status != ResultSkipped || same.Reason != reasonUnchanged {
+		t.Errorf("unchanged update = %+v, want skipped as unchanged", same)
+	}
+
+	// Once every zone is applied the apply is complete
+	fake.failWith(nil)
+	if err := client.ApplyChanges(zoneChangesOf("a.example")); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if result := client.LastApply(); result.Status != ApplyComplete {
+		t.Errorf("LastApply() status = %s, want %s", result.Status, ApplyComplete)
+	}
+
+	// Failing every zone is not a partial apply
+	fake.failWith(failZone("b.example"))
+	err = client.ApplyChanges(plan.Changes{Create: zoneChangesOf("b.example").Create})
+	if errors.As(err, &partialErr) || !errors.Is(err, ErrInvalid) {
+		t.Errorf("ApplyChanges() error = %v, want %v", err, ErrInvalid)
+	}
+	if result := client.LastApply(); result.Status != ApplyFailed {
+		t.Errorf("LastApply() status = %s, want %s", result.Status, ApplyFailed)
+	}
+}
@@ -0,0 +1,296 @@
+package provider
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/nrdcg/desec"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// setOwnershipSubname is the TXT RRset holding, for every zone, which targets of
+// an RRset belong to which set identifier. It is hidden from external-dns.
+const setOwnershipSubname = "_external-dns-sets"
+
+// rrsetKey identifies an RRset inside a zone
+type rrsetKey struct {
+	subname    string
+	recordType string
+}
+
+// setTargets maps set identifiers to the targets they own in an RRset. The
+// empty identifier holds the records that no set owns.
+type setTargets map[string]endpoint.Targets
+
+// setOwnership holds the set identifiers of every RRset of a zone
+type setOwnership map[rrsetKey]setTargets
+
+// isSetOwnershipRRSet reports whether an RRset is the ownership metadata of its zone
+func isSetOwnershipRRSet(rrset *desec.RRSet) bool {
+	return rrset.SubName == setOwnershipSubname && rrset.Type == endpoint.RecordTypeTXT
+}
+
+// parseSetOwnership reads the ownership metadata from the RRsets of a zone.
+// Every metadata record is a URL encoded query, e.g.
+// "name=www&set=eu&target=192.0.2.1&target=192.0.2.2&type=A".
+func parseSetOwnership(rrsets []desec.RRSet) setOwnership {
+	ownership := make(setOwnership)
+	for i := range rrsets {
+		if !isSetOwnershipRRSet(&rrsets[i]) {
+			continue
+		}
+		for _, record := range rrsets[i].Records {
+			values, err := url.ParseQuery(txtContent(record))
+			if err != nil || values.Get("set") == "" || values.Get("type") == "" {
+				log.Warnf("ignoring invalid set ownership record %s", record)
+				continue
+			}
+			key := rrsetKey{subname: values.Get("name"), recordType: values.Get("type")}
+			if ownership[key] == nil {
+				ownership[key] = make(setTargets)
+			}
+			ownership[key][values.Get("set")] = canonicalTargets(key.recordType, values["target"])
+		}
+	}
+	return ownership
+}
+
+// records renders the ownership metadata, sorted, leaving out unowned records
+func (o setOwnership) records() []string {
+	var records []string
+	for key, sets := range o {
+		for set, targets := range sets {
+			if set == "" || len(targets) == 0 {
+				continue
+			}
+			values := url.Values{
+				"name":   {key.subname},
+				"type":   {key.recordType},
+				"set":    {set},
+				"target": targets,
+			}
+			records = append(records, txtRecord(values.Encode()))
+		}
+	}
+	slices.Sort(records)
+	return records
+}
+
+// withUnowned returns the sets of an RRset, adding the records no set owns
+// under the empty identifier
+func (o setOwnership) withUnowned(key rrsetKey, records []string) setTargets {
+	sets := make(setTargets)
+	owned := make(map[string]bool)
+	for set, targets := range o[key] {
+		sets[set] = targets
+		for _, target := range targets {
+			owned[target] = true
+		}
+	}
+	var unowned endpoint.Targets
+	for _, target := range canonicalTargets(key.recordType, records) {
+		if !owned[target] {
+			unowned = append(unowned, target)
+		}
+	}
+	if len(unowned) > 0 {
+		sets[""] = unowned
+	}
+	return sets
+}
+
+// splitRRSet converts an RRset to one endpoint per set identifier owning some
+// of its records, plus one endpoint without identifier for the rest
+func splitRRSet(rrset *desec.RRSet, domain string, ownership setOwnership) []*endpoint.Endpoint {
+	key := rrsetKey{subname: rrset.SubName, recordType: rrset.Type}
+	if len(ownership[key]) == 0 {
+		return []*endpoint.Endpoint{convertRRSetToEndpoint(rrset, domain)}
+	}
+
+	present := make(map[string]bool)
+	for _, target := range canonicalTargets(rrset.Type, rrset.Records) {
+		present[target] = true
+	}
+
+	sets := ownership.withUnowned(key, rrset.Records)
+	endpoints := make([]*endpoint.Endpoint, 0, len(sets))
+	for _, set := range slices.Sorted(maps.Keys(sets)) {
+		var targets endpoint.Targets
+		for _, target := range sets[set] {
+			// Records removed outside of external-dns are not reported
+			if present[target] {
+				targets = append(targets, target)
+			}
+		}
+		if len(targets) == 0 {
+			continue
+		}
+		ep := convertRRSetToEndpoint(rrset, domain)
+		ep.SetIdentifier = set
+		ep.Targets = targets
+		endpoints = append(endpoints, ep)
+	}
+	return endpoints
+}
+
+// splitSetIdentifierChanges separates the changes to RRsets shared by set
+// identifiers, which have to be merged, from the others. Endpoints without
+// identifier go with the merged changes when they target such an RRset.
+func (d *DesecClient) splitSetIdentifierChanges(changes plan.Changes) (plain, merged plan.Changes) {
+	type zoneKey struct {
+		domain string
+		rrsetKey
+	}
+	keyOf := func(ep *endpoint.Endpoint) zoneKey {
+		domain := findMatchingDomain(ep.DNSName, d.domainFilters)
+		return zoneKey{domain: domain, rrsetKey: rrsetKey{
+			subname:    extractSubname(normalizeName(ep.DNSName), domain),
+			recordType: ep.RecordType,
+		}}
+	}
+
+	shared := make(map[zoneKey]bool)
+	for _, eps := range [][]*endpoint.Endpoint{changes.Create, changes.UpdateOld, changes.UpdateNew, changes.Delete} {
+		for _, ep := range eps {
+			if ep != nil && ep.SetIdentifier != "" {
+				shared[keyOf(ep)] = true
+			}
+		}
+	}
+
+	split := func(eps []*endpoint.Endpoint) (plain, merged []*endpoint.Endpoint) {
+		for _, ep := range eps {
+			if ep != nil && shared[keyOf(ep)] {
+				merged = append(merged, ep)
+			} else {
+				plain = append(plain, ep)
+			}
+		}
+		return plain, merged
+	}
+	plain.Create, merged.Create = split(changes.Create)
+	plain.UpdateOld, merged.UpdateOld = split(changes.UpdateOld)
+	plain.UpdateNew, merged.UpdateNew = split(changes.UpdateNew)
+	plain.Delete, merged.Delete = split(changes.Delete)
+	return plain, merged
+}
+
+// mergeSetIdentifierChanges computes the RRsets shared by set identifiers from
+// their current records and ownership metadata, and adds their writes, along
+// with the updated metadata, to the changes of their zone.
+func (d *DesecClient) mergeSetIdentifierChanges(changes plan.Changes, zone func(domain string) *zoneChanges) error {
+	removed := d.mapEndpointsByHostname(slices.Concat(changes.UpdateOld, changes.Delete))
+	added := d.mapEndpointsByHostname(slices.Concat(changes.Create, changes.UpdateNew))
+	domains := slices.Sorted(maps.Keys(removed))
+	for domain := range added {
+		if _, ok := removed[domain]; !ok {
+			domains = append(domains, domain)
+		}
+	}
+	slices.Sort(domains)
+
+	for _, domain := range domains {
+		rrsets, err := d.GetRecords(domain)
+		if err != nil {
+			log.Errorf("failed to fetch records for domain %s: %v", domain, err)
+			return err
+		}
+		current := make(map[rrsetKey]desec.RRSet, len(rrsets))
+		for _, rrset := range rrsets {
+			current[rrsetKey{subname: rrset.SubName, recordType: rrset.Type}] = rrset
+		}
+		ownership := parseSetOwnership(rrsets)
+
+		keyOf := func(ep *endpoint.Endpoint) rrsetKey {
+			return rrsetKey{subname: extractSubname(normalizeName(ep.DNSName), domain), recordType: ep.RecordType}
+		}
+		merged := make(map[rrsetKey]setTargets)
+		ttls := make(map[rrsetKey]int)
+		setsOf := func(key rrsetKey) setTargets {
+			if merged[key] == nil {
+				merged[key] = ownership.withUnowned(key, current[key].Records)
+			}
+			return merged[key]
+		}
+		for _, ep := range removed[domain] {
+			delete(setsOf(keyOf(ep)), ep.SetIdentifier)
+		}
+		for _, ep := range added[domain] {
+			key := keyOf(ep)
+			rrset := d.convertEndpoint(ep, domain)
+			setsOf(key)[ep.SetIdentifier] = canonicalTargets(ep.RecordType, ep.Targets)
+			ttls[key] = rrset.TTL
+		}
+
+		zc := zone(domain)
+		for _, key := range slices.SortedFunc(maps.Keys(merged), compareRRSetKeys) {
+			sets := merged[key]
+			var targets endpoint.Targets
+			for _, set := range slices.Sorted(maps.Keys(sets)) {
+				targets = append(targets, sets[set]...)
+			}
+			targets = canonicalTargets(key.recordType, targets)
+			if key.recordType == endpoint.RecordTypeCNAME && len(targets) > 1 {
+				return fmt.Errorf("set identifiers of CNAME %s disagree on the target: %v", key.subname, targets)
+			}
+
+			ttl, ok := ttls[key]
+			if !ok {
+				ttl = current[key].TTL
+			}
+			rrset := desec.RRSet{SubName: key.subname, Type: key.recordType, TTL: ttl, Records: make([]string, len(targets))}
+			for i, target := range targets {
+				rrset.Records[i] = recordText(key.recordType, target)
+			}
+			log.Debugf("merged %d set identifiers into rrset %s/%s: %v", len(sets), key.subname, key.recordType, targets)
+
+			_, exists := current[key]
+			switch {
+			case len(targets) == 0 && exists:
+				zc.delete = append(zc.delete, rrset)
+			case len(targets) == 0:
+			case exists:
+				zc.update = append(zc.update, rrset)
+			default:
+				zc.create = append(zc.create, rrset)
+			}
+
+			delete(sets, "")
+			if len(sets) > 0 {
+				ownership[key] = sets
+			} else {
+				delete(ownership, key)
+			}
+		}
+
+		// Persist the ownership metadata when it changed
+		metadataKey := rrsetKey{subname: setOwnershipSubname, recordType: endpoint.RecordTypeTXT}
+		metadata := desec.RRSet{SubName: setOwnershipSubname, Type: endpoint.RecordTypeTXT, TTL: d.ttlFor(domain, setOwnershipSubname+"."+domain, endpoint.RecordTypeTXT, 0), Records: ownership.records()}
+		previous, exists := current[metadataKey]
+		if slices.Equal(metadata.Records, slices.Sorted(slices.Values(previous.Records))) {
+			continue
+		}
+		switch {
+		case len(metadata.Records) == 0:
+			zc.delete = append(zc.delete, metadata)
+		case exists:
+			zc.update = append(zc.update, metadata)
+		default:
+			zc.create = append(zc.create, metadata)
+		}
+	}
+	return nil
+}
+
+// compareRRSetKeys orders RRsets by subname, then type
+func compareRRSetKeys(a, b rrsetKey) int {
+	if c := strings.Compare(a.subname, b.subname); c != 0 {
+		return c
+	}
+	return strings.Compare(a.recordType, b.recordType)
+}
@@ -0,0 +1,158 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestSetOwnershipRoundTrip(t *testing.T) {
+	ownership := setOwnership{
+		{subname: "www", recordType: "A"}: {
+			"eu": endpoint.Targets{"192.0.2.1", "192.0.2.2"},
+			"us": endpoint.Targets{"192.0.2.3"},
+			"":   endpoint.Targets{"192.0.2.9"},
+		},
+		{subname: "", recordType: "TXT"}: {
+			"eu": endpoint.Targets{"heritage=external-dns,external-dns/owner=eu"},
+		},
+	}
+
+	records := ownership.records()
+	if len(records) != 3 {
+		t.Fatalf("records() = %v, want 3 records without the unowned targets", records)
+	}
+
+	parsed := parseSetOwnership([]desec.RRSet{
+		{SubName: setOwnershipSubname, Type: "TXT", Records: append(records, `"not a valid ownership record"`)},
+	})
+	delete(ownership[rrsetKey{subname: "www", recordType: "A"}], "")
+	if !reflect.DeepEqual(parsed, ownership) {
+		t.Errorf("parseSetOwnership() = %v, want %v", parsed, ownership)
+	}
+}
+
+func TestSplitRRSet(t *testing.T) {
+	ownership := setOwnership{
+		{subname: "www", recordType: "A"}: {
+			"eu": endpoint.Targets{"192.0.2.1", "192.0.2.2"},
+			"us": endpoint.Targets{"192.0.2.3"},
+		},
+	}
+	rrset := &desec.RRSet{
+		SubName: "www",
+		Type:    "A",
+		TTL:     3600,
+		// 192.0.2.3 was removed outside of external-dns, 192.0.2.9 is not owned by any set
+		Records: []string{"192.0.2.1", "192.0.2.2", "192.0.2.9"},
+	}
+
+	endpoints := splitRRSet(rrset, "example.com", ownership)
+	expected := []*endpoint.Endpoint{
+		{DNSName: "www.example.com.", RecordType: "A", Targets: endpoint.Targets{"192.0.2.9"}, RecordTTL: 3600},
+		{DNSName: "www.example.com.", RecordType: "A", SetIdentifier: "eu", Targets: endpoint.Targets{"192.0.2.1", "192.0.2.2"}, RecordTTL: 3600},
+	}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("splitRRSet() = %v, want %v", endpoints, expected)
+	}
+}
+
+func TestApplyChangesMergesSetIdentifiers(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	fake.put("example.com", desec.RRSet{SubName: "www", Type: "A", TTL: 3600, Records: []string{"192.0.2.9"}})
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600})
+
+	eu := &endpoint.Endpoint{DNSName: "www.example.com", RecordType: "A", SetIdentifier: "eu", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 3600}
+	us := &endpoint.Endpoint{DNSName: "www.example.com", RecordType: "A", SetIdentifier: "us", Targets: endpoint.Targets{"192.0.2.2", "192.0.2.1"}, RecordTTL: 3600}
+	if err := client.ApplyChanges(plan.Changes{Create: []*endpoint.Endpoint{eu, us}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	rrset, _ := fake.get("example.com", "www", "A")
+	if expected := []string{"192.0.2.9", "192.0.2.1", "192.0.2.2"}; !reflect.DeepEqual(rrset.Records, expected) {
+		t.Errorf("merged records = %v, want %v", rrset.Records, expected)
+	}
+	if _, ok := fake.get("example.com", setOwnershipSubname, "TXT"); !ok {
+		t.Fatalf("ownership metadata was not created")
+	}
+
+	endpoints, err := client.GetEndpoints("example.com")
+	if err != nil {
+		t.Fatalf("GetEndpoints() error = %v", err)
+	}
+	expected := []*endpoint.Endpoint{
+		{DNSName: "www.example.com.", RecordType: "A", Targets: endpoint.Targets{"192.0.2.9"}, RecordTTL: 3600},
+		{DNSName: "www.example.com.", RecordType: "A", SetIdentifier: "eu", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 3600},
+		{DNSName: "www.example.com.", RecordType: "A", SetIdentifier: "us", Targets: endpoint.Targets{"192.0.2.2", "192.0.2.1"}, RecordTTL: 3600},
+	}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("GetEndpoints() = %v, want %v", endpoints, expected)
+	}
+
+	// 192.0.2.1 is still owned by eu
+	if err := client.ApplyChanges(plan.Changes{Delete: []*endpoint.Endpoint{us}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	rrset, _ = fake.get("example.com", "www", "A")
+	if expected := []string{"192.0.2.9", "192.0.2.1"}; !reflect.DeepEqual(rrset.Records, expected) {
+		t.Errorf("records after deleting us = %v, want %v", rrset.Records, expected)
+	}
+
+	// Removing the last set drops the metadata, the unowned record stays
+	if err := client.ApplyChanges(plan.Changes{Delete: []*endpoint.Endpoint{eu}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	rrset, _ = fake.get("example.com", "www", "A")
+	if !reflect.DeepEqual(rrset.Records, []string{"192.0.2.9"}) {
+		t.Errorf("records after deleting eu = %v, want [192.0.2.9]", rrset.Records)
+	}
+	if _, ok := fake.get("example.com", setOwnershipSubname, "TXT"); ok {
+		t.Errorf("ownership metadata was not deleted")
+	}
+
+	endpoints, err = client.GetEndpoints("example.com")
+	if err != nil {
+		t.Fatalf("GetEndpoints() error = %v", err)
+	}
+	if !reflect.DeepEqual(endpoints, []*endpoint.Endpoint{{DNSName: "www.example.com.", RecordType: "A", Targets: endpoint.Targets{"192.0.2.9"}, RecordTTL: 3600}}) {
+		t.Errorf("GetEndpoints() = %v, want only the unowned record", endpoints)
+	}
+}
+
+func TestApplyChangesUpdatesSetIdentifier(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600})
+
+	old := &endpoint.Endpoint{DNSName: "app.example.com", RecordType: "AAAA", SetIdentifier: "blue", Targets: endpoint.Targets{"2001:db8::1"}, RecordTTL: 3600}
+	other := &endpoint.Endpoint{DNSName: "app.example.com", RecordType: "AAAA", SetIdentifier: "green", Targets: endpoint.Targets{"2001:db8::2"}, RecordTTL: 3600}
+	if err := client.ApplyChanges(plan.Changes{Create: []*endpoint.Endpoint{old, other}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	updated := &endpoint.Endpoint{DNSName: "app.example.com", RecordType: "AAAA", SetIdentifier: "blue", Targets: endpoint.Targets{"2001:db8::3"}, RecordTTL: 7200}
+	if err := client.ApplyChanges(plan.Changes{UpdateOld: []*endpoint.Endpoint{old}, UpdateNew: []*endpoint.Endpoint{updated}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	rrset, _ := fake.get("example.com", "app", "AAAA")
+	if expected := []string{"2001:db8::3", "2001:db8::2"}; !reflect.DeepEqual(rrset.Records, expected) || rrset.TTL != 7200 {
+		t.Errorf("updated rrset = %v (ttl %d), want %v (ttl 7200)", rrset.Records, rrset.TTL, expected)
+	}
+}
+
+func TestApplyChangesRejectsDivergingCNAMESets(t *testing.T) {
+	_, srv := newFakeDesec(t, "example.com")
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600})
+
+	err := client.ApplyChanges(plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "lb.example.com", RecordType: "CNAME", SetIdentifier: "eu", Targets: endpoint.Targets{"eu.lb.example.net"}},
+		{DNSName: "lb.example.com", RecordType: "CNAME", SetIdentifier: "us", Targets: endpoint.Targets{"us.lb.example.net"}},
+	}})
+	if err == nil {
+		t.Errorf("ApplyChanges() expected an error for a CNAME with two targets")
+	}
+}
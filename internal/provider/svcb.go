@@ -0,0 +1,270 @@
+package provider
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	recordTypeSVCB  = "SVCB"
+	recordTypeHTTPS = "HTTPS"
+)
+
+// svcParamKeys maps the SvcParamKey names registered by RFC 9460 to their numbers.
+// Parameters are always rendered in ascending key number order.
+var svcParamKeys = map[string]uint16{
+	"mandatory":       0,
+	"alpn":            1,
+	"no-default-alpn": 2,
+	"port":            3,
+	"ipv4hint":        4,
+	"ech":             5,
+	"ipv6hint":        6,
+	"dohpath":         7,
+	"ohttp":           8,
+}
+
+// svcParam is a single SvcParam of a SVCB or HTTPS record
+type svcParam struct {
+	key      uint16
+	value    string
+	hasValue bool
+}
+
+// parseSVCB parses "<priority> <target> [<key>[=<value>] ...]" as defined in
+// RFC 9460, for both SVCB and HTTPS records. Parameters are sorted by key, their
+// values normalized and the target made fully qualified.
+func parseSVCB(target string) (string, error) {
+	fields := strings.Fields(target)
+	if len(fields) < 2 {
+		return "", fmt.Errorf("expected \"<priority> <target> [<params>]\"")
+	}
+	priority, err := parseUint16("priority", fields[0])
+	if err != nil {
+		return "", err
+	}
+	host, err := parseTargetHostname(fields[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid target: %w", err)
+	}
+
+	// Skip priority and target, parameter values may contain quoted whitespace
+	rest := strings.TrimSpace(target)
+	for range 2 {
+		if i := strings.IndexAny(rest, " \t"); i >= 0 {
+			rest = strings.TrimSpace(rest[i:])
+		} else {
+			rest = ""
+		}
+	}
+	params, err := parseSvcParams(rest)
+	if err != nil {
+		return "", err
+	}
+
+	if priority == "0" {
+		if len(params) > 0 {
+			return "", fmt.Errorf("AliasMode records (priority 0) must not have parameters")
+		}
+		return priority + " " + host, nil
+	}
+	if err := validateSvcParams(params); err != nil {
+		return "", err
+	}
+
+	parts := []string{priority, host}
+	for _, param := range params {
+		parts = append(parts, formatSvcParam(param))
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// parseSvcParams parses whitespace separated SvcParams, with optionally quoted values
+func parseSvcParams(text string) ([]svcParam, error) {
+	var params []svcParam
+	seen := make(map[uint16]bool)
+	i := 0
+	for {
+		for i < len(text) && isSpace(text[i]) {
+			i++
+		}
+		if i == len(text) {
+			break
+		}
+
+		start := i
+		for i < len(text) && !isSpace(text[i]) && text[i] != '=' {
+			i++
+		}
+		key, err := parseSvcParamKey(text[start:i])
+		if err != nil {
+			return nil, err
+		}
+		param := svcParam{key: key}
+
+		if i < len(text) && text[i] == '=' {
+			i++
+			param.hasValue = true
+			if i < len(text) && text[i] == '"' {
+				value, next, err := readCharacterString(text, i)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value for %s: %w", svcParamKeyName(key), err)
+				}
+				param.value = value
+				i = next
+			} else {
+				start := i
+				for i < len(text) && !isSpace(text[i]) {
+					i++
+				}
+				param.value = text[start:i]
+			}
+		}
+
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate parameter %s", svcParamKeyName(key))
+		}
+		seen[key] = true
+		params = append(params, param)
+	}
+
+	slices.SortFunc(params, func(a, b svcParam) int { return int(a.key) - int(b.key) })
+	return params, nil
+}
+
+// parseSvcParamKey accepts registered key names and the generic keyNNNNN form
+func parseSvcParamKey(name string) (uint16, error) {
+	name = strings.ToLower(name)
+	if key, ok := svcParamKeys[name]; ok {
+		return key, nil
+	}
+	if number, ok := strings.CutPrefix(name, "key"); ok {
+		key, err := strconv.ParseUint(number, 10, 16)
+		if err == nil && key != 65535 {
+			return uint16(key), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown parameter %q", name)
+}
+
+// svcParamKeyName returns the registered name of a key, or its generic keyNNNNN form
+func svcParamKeyName(key uint16) string {
+	for name, number := range svcParamKeys {
+		if number == key {
+			return name
+		}
+	}
+	return fmt.Sprintf("key%d", key)
+}
+
+// validateSvcParams checks and normalizes the value of every parameter in place
+func validateSvcParams(params []svcParam) error {
+	present := make(map[uint16]bool, len(params))
+	for _, param := range params {
+		present[param.key] = true
+	}
+
+	for i := range params {
+		param := &params[i]
+		name := svcParamKeyName(param.key)
+
+		switch {
+		case name == "no-default-alpn" || name == "ohttp":
+			if param.hasValue {
+				return fmt.Errorf("%s does not take a value", name)
+			}
+			if name == "no-default-alpn" && !present[svcParamKeys["alpn"]] {
+				return fmt.Errorf("%s requires alpn", name)
+			}
+			continue
+		case strings.HasPrefix(name, "key"):
+			// Unregistered keys carry opaque values
+			continue
+		case param.value == "":
+			return fmt.Errorf("%s requires a value", name)
+		}
+
+		switch name {
+		case "mandatory":
+			var keys []uint16
+			for _, item := range strings.Split(param.value, ",") {
+				key, err := parseSvcParamKey(item)
+				if err != nil {
+					return fmt.Errorf("invalid mandatory key: %w", err)
+				}
+				if key == svcParamKeys["mandatory"] {
+					return fmt.Errorf("mandatory must not list itself")
+				}
+				if !present[key] {
+					return fmt.Errorf("mandatory key %s is missing", svcParamKeyName(key))
+				}
+				if slices.Contains(keys, key) {
+					return fmt.Errorf("duplicate mandatory key %s", svcParamKeyName(key))
+				}
+				keys = append(keys, key)
+			}
+			slices.Sort(keys)
+			names := make([]string, len(keys))
+			for j, key := range keys {
+				names[j] = svcParamKeyName(key)
+			}
+			param.value = strings.Join(names, ",")
+		case "alpn":
+			for _, id := range strings.Split(param.value, ",") {
+				if id == "" || len(id) > maxCharacterStringLength || strings.ContainsAny(id, "\\ \t") {
+					return fmt.Errorf("invalid alpn identifier %q", id)
+				}
+			}
+		case "port":
+			port, err := parseUint16("port", param.value)
+			if err != nil {
+				return err
+			}
+			param.value = port
+		case "ipv4hint", "ipv6hint":
+			items := strings.Split(param.value, ",")
+			for j, item := range items {
+				var err error
+				if name == "ipv4hint" {
+					items[j], err = parseA(item)
+				} else {
+					items[j], err = parseAAAA(item)
+				}
+				if err != nil {
+					return fmt.Errorf("invalid %s %q: %w", name, item, err)
+				}
+			}
+			param.value = strings.Join(items, ",")
+		case "ech":
+			if _, err := base64.StdEncoding.DecodeString(param.value); err != nil {
+				return fmt.Errorf("ech is not valid base64")
+			}
+		case "dohpath":
+			if !strings.HasPrefix(param.value, "/") || !strings.Contains(param.value, "{?dns}") {
+				return fmt.Errorf("dohpath must be a relative URI template containing {?dns}")
+			}
+		}
+	}
+	return nil
+}
+
+// formatSvcParam renders a parameter, quoting its value only when needed
+func formatSvcParam(param svcParam) string {
+	name := svcParamKeyName(param.key)
+	if !param.hasValue {
+		return name
+	}
+	for i := 0; i < len(param.value); i++ {
+		c := param.value[i]
+		if c <= ' ' || c > '~' || c == '"' || c == '\\' {
+			return name + "=" + quoteCharacterString(param.value)
+		}
+	}
+	if param.value == "" {
+		return name + `=""`
+	}
+	return name + "=" + param.value
+}
@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestParseSVCB(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		expected    string
+		expectError bool
+	}{
+		{name: "AliasMode", target: "0 LB.Example.net", expected: "0 lb.example.net."},
+		{name: "ServiceMode without parameters", target: "1 .", expected: "1 ."},
+		{name: "alpn and hints", target: "1 . alpn=h2,h3 ipv4hint=192.0.2.1,192.0.2.2 ipv6hint=2001:DB8:0::1", expected: "1 . alpn=h2,h3 ipv4hint=192.0.2.1,192.0.2.2 ipv6hint=2001:db8::1"},
+		{name: "Parameters are sorted by key", target: "1 svc.example.net ipv6hint=2001:db8::1 port=8443 alpn=h2", expected: "1 svc.example.net. alpn=h2 port=8443 ipv6hint=2001:db8::1"},
+		{name: "Quoted values are unquoted", target: `1 . alpn="h2,h3" port="443"`, expected: "1 . alpn=h2,h3 port=443"},
+		{name: "Generic keys use registered names", target: "1 . key1=h2 key3=443", expected: "1 . alpn=h2 port=443"},
+		{name: "Unregistered key", target: "1 . key65000=foo key65001", expected: "1 . key65000=foo key65001"},
+		{name: "ech", target: "1 . ech=AEj+DQBEAQAgACBk", expected: "1 . ech=AEj+DQBEAQAgACBk"},
+		{name: "mandatory is normalized", target: "1 . mandatory=port,alpn alpn=h2 port=443", expected: "1 . mandatory=alpn,port alpn=h2 port=443"},
+		{name: "no-default-alpn", target: "1 . no-default-alpn alpn=h3", expected: "1 . alpn=h3 no-default-alpn"},
+		{name: "dohpath", target: "1 doh.example.net alpn=h2 dohpath=/dns-query{?dns}", expected: "1 doh.example.net. alpn=h2 dohpath=/dns-query{?dns}"},
+		{name: "Value with whitespace is quoted", target: `1 . key65000="a b"`, expected: `1 . key65000="a b"`},
+		{name: "AliasMode with parameters", target: "0 lb.example.net alpn=h2", expectError: true},
+		{name: "Duplicate parameter", target: "1 . alpn=h2 alpn=h3", expectError: true},
+		{name: "Unknown parameter", target: "1 . foo=bar", expectError: true},
+		{name: "Invalid ipv4hint", target: "1 . ipv4hint=2001:db8::1", expectError: true},
+		{name: "Invalid ipv6hint", target: "1 . ipv6hint=192.0.2.1", expectError: true},
+		{name: "Invalid port", target: "1 . port=70000", expectError: true},
+		{name: "Empty alpn", target: "1 . alpn=", expectError: true},
+		{name: "Empty alpn identifier", target: "1 . alpn=h2,,h3", expectError: true},
+		{name: "Invalid ech", target: "1 . ech=not*base64", expectError: true},
+		{name: "no-default-alpn without alpn", target: "1 . no-default-alpn", expectError: true},
+		{name: "no-default-alpn with value", target: "1 . alpn=h2 no-default-alpn=1", expectError: true},
+		{name: "mandatory lists missing key", target: "1 . mandatory=port alpn=h2", expectError: true},
+		{name: "mandatory lists itself", target: "1 . mandatory=mandatory", expectError: true},
+		{name: "Invalid dohpath", target: "1 . dohpath=https://example.net", expectError: true},
+		{name: "Invalid target", target: "1 bad_host!", expectError: true},
+		{name: "Missing target", target: "1", expectError: true},
+		{name: "Unterminated quoted value", target: `1 . alpn="h2`, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseSVCB(tt.target)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("parseSVCB(%q) = %q, expected error", tt.target, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSVCB(%q) unexpected error = %v", tt.target, err)
+			}
+			if result != tt.expected {
+				t.Errorf("parseSVCB(%q) = %q, want %q", tt.target, result, tt.expected)
+			}
+			if again, err := parseSVCB(result); err != nil || again != result {
+				t.Errorf("parseSVCB(%q) = %q, %v, want it unchanged", result, again, err)
+			}
+		})
+	}
+}
+
+// TestSVCBRoundTrip checks that HTTPS and SVCB records survive the conversion to
+// deSEC and back, whatever parameter order and quoting deSEC stores them with.
+func TestSVCBRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordType string
+		desired    string
+		stored     string
+	}{
+		{
+			name:       "HTTPS at apex",
+			recordType: "HTTPS",
+			desired:    "1 . ipv6hint=2001:db8::1 alpn=h3,h2 ipv4hint=192.0.2.1",
+			stored:     `1 . alpn="h3,h2" ipv4hint="192.0.2.1" ipv6hint="2001:db8::1"`,
+		},
+		{
+			name:       "HTTPS alias",
+			recordType: "HTTPS",
+			desired:    "0 lb.example.net",
+			stored:     "0 lb.example.net.",
+		},
+		{
+			name:       "SVCB with port",
+			recordType: "SVCB",
+			desired:    "2 svc.example.net port=8443 alpn=h2",
+			stored:     "2 svc.example.net. alpn=h2 port=8443",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := endpoint.Targets{canonicalTarget(tt.recordType, tt.desired)}
+
+			rrset := convertEndpointToRRSet(&endpoint.Endpoint{
+				DNSName:    "example.com",
+				RecordType: tt.recordType,
+				Targets:    endpoint.Targets{tt.desired},
+			}, "example.com", testTTLLimits)
+			if err := validateTarget(tt.recordType, rrset.Records[0]); err != nil {
+				t.Errorf("convertEndpointToRRSet() produced invalid record %q: %v", rrset.Records[0], err)
+			}
+
+			current := convertRRSetToEndpoint(&desec.RRSet{
+				Type:    tt.recordType,
+				Records: []string{tt.stored},
+				TTL:     3600,
+			}, "example.com")
+			if !reflect.DeepEqual(current.Targets, desired) {
+				t.Errorf("round trip targets = %v, want %v", current.Targets, desired)
+			}
+		})
+	}
+}
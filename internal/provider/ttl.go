@@ -0,0 +1,155 @@
+package provider
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	maximumTTL = 86400 // Maximum TTL accepted by deSEC
+
+	// zoneTTLRefreshInterval is how long the minimum TTLs of the zones are cached
+	zoneTTLRefreshInterval = time.Hour
+)
+
+// ttlLimits are the default, minimum and maximum TTL of a record
+type ttlLimits struct {
+	defaultTTL int
+	min        int
+	max        int
+}
+
+// clamp returns the TTL to store: the default TTL when ttl is unset, raised to
+// the minimum and lowered to the maximum
+func (limits ttlLimits) clamp(ttl endpoint.TTL) int {
+	result := int(ttl)
+	if ttl <= 0 {
+		result = limits.defaultTTL
+	}
+	return min(max(result, limits.min), limits.max)
+}
+
+// zoneMinimumTTL returns the minimum TTL deSEC reported for a zone, or
+// minimumTTL when the zone isn't known (yet)
+func (d *DesecClient) zoneMinimumTTL(zone string) int {
+	d.zoneMu.RLock()
+	defer d.zoneMu.RUnlock()
+	if minTTL, ok := d.zoneMinTTLs[normalizeName(zone)]; ok && minTTL > 0 {
+		return minTTL
+	}
+	return minimumTTL
+}
+
+// ttlLimits returns the TTL limits of a record in a zone along with a
+// description of where they come from. The most specific matching rule of the
+// TTL policy wins; the minimum TTL of the zone and the maximum TTL of deSEC
+// always apply.
+func (d *DesecClient) ttlLimits(zone, name, recordType string) (ttlLimits, string) {
+	zoneMin := d.zoneMinimumTTL(zone)
+	limits := ttlLimits{defaultTTL: d.defaultTTL, min: zoneMin, max: maximumTTL}
+	reason := fmt.Sprintf("default TTL %d, zone minimum %d", d.defaultTTL, zoneMin)
+
+	index, rule, ok := matchTTLRule(d.ttlPolicy, zone, name, recordType)
+	if !ok {
+		return limits, reason
+	}
+	if rule.Default > 0 {
+		limits.defaultTTL = rule.Default
+	}
+	if rule.Min > 0 {
+		limits.min = max(rule.Min, zoneMin)
+	}
+	if rule.Max > 0 {
+		limits.max = max(min(rule.Max, maximumTTL), limits.min)
+	}
+	return limits, fmt.Sprintf("TTL policy rule %d (%s), zone minimum %d", index, rule, zoneMin)
+}
+
+// storedTTLLimits returns the TTL limits of an endpoint adjusted by
+// AdjustEndpoints. The bounds of the TTL policy were already applied there, or
+// bypassed by a provider-specific TTL, so only the limits of the zone remain.
+func (d *DesecClient) storedTTLLimits(zone, name, recordType string) ttlLimits {
+	limits, _ := d.ttlLimits(zone, name, recordType)
+	limits.min, limits.max = d.zoneMinimumTTL(zone), maximumTTL
+	return limits
+}
+
+// ttlFor returns the TTL to store for ttl on a record in a zone
+func (d *DesecClient) ttlFor(zone, name, recordType string, ttl endpoint.TTL) int {
+	limits, _ := d.ttlLimits(zone, name, recordType)
+	return limits.clamp(ttl)
+}
+
+// matchTTLRule returns the most specific rule of the policy matching a record,
+// the first one when several are as specific. The name weighs more than the
+// record type, which weighs more than the zone, and exact names beat patterns.
+func matchTTLRule(policy config.TTLPolicy, zone, name, recordType string) (int, config.TTLRule, bool) {
+	zone, name = normalizeName(zone), normalizeName(name)
+
+	best, bestScore := -1, -1
+	for i, rule := range policy {
+		score := 0
+		if rule.Zone != "" {
+			if normalizeName(rule.Zone) != zone {
+				continue
+			}
+			score++
+		}
+		if rule.Type != "" {
+			if !strings.EqualFold(rule.Type, recordType) {
+				continue
+			}
+			score += 2
+		}
+		if rule.Name != "" {
+			pattern := normalizeName(rule.Name)
+			if matched, _ := path.Match(pattern, name); !matched {
+				continue
+			}
+			score += 4
+			if !strings.ContainsAny(pattern, `*?[\`) {
+				score += 4
+			}
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return 0, config.TTLRule{}, false
+	}
+	return best, policy[best], true
+}
+
+// cacheZoneTTLs remembers the minimum TTL of every domain
+func (d *DesecClient) cacheZoneTTLs(domains []desec.Domain) {
+	minTTLs := make(map[string]int, len(domains))
+	for _, domain := range domains {
+		minTTLs[normalizeName(domain.Name)] = domain.MinimumTTL
+	}
+	d.zoneMu.Lock()
+	d.zoneMinTTLs = minTTLs
+	d.zoneTTLsLoaded = time.Now()
+	d.zoneMu.Unlock()
+}
+
+// refreshZoneTTLs reloads the minimum TTLs of the zones once they are older
+// than zoneTTLRefreshInterval. The cached values are kept when it fails.
+func (d *DesecClient) refreshZoneTTLs() {
+	d.zoneMu.RLock()
+	fresh := time.Since(d.zoneTTLsLoaded) < zoneTTLRefreshInterval
+	d.zoneMu.RUnlock()
+	if fresh {
+		return
+	}
+	if _, err := d.GetDomains(); err != nil {
+		log.Warnf("failed to load the minimum TTLs of the zones: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// testTTLLimits are the TTL limits of a zone with the default minimum TTL
+var testTTLLimits = ttlLimits{defaultTTL: 3600, min: minimumTTL, max: maximumTTL}
+
+func TestClampTTL(t *testing.T) {
+	tests := []struct {
+		name       string
+		ttl        endpoint.TTL
+		defaultTTL int
+		minTTL     int
+		expected   int
+	}{
+		{name: "Unset TTL uses the default", ttl: 0, defaultTTL: 7200, minTTL: 3600, expected: 7200},
+		{name: "Default below the zone minimum", ttl: 0, defaultTTL: 300, minTTL: 3600, expected: 3600},
+		{name: "TTL below the zone minimum", ttl: 300, defaultTTL: 3600, minTTL: 3600, expected: 3600},
+		{name: "Low zone minimum", ttl: 300, defaultTTL: 3600, minTTL: 60, expected: 300},
+		{name: "TTL above the maximum", ttl: 604800, defaultTTL: 3600, minTTL: 3600, expected: maximumTTL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := ttlLimits{defaultTTL: tt.defaultTTL, min: tt.minTTL, max: maximumTTL}
+			if got := limits.clamp(tt.ttl); got != tt.expected {
+				t.Errorf("clamp() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMatchTTLRule(t *testing.T) {
+	policy := config.TTLPolicy{
+		{Default: 7200},
+		{Zone: "example.com", Type: "MX", Default: 86400},
+		{Name: "*.apps.example.com", Max: 60},
+		{Name: "*.apps.example.com", Type: "A", Default: 60},
+		{Name: "www.apps.example.com", Default: 300},
+		{Zone: "example.com", Type: "mx", Default: 43200},
+	}
+
+	tests := []struct {
+		name       string
+		zone       string
+		dnsName    string
+		recordType string
+		expected   int
+	}{
+		{name: "Catch-all rule", zone: "example.org", dnsName: "www.example.org", recordType: "A", expected: 0},
+		{name: "Zone and type, first of equal rules wins", zone: "example.com", dnsName: "example.com.", recordType: "MX", expected: 1},
+		{name: "Pattern", zone: "example.com", dnsName: "web.apps.example.com", recordType: "AAAA", expected: 2},
+		{name: "Pattern and type", zone: "example.com", dnsName: "web.apps.example.com", recordType: "A", expected: 3},
+		{name: "Exact name beats pattern and type", zone: "example.com", dnsName: "WWW.apps.example.com.", recordType: "A", expected: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, _, ok := matchTTLRule(policy, tt.zone, tt.dnsName, tt.recordType)
+			if !ok || index != tt.expected {
+				t.Errorf("matchTTLRule() = %d, %v, want rule %d", index, ok, tt.expected)
+			}
+		})
+	}
+
+	if _, _, ok := matchTTLRule(policy[1:], "example.org", "www.example.org", "A"); ok {
+		t.Error("matchTTLRule() matched a rule of another zone")
+	}
+}
+
+func TestTTLPolicyLimits(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	fake.setMinimumTTL("example.com", 60)
+	client := newTestClient(t, srv, config.Config{
+		DomainFilters: []string{"example.com"},
+		DefaultTTL:    3600,
+		TTLPolicy: config.TTLPolicy{
+			{Name: "*.apps.example.com", Type: "A", Default: 30, Max: 300},
+			{Zone: "example.com", Type: "MX", Min: 86400},
+		},
+	})
+	if _, err := client.GetDomains(); err != nil {
+		t.Fatalf("GetDomains() error = %v", err)
+	}
+
+	adjusted, err := client.AdjustEndpoints([]*endpoint.Endpoint{
+		{DNSName: "web.apps.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+		{DNSName: "api.apps.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 3600},
+		{DNSName: "example.com", RecordType: "MX", Targets: endpoint.Targets{"10 mail.example.com"}, RecordTTL: 3600},
+		{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+	})
+	if err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+	// The zone minimum applies to the default of the policy
+	for i, expected := range []endpoint.TTL{60, 300, 86400, 3600} {
+		if adjusted[i].RecordTTL != expected {
+			t.Errorf("AdjustEndpoints() TTL of %s/%s = %d, want %d", adjusted[i].DNSName, adjusted[i].RecordType, adjusted[i].RecordTTL, expected)
+		}
+	}
+}
+
+func TestZoneMinimumTTL(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com", "example.org")
+	fake.setMinimumTTL("example.org", 60)
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com", "example.org"}, DefaultTTL: 300})
+
+	// Unknown zones fall back to the deSEC default until the domains are listed
+	if got := client.zoneMinimumTTL("example.org"); got != minimumTTL {
+		t.Errorf("zoneMinimumTTL() before listing = %d, want %d", got, minimumTTL)
+	}
+	if _, err := client.GetEndpoints("example.org"); err != nil {
+		t.Fatalf("GetEndpoints() error = %v", err)
+	}
+
+	adjusted, err := client.AdjustEndpoints([]*endpoint.Endpoint{
+		{DNSName: "www.example.org", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+		{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 120},
+		{DNSName: "api.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 172800},
+	})
+	if err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+	for i, expected := range []endpoint.TTL{300, minimumTTL, maximumTTL} {
+		if adjusted[i].RecordTTL != expected {
+			t.Errorf("AdjustEndpoints() TTL of %s = %d, want %d", adjusted[i].DNSName, adjusted[i].RecordTTL, expected)
+		}
+	}
+
+	err = client.ApplyChanges(plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "low.example.org", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}, RecordTTL: 60},
+	}})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if rrset, ok := fake.get("example.org", "low", "A"); !ok || rrset.TTL != 60 {
+		t.Errorf("created RRset = %+v, want TTL 60", rrset)
+	}
+}
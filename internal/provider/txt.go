@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	recordTypeSPF = "SPF"
+
+	maxCharacterStringLength = 255 // Maximum length in bytes of a single TXT character-string
+)
+
+// txtContent returns the content of a TXT target. Targets already in presentation
+// format, a sequence of quoted character-strings like the ones generated by the
+// external-dns TXT registry, are unquoted and reassembled. Anything else is
+// taken literally.
+func txtContent(target string) string {
+	trimmed := strings.TrimSpace(target)
+	if !strings.HasPrefix(trimmed, `"`) || !strings.HasSuffix(trimmed, `"`) {
+		return target
+	}
+	strs, err := parseCharacterStrings(trimmed)
+	if err != nil {
+		return target
+	}
+	return strings.Join(strs, "")
+}
+
+// txtRecord renders TXT content as deSEC expects it: quoted character-strings
+// of at most 255 bytes each, separated by a space
+func txtRecord(content string) string {
+	if content == "" {
+		return `""`
+	}
+	var chunks []string
+	for len(content) > 0 {
+		size := min(len(content), maxCharacterStringLength)
+		chunks = append(chunks, quoteCharacterString(content[:size]))
+		content = content[size:]
+	}
+	return strings.Join(chunks, " ")
+}
+
+// parseCharacterStrings parses a sequence of RFC 1035 quoted character-strings
+// separated by whitespace, resolving \X and \DDD escapes
+func parseCharacterStrings(text string) ([]string, error) {
+	var strs []string
+	i := 0
+	for {
+		for i < len(text) && isSpace(text[i]) {
+			i++
+		}
+		if i == len(text) {
+			return strs, nil
+		}
+		if text[i] != '"' {
+			return nil, fmt.Errorf("expected '\"' at offset %d", i)
+		}
+		str, next, err := readCharacterString(text, i)
+		if err != nil {
+			return nil, err
+		}
+		strs = append(strs, str)
+		i = next
+	}
+}
+
+// readCharacterString reads the quoted character-string starting at text[start],
+// which must be a '"'. It returns the unescaped string and the offset right
+// after the closing quote.
+func readCharacterString(text string, start int) (string, int, error) {
+	var str []byte
+	i := start + 1
+	for i < len(text) {
+		c := text[i]
+		if c == '"' {
+			return string(str), i + 1, nil
+		}
+		if c != '\\' {
+			str = append(str, c)
+			i++
+			continue
+		}
+		if i+1 == len(text) {
+			return "", 0, fmt.Errorf("dangling escape at offset %d", i)
+		}
+		if isDigit(text[i+1]) {
+			if i+3 >= len(text) || !isDigit(text[i+2]) || !isDigit(text[i+3]) {
+				return "", 0, fmt.Errorf("invalid \\DDD escape at offset %d", i)
+			}
+			value, _ := strconv.Atoi(text[i+1 : i+4])
+			if value > 255 {
+				return "", 0, fmt.Errorf("invalid \\DDD escape at offset %d", i)
+			}
+			str = append(str, byte(value))
+			i += 4
+			continue
+		}
+		str = append(str, text[i+1])
+		i += 2
+	}
+	return "", 0, fmt.Errorf("unterminated character-string")
+}
+
+// quoteCharacterString renders a character-string in presentation format.
+// Quotes and backslashes are escaped, non-printable bytes use \DDD.
+func quoteCharacterString(str string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c > 0x7e:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestTXTContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		expected string
+	}{
+		{name: "Unquoted", target: "v=spf1 -all", expected: "v=spf1 -all"},
+		{name: "Quoted", target: `"v=spf1 -all"`, expected: "v=spf1 -all"},
+		{name: "Registry record", target: `"heritage=external-dns,external-dns/owner=default"`, expected: "heritage=external-dns,external-dns/owner=default"},
+		{name: "Multiple strings are reassembled", target: `"v=DKIM1; k=rsa; "  "p=MIGf"`, expected: "v=DKIM1; k=rsa; p=MIGf"},
+		{name: "Escaped quote and backslash", target: `"say \"hi\" \\o/"`, expected: `say "hi" \o/`},
+		{name: "Decimal escapes", target: `"caf\195\169"`, expected: "café"},
+		{name: "Empty string", target: `""`, expected: ""},
+		{name: "Quotes inside unquoted content", target: `say "hi"`, expected: `say "hi"`},
+		{name: "Unterminated string is taken literally", target: `"abc" "def`, expected: `"abc" "def`},
+		{name: "Invalid escape is taken literally", target: `"abc\9"`, expected: `"abc\9"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := txtContent(tt.target)
+			if result != tt.expected {
+				t.Errorf("txtContent(%q) = %q, want %q", tt.target, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTXTRecord(t *testing.T) {
+	long := strings.Repeat("a", 255) + strings.Repeat("b", 255) + "c"
+
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{name: "Short content", content: "v=spf1 -all", expected: `"v=spf1 -all"`},
+		{name: "Empty content", content: "", expected: `""`},
+		{name: "Escaping", content: `say "hi" \o/`, expected: `"say \"hi\" \\o/"`},
+		{name: "Non-ASCII bytes", content: "café", expected: `"caf\195\169"`},
+		{name: "Exactly 255 bytes", content: strings.Repeat("a", 255), expected: `"` + strings.Repeat("a", 255) + `"`},
+		{name: "Chunked at 255 bytes", content: long, expected: `"` + strings.Repeat("a", 255) + `" "` + strings.Repeat("b", 255) + `" "c"`},
+		{name: "Chunks count bytes, not escapes", content: strings.Repeat(`"`, 256), expected: `"` + strings.Repeat(`\"`, 255) + `" "\""`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := txtRecord(tt.content)
+			if result != tt.expected {
+				t.Errorf("txtRecord(%q) = %q, want %q", tt.content, result, tt.expected)
+			}
+			if back := txtContent(result); back != tt.content {
+				t.Errorf("txtContent(txtRecord(%q)) = %q", tt.content, back)
+			}
+		})
+	}
+}
+
+func TestTXTRoundTripThroughRRSet(t *testing.T) {
+	dkim := "v=DKIM1; k=rsa; p=" + strings.Repeat("MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA", 10)
+
+	for _, recordType := range []string{"TXT", "SPF"} {
+		t.Run(recordType, func(t *testing.T) {
+			ep := &endpoint.Endpoint{
+				DNSName:    "selector._domainkey.example.com",
+				RecordType: recordType,
+				Targets:    endpoint.Targets{dkim},
+			}
+			rrset := convertEndpointToRRSet(ep, "example.com", testTTLLimits)
+			if len(rrset.Records) != 1 {
+				t.Fatalf("convertEndpointToRRSet() records = %v, want a single record", rrset.Records)
+			}
+			strs, err := parseCharacterStrings(rrset.Records[0])
+			if err != nil {
+				t.Fatalf("convertEndpointToRRSet() produced invalid record %q: %v", rrset.Records[0], err)
+			}
+			if len(strs) != 2 || len(strs[0]) != 255 {
+				t.Errorf("convertEndpointToRRSet() chunks = %d (first %d bytes), want 2 (first 255 bytes)", len(strs), len(strs[0]))
+			}
+
+			back := convertRRSetToEndpoint(&desec.RRSet{
+				SubName: rrset.SubName,
+				Type:    rrset.Type,
+				Records: rrset.Records,
+				TTL:     rrset.TTL,
+			}, "example.com")
+			if !reflect.DeepEqual(back.Targets, endpoint.Targets{dkim}) {
+				t.Errorf("round trip targets = %v, want %v", back.Targets, endpoint.Targets{dkim})
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"slices"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/metrics"
+	"github.com/nrdcg/desec"
+	log "github.com/sirupsen/logrus"
+)
+
+// Outcomes of an RRset update, counted in the updates metric
+const (
+	updateSkipped = "skipped"
+	updateSent    = "updated"
+)
+
+// minimizeUpdates compares the RRsets to update with their current state in
+// deSEC and returns the ones that changed. Every RRset is returned when the
+// current state can't be read.
+func (d *DesecClient) minimizeUpdates(domain string, rrsets []desec.RRSet) []desec.RRSet {
+	current, err := d.GetRecords(domain)
+	if err != nil {
+		log.Warnf("failed to read the records of %s, updating every RRset: %v", domain, err)
+		return rrsets
+	}
+	live := make(map[rrsetKey]desec.RRSet, len(current))
+	for _, rrset := range current {
+		live[rrsetKey{subname: rrset.SubName, recordType: rrset.Type}] = rrset
+	}
+
+	changed := slices.DeleteFunc(slices.Clone(rrsets), func(rrset desec.RRSet) bool {
+		existing, ok := live[rrsetKey{subname: rrset.SubName, recordType: rrset.Type}]
+		return ok && len(rrset.Records) > 0 && existing.TTL == rrset.TTL &&
+			slices.Equal(driftRecords(rrset.Type, existing.Records), driftRecords(rrset.Type, rrset.Records))
+	})
+
+	skipped := len(rrsets) - len(changed)
+	log.Debugf("updating %d RRsets of %s: %d unchanged skipped", len(rrsets), domain, skipped)
+	if !d.dryRun {
+		metrics.Updates.WithLabelValues(domain, updateSkipped).Add(float64(skipped))
+	}
+	return changed
+}
+
+// updateRRSets replaces RRsets in deSEC with bulk updates. They are sent as
+// full resources (PUT) rather than patches of the changed fields
+// (OnlyFields): the client always serializes the records of an RRset, as the
+// field has no omitempty, and an empty list would delete the RRset. A patch
+// could only leave out the TTL, so it would be no smaller than a replacement.
+func (d *DesecClient) updateRRSets(domain string, rrsets []desec.RRSet, result *ZoneResult) error {
+	if len(rrsets) == 0 {
+		return nil
+	}
+	if d.dryRun {
+		log.Infof("dryrun: would update %d records for domain %s: %v", len(rrsets), domain, rrsets)
+		result.set(rrsets, ResultSkipped, reasonDryRun)
+		return nil
+	}
+	log.Debugf("updating %d records for domain %s: %v", len(rrsets), domain, rrsets)
+	err := d.writeChunks(domain, "update", rrsets, result, func(chunk []desec.RRSet) error {
+		return d.bulkUpdate(domain, chunk)
+	})
+	if err != nil {
+		return err
+	}
+	metrics.Updates.WithLabelValues(domain, updateSent).Add(float64(len(rrsets)))
+	log.Debugf("successfully updated %d records for domain %s", len(rrsets), domain)
+	return nil
+}
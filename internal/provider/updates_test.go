@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/michelangelomo/external-dns-desec-provider/internal/metrics"
+	"github.com/nrdcg/desec"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestApplyChangesMinimizesUpdates(t *testing.T) {
+	fake, srv := newFakeDesec(t, "updates.example")
+	for _, subname := range []string{"same", "ttl", "records", "both"} {
+		fake.put("updates.example", desec.RRSet{SubName: subname, Type: "A", TTL: 3600, Records: []string{"192.0.2.1"}})
+	}
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"updates.example"}, DefaultTTL: 3600})
+
+	update := func(name string, ttl endpoint.TTL, target string) *endpoint.Endpoint {
+		return &endpoint.Endpoint{DNSName: name + ".updates.example", RecordType: "A", RecordTTL: ttl, Targets: endpoint.Targets{target}}
+	}
+	err := client.ApplyChanges(plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{
+			update("same", 3600, "192.0.2.1"), update("ttl", 3600, "192.0.2.1"),
+			update("records", 3600, "192.0.2.1"), update("both", 3600, "192.0.2.1"),
+		},
+		UpdateNew: []*endpoint.Endpoint{
+			update("same", 3600, "192.0.2.1"), update("ttl", 7200, "192.0.2.1"),
+			update("records", 3600, "192.0.2.2"), update("both", 7200, "192.0.2.2"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	expected := map[string]desec.RRSet{
+		"same":    {TTL: 3600, Records: []string{"192.0.2.1"}},
+		"ttl":     {TTL: 7200, Records: []string{"192.0.2.1"}},
+		"records": {TTL: 3600, Records: []string{"192.0.2.2"}},
+		"both":    {TTL: 7200, Records: []string{"192.0.2.2"}},
+	}
+	for subname, want := range expected {
+		rrset, _ := fake.get("updates.example", subname, "A")
+		if rrset.TTL != want.TTL || !slices.Equal(rrset.Records, want.Records) {
+			t.Errorf("%s: TTL %d records %v, want TTL %d records %v", subname, rrset.TTL, rrset.Records, want.TTL, want.Records)
+		}
+	}
+
+	fake.mu.Lock()
+	requests := slices.Clone(fake.requests)
+	fake.mu.Unlock()
+	if !slices.Equal(requests, []string{"GET /domains/updates.example/rrsets/", "PUT /domains/updates.example/rrsets/"}) {
+		t.Errorf("requests = %v, want a read and a single bulk update", requests)
+	}
+	for mode, count := range map[string]float64{updateSkipped: 1, updateSent: 3} {
+		if value := testutil.ToFloat64(metrics.Updates.WithLabelValues("updates.example", mode)); value != count {
+			t.Errorf("%s updates = %v, want %v", mode, value, count)
+		}
+	}
+}
+
+func TestApplyChangesUpdatesDryRun(t *testing.T) {
+	fake, srv := newFakeDesec(t, "dryrun.updates.example")
+	fake.put("dryrun.updates.example", desec.RRSet{SubName: "same", Type: "A", TTL: 3600, Records: []string{"192.0.2.1"}})
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"dryrun.updates.example"}, DefaultTTL: 3600, DryRun: true})
+
+	same := &endpoint.Endpoint{DNSName: "same.dryrun.updates.example", RecordType: "A", RecordTTL: 3600, Targets: endpoint.Targets{"192.0.2.1"}}
+	if err := client.ApplyChanges(plan.Changes{UpdateOld: []*endpoint.Endpoint{same}, UpdateNew: []*endpoint.Endpoint{same}}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if writes := fake.writes(); writes != 0 {
+		t.Errorf("dry run sent %d write requests, want none", writes)
+	}
+	if value := testutil.ToFloat64(metrics.Updates.WithLabelValues("dryrun.updates.example", updateSkipped)); value != 0 {
+		t.Errorf("dry run counted %v skipped updates, want none", value)
+	}
+}
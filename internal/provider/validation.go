@@ -0,0 +1,283 @@
+package provider
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const (
+	maxNameLength  = 253 // Maximum length of a domain name in presentation format, without the trailing dot
+	maxLabelLength = 63  // Maximum length of a single label
+)
+
+// EndpointError describes why a single endpoint was rejected
+type EndpointError struct {
+	Change        string   `json:"change,omitempty"`
+	DNSName       string   `json:"dnsName"`
+	RecordType    string   `json:"recordType"`
+	SetIdentifier string   `json:"setIdentifier,omitempty"`
+	Targets       []string `json:"targets,omitempty"`
+	Reason        string   `json:"reason"`
+}
+
+// ValidationError is returned when one or more endpoints can't be sent to deSEC.
+// It lists every offending endpoint, not only the first one.
+type ValidationError struct {
+	Endpoints []EndpointError `json:"endpoints"`
+}
+
+func (e *ValidationError) Error() string {
+	reasons := make([]string, 0, len(e.Endpoints))
+	for _, ep := range e.Endpoints {
+		reasons = append(reasons, fmt.Sprintf("%s/%s: %s", ep.DNSName, ep.RecordType, ep.Reason))
+	}
+	return fmt.Sprintf("%d invalid endpoints: %s", len(e.Endpoints), strings.Join(reasons, "; "))
+}
+
+// ValidateEndpoints checks a list of endpoints for RFC 1035 names, per-type target
+// syntax and CNAME exclusivity. It returns a *ValidationError listing every
+// offending endpoint, or nil if all endpoints are valid.
+func ValidateEndpoints(endpoints []*endpoint.Endpoint) error {
+	errs := validateEndpointList("", endpoints)
+	errs = append(errs, validateCNAMEExclusivity(endpoints, func(int) string { return "" })...)
+	if len(errs) > 0 {
+		return &ValidationError{Endpoints: errs}
+	}
+	return nil
+}
+
+// FilterValidEndpoints splits a list of endpoints into the valid ones and the
+// reasons why the others are invalid, checked like ValidateEndpoints
+func FilterValidEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, []EndpointError) {
+	var invalid []EndpointError
+	rejected := make(map[int]bool)
+	for i, ep := range endpoints {
+		if ep == nil {
+			continue
+		}
+		if reason := validateEndpoint(ep); reason != "" {
+			invalid = append(invalid, newEndpointError("", ep, reason))
+			rejected[i] = true
+		}
+	}
+	conflicts := cnameConflicts(endpoints)
+	for _, i := range slices.Sorted(maps.Keys(conflicts)) {
+		if !rejected[i] {
+			invalid = append(invalid, newEndpointError("", endpoints[i], conflicts[i]))
+			rejected[i] = true
+		}
+	}
+
+	valid := make([]*endpoint.Endpoint, 0, len(endpoints)-len(rejected))
+	for i, ep := range endpoints {
+		if ep != nil && !rejected[i] {
+			valid = append(valid, ep)
+		}
+	}
+	return valid, invalid
+}
+
+// ValidateChanges checks the records that would be written by a set of changes.
+// Only Create and UpdateNew are validated: UpdateOld and Delete describe what is
+// already stored in deSEC and must stay removable even if they are malformed.
+func ValidateChanges(changes plan.Changes) error {
+	var errs []EndpointError
+	errs = append(errs, validateEndpointList("create", changes.Create)...)
+	errs = append(errs, validateEndpointList("updateNew", changes.UpdateNew)...)
+
+	// A CNAME can't be created next to a record of another type,
+	// whether both come from the create or the update list.
+	written := make([]*endpoint.Endpoint, 0, len(changes.Create)+len(changes.UpdateNew))
+	written = append(written, changes.Create...)
+	written = append(written, changes.UpdateNew...)
+	errs = append(errs, validateCNAMEExclusivity(written, func(i int) string {
+		if i < len(changes.Create) {
+			return "create"
+		}
+		return "updateNew"
+	})...)
+
+	if len(errs) > 0 {
+		return &ValidationError{Endpoints: errs}
+	}
+	return nil
+}
+
+// validateEndpointList validates every endpoint in the list on its own
+func validateEndpointList(change string, endpoints []*endpoint.Endpoint) []EndpointError {
+	var errs []EndpointError
+	for _, ep := range endpoints {
+		if ep == nil {
+			continue
+		}
+		if reason := validateEndpoint(ep); reason != "" {
+			errs = append(errs, newEndpointError(change, ep, reason))
+		}
+	}
+	return errs
+}
+
+func newEndpointError(change string, ep *endpoint.Endpoint, reason string) EndpointError {
+	return EndpointError{
+		Change:        change,
+		DNSName:       ep.DNSName,
+		RecordType:    ep.RecordType,
+		SetIdentifier: ep.SetIdentifier,
+		Targets:       ep.Targets,
+		Reason:        reason,
+	}
+}
+
+// validateEndpoint returns the reason why an endpoint is invalid, or an empty string
+func validateEndpoint(ep *endpoint.Endpoint) string {
+	if err := validateDNSName(ep.DNSName); err != nil {
+		return fmt.Sprintf("invalid name: %v", err)
+	}
+	if ep.RecordType == "" {
+		return "missing record type"
+	}
+	if _, ok := recordHandlers[ep.RecordType]; !ok {
+		return fmt.Sprintf("unsupported record type %s, supported types are %s", ep.RecordType, strings.Join(supportedRecordTypes(), ", "))
+	}
+	if len(ep.Targets) == 0 {
+		return "empty target list"
+	}
+	if ep.RecordType == endpoint.RecordTypeCNAME && len(ep.Targets) > 1 {
+		return fmt.Sprintf("CNAME must have exactly one target, got %d", len(ep.Targets))
+	}
+	for _, target := range ep.Targets {
+		if err := validateTarget(ep.RecordType, target); err != nil {
+			return fmt.Sprintf("invalid target %q: %v", target, err)
+		}
+	}
+	if _, _, _, err := parseRecordOptions(ep.ProviderSpecific); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// validateCNAMEExclusivity rejects CNAME endpoints that share their name with
+// an endpoint of any other type, as a CNAME can't coexist with other data.
+// changeOf returns the change list the i-th endpoint comes from.
+func validateCNAMEExclusivity(endpoints []*endpoint.Endpoint, changeOf func(i int) string) []EndpointError {
+	conflicts := cnameConflicts(endpoints)
+	var errs []EndpointError
+	for _, i := range slices.Sorted(maps.Keys(conflicts)) {
+		errs = append(errs, newEndpointError(changeOf(i), endpoints[i], conflicts[i]))
+	}
+	return errs
+}
+
+// cnameConflicts returns the reason why every CNAME endpoint sharing its name
+// with an endpoint of another type is invalid, by index
+func cnameConflicts(endpoints []*endpoint.Endpoint) map[int]string {
+	types := make(map[string]map[string]bool)
+	for _, ep := range endpoints {
+		if ep == nil {
+			continue
+		}
+		name := normalizeName(ep.DNSName)
+		if types[name] == nil {
+			types[name] = make(map[string]bool)
+		}
+		types[name][ep.RecordType] = true
+	}
+
+	conflicts := make(map[int]string)
+	for i, ep := range endpoints {
+		if ep == nil || ep.RecordType != endpoint.RecordTypeCNAME {
+			continue
+		}
+		var others []string
+		for recordType := range types[normalizeName(ep.DNSName)] {
+			if recordType != endpoint.RecordTypeCNAME {
+				others = append(others, recordType)
+			}
+		}
+		if len(others) > 0 {
+			slices.Sort(others)
+			conflicts[i] = fmt.Sprintf("CNAME can't coexist with other record types at the same name (%s)", strings.Join(others, ", "))
+		}
+	}
+	return conflicts
+}
+
+// validateTarget checks the syntax of a single target for the given record type
+func validateTarget(recordType, target string) error {
+	handler, ok := recordHandlers[recordType]
+	if !ok {
+		return fmt.Errorf("unsupported record type %s", recordType)
+	}
+	_, err := handler.parse(target)
+	return err
+}
+
+// validateDNSName checks that name is a valid RFC 1035 domain name. Underscores
+// are accepted for service labels such as _dmarc, and a single leading "*"
+// label for wildcards.
+func validateDNSName(name string) error {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return fmt.Errorf("empty name")
+	}
+	if len(name) > maxNameLength {
+		return fmt.Errorf("name is %d characters long, maximum is %d", len(name), maxNameLength)
+	}
+	for i, label := range strings.Split(name, ".") {
+		if label == "*" && i == 0 {
+			continue
+		}
+		if err := validateLabel(label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateHostname checks a hostname used as record data, like a CNAME target.
+// Unlike owner names, wildcards are not allowed there.
+func validateHostname(name string) error {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return fmt.Errorf("empty hostname")
+	}
+	if len(name) > maxNameLength {
+		return fmt.Errorf("hostname is %d characters long, maximum is %d", len(name), maxNameLength)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if err := validateLabel(label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateLabel(label string) error {
+	if label == "" {
+		return fmt.Errorf("empty label")
+	}
+	if len(label) > maxLabelLength {
+		return fmt.Errorf("label %q is %d characters long, maximum is %d", label, len(label), maxLabelLength)
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return fmt.Errorf("label %q must not start or end with a hyphen", label)
+	}
+	for _, c := range label {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return fmt.Errorf("label %q contains invalid character %q", label, c)
+		}
+	}
+	return nil
+}
+
+// normalizeName lowercases a DNS name and strips its trailing dot
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
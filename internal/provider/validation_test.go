@@ -0,0 +1,232 @@
+package provider
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestValidateEndpoints(t *testing.T) {
+	tests := []struct {
+		name            string
+		endpoints       []*endpoint.Endpoint
+		expectedInvalid []string
+	}{
+		{
+			name: "Valid endpoints",
+			endpoints: []*endpoint.Endpoint{
+				{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+				{DNSName: "www.example.com", RecordType: "AAAA", Targets: endpoint.Targets{"2001:db8::1"}},
+				{DNSName: "alias.example.com.", RecordType: "CNAME", Targets: endpoint.Targets{"www.example.com"}},
+				{DNSName: "_dmarc.example.com", RecordType: "TXT", Targets: endpoint.Targets{"v=DMARC1; p=reject"}},
+				{DNSName: "example.com", RecordType: "MX", Targets: endpoint.Targets{"10 mail.example.com."}},
+				{DNSName: "_sip._tcp.example.com", RecordType: "SRV", Targets: endpoint.Targets{"10 60 5060 sip.example.com."}},
+				{DNSName: "*.apps.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.2"}},
+			},
+		},
+		{
+			name: "Malformed IPv4 address",
+			endpoints: []*endpoint.Endpoint{
+				{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.256"}},
+			},
+			expectedInvalid: []string{"www.example.com/A"},
+		},
+		{
+			name: "IPv6 address in A record",
+			endpoints: []*endpoint.Endpoint{
+				{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"2001:db8::1"}},
+			},
+			expectedInvalid: []string{"www.example.com/A"},
+		},
+		{
+			name: "IPv4 address in AAAA record",
+			endpoints: []*endpoint.Endpoint{
+				{DNSName: "www.example.com", RecordType: "AAAA", Targets: endpoint.Targets{"192.0.2.1"}},
+			},
+			expectedInvalid: []string{"www.example.com/AAAA"},
+		},
+		{
+			name: "Label longer than 63 characters",
+			endpoints: []*endpoint.Endpoint{
+				{DNSName: strings.Repeat("a", 64) + ".example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+			},
+			expectedInvalid: []string{strings.Repeat("a", 64) + ".example.com/A"},
+		},
+		{
+			name: "Name longer than 253 characters",
+			endpoints: []*endpoint.Endpoint{
+				{DNSName: strings.Repeat("a.", 125) + "example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+			},
+			expectedInvalid: []string{strings.Repeat("a.", 125) + "example.com/A"},
+		},
+		{
+			name: "Invalid characters and hyphens",
+			endpoints: []*endpoint.Endpoint{
+				{DNSName: "foo bar.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+				{DNSName: "-foo.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+				{DNSName: "foo..example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+				{DNSName: "foo.*.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+			},
+			expectedInvalid: []string{"foo bar.example.com/A", "-foo.example.com/A", "foo..example.com/A", "foo.*.example.com/A"},
+		},
+		{
+			name: "Empty target list",
+			endpoints: []*endpoint.Endpoint{
+				{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{}},
+			},
+			expectedInvalid: []string{"www.example.com/A"},
+		},
+		{
+			name: "CNAME next to other types",
+			endpoints: []*endpoint.Endpoint{
+				{DNSName: "www.example.com", RecordType: "CNAME", Targets: endpoint.Targets{"alias.example.com"}},
+				{DNSName: "www.example.com.", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+			},
+			expectedInvalid: []string{"www.example.com/CNAME"},
+		},
+		{
+			name: "CNAME with multiple targets",
+			endpoints: []*endpoint.Endpoint{
+				{DNSName: "www.example.com", RecordType: "CNAME", Targets: endpoint.Targets{"a.example.com", "b.example.com"}},
+			},
+			expectedInvalid: []string{"www.example.com/CNAME"},
+		},
+		{
+			name: "Malformed MX and SRV",
+			endpoints: []*endpoint.Endpoint{
+				{DNSName: "example.com", RecordType: "MX", Targets: endpoint.Targets{"mail.example.com"}},
+				{DNSName: "_sip._tcp.example.com", RecordType: "SRV", Targets: endpoint.Targets{"10 60 70000 sip.example.com."}},
+			},
+			expectedInvalid: []string{"example.com/MX", "_sip._tcp.example.com/SRV"},
+		},
+		{
+			name: "Null MX",
+			endpoints: []*endpoint.Endpoint{
+				{DNSName: "example.com", RecordType: "MX", Targets: endpoint.Targets{"0 ."}},
+			},
+		},
+		{
+			name: "Invalid provider-specific TTL",
+			endpoints: []*endpoint.Endpoint{
+				{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"},
+					ProviderSpecific: endpoint.ProviderSpecific{{Name: "webhook/desec-ttl", Value: "0"}}},
+			},
+			expectedInvalid: []string{"www.example.com/A"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEndpoints(tt.endpoints)
+			if len(tt.expectedInvalid) == 0 {
+				if err != nil {
+					t.Errorf("ValidateEndpoints() unexpected error = %v", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("ValidateEndpoints() error = %v, want *ValidationError", err)
+			}
+			var invalid []string
+			for _, ep := range validationErr.Endpoints {
+				if ep.Reason == "" {
+					t.Errorf("ValidateEndpoints() missing reason for %s/%s", ep.DNSName, ep.RecordType)
+				}
+				invalid = append(invalid, ep.DNSName+"/"+ep.RecordType)
+			}
+			if strings.Join(invalid, ",") != strings.Join(tt.expectedInvalid, ",") {
+				t.Errorf("ValidateEndpoints() invalid = %v, want %v", invalid, tt.expectedInvalid)
+			}
+		})
+	}
+}
+
+func TestValidateChanges(t *testing.T) {
+	tests := []struct {
+		name            string
+		changes         plan.Changes
+		expectedInvalid []string
+	}{
+		{
+			name: "Valid changes",
+			changes: plan.Changes{
+				Create:    []*endpoint.Endpoint{{DNSName: "new.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}}},
+				UpdateNew: []*endpoint.Endpoint{{DNSName: "www.example.com", RecordType: "CNAME", Targets: endpoint.Targets{"new.example.com"}}},
+			},
+		},
+		{
+			name: "Invalid create and update are both reported",
+			changes: plan.Changes{
+				Create:    []*endpoint.Endpoint{{DNSName: "new.example.com", RecordType: "A", Targets: endpoint.Targets{"not-an-ip"}}},
+				UpdateNew: []*endpoint.Endpoint{{DNSName: "www.example.com", RecordType: "AAAA", Targets: endpoint.Targets{}}},
+			},
+			expectedInvalid: []string{"create:new.example.com/A", "updateNew:www.example.com/AAAA"},
+		},
+		{
+			name: "CNAME created next to updated record",
+			changes: plan.Changes{
+				Create:    []*endpoint.Endpoint{{DNSName: "www.example.com", RecordType: "CNAME", Targets: endpoint.Targets{"alias.example.com"}}},
+				UpdateNew: []*endpoint.Endpoint{{DNSName: "www.example.com", RecordType: "TXT", Targets: endpoint.Targets{"hello"}}},
+			},
+			expectedInvalid: []string{"create:www.example.com/CNAME"},
+		},
+		{
+			name: "Deletes are not validated",
+			changes: plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"bogus"}}},
+				Delete:    []*endpoint.Endpoint{{DNSName: "old.example.com", RecordType: "A", Targets: endpoint.Targets{}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateChanges(tt.changes)
+			if len(tt.expectedInvalid) == 0 {
+				if err != nil {
+					t.Errorf("ValidateChanges() unexpected error = %v", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("ValidateChanges() error = %v, want *ValidationError", err)
+			}
+			var invalid []string
+			for _, ep := range validationErr.Endpoints {
+				invalid = append(invalid, ep.Change+":"+ep.DNSName+"/"+ep.RecordType)
+			}
+			if strings.Join(invalid, ",") != strings.Join(tt.expectedInvalid, ",") {
+				t.Errorf("ValidateChanges() invalid = %v, want %v", invalid, tt.expectedInvalid)
+			}
+		})
+	}
+}
+
+func TestFilterValidEndpoints(t *testing.T) {
+	endpoints := []*endpoint.Endpoint{
+		{DNSName: "www.example.com", RecordType: "CNAME", Targets: endpoint.Targets{"alias.example.com"}},
+		{DNSName: "www.example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1"}},
+		nil,
+		{DNSName: "bad.example.com", RecordType: "AAAA", Targets: endpoint.Targets{"192.0.2.1"}},
+		{DNSName: "ok.example.com", RecordType: "TXT", Targets: endpoint.Targets{"hello"}},
+	}
+
+	valid, invalid := FilterValidEndpoints(endpoints)
+	if len(valid) != 2 || valid[0] != endpoints[1] || valid[1] != endpoints[4] {
+		t.Errorf("FilterValidEndpoints() valid = %v, want www.example.com/A and ok.example.com/TXT", valid)
+	}
+	var names []string
+	for _, ep := range invalid {
+		names = append(names, ep.DNSName+"/"+ep.RecordType)
+	}
+	if strings.Join(names, ",") != "bad.example.com/AAAA,www.example.com/CNAME" {
+		t.Errorf("FilterValidEndpoints() invalid = %v, want bad.example.com/AAAA and www.example.com/CNAME", names)
+	}
+}
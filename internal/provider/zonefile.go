@@ -0,0 +1,331 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nrdcg/desec"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// ErrZoneNotManaged is returned for zones outside of the domain filters
+var ErrZoneNotManaged = errors.New("zone is not managed")
+
+// ManagedZones returns the zones listed in the domain filters, sorted
+func (d *DesecClient) ManagedZones() []string {
+	zones := make([]string, 0, len(d.domainFilters))
+	for _, filter := range d.domainFilters {
+		if zone := normalizeName(filter); !slices.Contains(zones, zone) {
+			zones = append(zones, zone)
+		}
+	}
+	slices.Sort(zones)
+	return zones
+}
+
+// ExportZone writes every RRset of a managed zone to w as an RFC 1035 master
+// file. RRsets are ordered by name and type and records are sorted, so
+// exporting an unchanged zone always produces the same file.
+func (d *DesecClient) ExportZone(w io.Writer, zone string) error {
+	zone = normalizeName(zone)
+	if !slices.Contains(d.ManagedZones(), zone) {
+		return fmt.Errorf("%w: %s", ErrZoneNotManaged, zone)
+	}
+
+	rrsets, err := d.GetRecords(zone)
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(rrsets, func(a, b desec.RRSet) int {
+		return compareRRSetKeys(rrsetKey{a.SubName, a.Type}, rrsetKey{b.SubName, b.Type})
+	})
+
+	if _, err := fmt.Fprintf(w, "$ORIGIN %s\n$TTL %d\n", canonicalHostname(zone), d.defaultTTL); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+	for _, rrset := range rrsets {
+		owner := rrset.SubName
+		if owner == "" {
+			owner = "@"
+		}
+		ep := convertRRSetToEndpoint(&rrset, zone)
+		records := make([]string, len(ep.Targets))
+		for i, target := range ep.Targets {
+			records[i] = recordText(ep.RecordType, target)
+		}
+		slices.Sort(records)
+		for _, record := range records {
+			if _, err := fmt.Fprintf(tw, "%s\t%d\tIN\t%s\t%s\n", owner, ep.RecordTTL, ep.RecordType, record); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+// hostnameFields is the index of the hostname in the record data of the types
+// embedding one, qualified with the origin when relative
+var hostnameFields = map[string]int{
+	endpoint.RecordTypeCNAME: 0,
+	endpoint.RecordTypeNS:    0,
+	endpoint.RecordTypePTR:   0,
+	endpoint.RecordTypeMX:    1,
+	endpoint.RecordTypeSRV:   3,
+	endpoint.RecordTypeNAPTR: 5,
+	recordTypeSVCB:           1,
+	recordTypeHTTPS:          1,
+}
+
+// desecManagedTypes are the record types deSEC maintains itself, skipped when
+// parsing zone files
+var desecManagedTypes = []string{"SOA", "DNSKEY", "RRSIG", "NSEC", "NSEC3", "NSEC3PARAM", "CDS", "CDNSKEY"}
+
+// zoneLine is a logical line of a master file, parentheses joined
+type zoneLine struct {
+	number int
+	// blankOwner is set when the line starts with whitespace, the owner of the
+	// previous record is reused
+	blankOwner bool
+	tokens     []string
+}
+
+// ParseZoneFile parses an RFC 1035 master file into endpoints, one per RRset,
+// in the order they first appear. Relative names are qualified with the zone
+// (or $ORIGIN) and records without a TTL get the $TTL, or the TTL of the
+// previous record. SOA and DNSSEC records, which deSEC maintains, are skipped.
+func ParseZoneFile(r io.Reader, zone string) ([]*endpoint.Endpoint, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := tokenizeZoneFile(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	origin := canonicalHostname(zone)
+	var owner string
+	var defaultTTL, lastTTL endpoint.TTL
+	var endpoints []*endpoint.Endpoint
+	rrsets := make(map[rrsetKey]*endpoint.Endpoint)
+	for _, line := range lines {
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("line %d: %s", line.number, fmt.Sprintf(format, args...))
+		}
+
+		tokens := line.tokens
+		switch strings.ToUpper(tokens[0]) {
+		case "$ORIGIN":
+			if len(tokens) != 2 {
+				return nil, fail("expected \"$ORIGIN <name>\"")
+			}
+			origin = absoluteName(tokens[1], origin)
+			continue
+		case "$TTL":
+			if len(tokens) != 2 {
+				return nil, fail("expected \"$TTL <ttl>\"")
+			}
+			ttl, err := parseZoneTTL(tokens[1])
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			defaultTTL = ttl
+			continue
+		}
+		if strings.HasPrefix(tokens[0], "$") {
+			return nil, fail("unsupported directive %s", tokens[0])
+		}
+
+		if !line.blankOwner {
+			owner = absoluteName(tokens[0], origin)
+			tokens = tokens[1:]
+		} else if owner == "" {
+			return nil, fail("missing owner name")
+		}
+
+		// The TTL and class may come in any order before the type
+		var ttl endpoint.TTL
+		for range 2 {
+			if len(tokens) == 0 {
+				break
+			}
+			if value, err := parseZoneTTL(tokens[0]); err == nil {
+				ttl = value
+			} else if class := strings.ToUpper(tokens[0]); slices.Contains([]string{"CH", "HS", "CS"}, class) {
+				return nil, fail("unsupported class %s", class)
+			} else if class != "IN" {
+				break
+			}
+			tokens = tokens[1:]
+		}
+		if len(tokens) < 2 {
+			return nil, fail("expected a record type and its data")
+		}
+		switch {
+		case ttl > 0:
+			lastTTL = ttl
+		case defaultTTL > 0:
+			ttl = defaultTTL
+		default:
+			ttl = lastTTL
+		}
+
+		recordType := strings.ToUpper(tokens[0])
+		if slices.Contains(desecManagedTypes, recordType) {
+			log.Debugf("line %d: skipping %s record maintained by deSEC", line.number, recordType)
+			continue
+		}
+		rdata := slices.Clone(tokens[1:])
+		if field, ok := hostnameFields[recordType]; ok && field < len(rdata) && rdata[field] != "." {
+			rdata[field] = absoluteName(rdata[field], origin)
+		}
+
+		name := normalizeName(owner)
+		key := rrsetKey{subname: name, recordType: recordType}
+		ep, ok := rrsets[key]
+		if !ok {
+			ep = &endpoint.Endpoint{DNSName: name, RecordType: recordType, RecordTTL: ttl}
+			rrsets[key] = ep
+			endpoints = append(endpoints, ep)
+		} else if ep.RecordTTL != ttl {
+			log.Warnf("line %d: TTL %d of %s/%s differs from the TTL %d of its RRset, keeping %d", line.number, ttl, name, recordType, ep.RecordTTL, ep.RecordTTL)
+		}
+		ep.Targets = append(ep.Targets, strings.Join(rdata, " "))
+	}
+	return endpoints, nil
+}
+
+// tokenizeZoneFile splits a master file into logical lines of tokens. Comments
+// are dropped, parentheses join lines and quoted strings are kept as a single
+// token, quotes included.
+func tokenizeZoneFile(text string) ([]zoneLine, error) {
+	var lines []zoneLine
+	var current zoneLine
+	var token strings.Builder
+	number, depth := 1, 0
+	startOfLine := true
+
+	endToken := func() {
+		if token.Len() > 0 {
+			current.tokens = append(current.tokens, token.String())
+			token.Reset()
+		}
+	}
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if startOfLine {
+			current = zoneLine{number: number, blankOwner: isSpace(c)}
+			startOfLine = false
+		}
+		switch {
+		case c == '"':
+			// Quoted strings run until the next unescaped quote
+			start := i
+			for i++; i < len(text) && text[i] != '"'; i++ {
+				if text[i] == '\\' {
+					i++
+				}
+				if i < len(text) && text[i] == '\n' {
+					number++
+				}
+			}
+			if i >= len(text) {
+				return nil, fmt.Errorf("line %d: unterminated quoted string", current.number)
+			}
+			token.WriteString(text[start : i+1])
+		case c == '\\' && i+1 < len(text):
+			token.WriteString(text[i : i+2])
+			i++
+		case c == ';':
+			for i+1 < len(text) && text[i+1] != '\n' {
+				i++
+			}
+		case c == '(':
+			endToken()
+			depth++
+		case c == ')':
+			endToken()
+			if depth--; depth < 0 {
+				return nil, fmt.Errorf("line %d: unbalanced parentheses", number)
+			}
+		case c == '\n':
+			endToken()
+			number++
+			if depth == 0 {
+				if len(current.tokens) > 0 {
+					lines = append(lines, current)
+				}
+				startOfLine = true
+			}
+		case isSpace(c) || c == '\r':
+			endToken()
+		default:
+			token.WriteByte(c)
+		}
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("line %d: unbalanced parentheses", current.number)
+	}
+	endToken()
+	if !startOfLine && len(current.tokens) > 0 {
+		lines = append(lines, current)
+	}
+	return lines, nil
+}
+
+// absoluteName qualifies a relative name with the origin, @ is the origin itself
+func absoluteName(name, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return name
+	default:
+		return name + "." + origin
+	}
+}
+
+// zoneTTLUnits are the BIND TTL units
+var zoneTTLUnits = map[byte]int{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+
+// parseZoneTTL parses a TTL in seconds or with BIND units like 1h30m
+func parseZoneTTL(value string) (endpoint.TTL, error) {
+	if value == "" || !isDigit(value[0]) {
+		return 0, fmt.Errorf("invalid TTL %q", value)
+	}
+	if ttl, err := strconv.ParseUint(value, 10, 31); err == nil {
+		return endpoint.TTL(ttl), nil
+	}
+
+	total, number := 0, 0
+	digits := false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if isDigit(c) {
+			number = number*10 + int(c-'0')
+			digits = true
+			continue
+		}
+		unit, ok := zoneTTLUnits[c|0x20]
+		if !ok || !digits {
+			return 0, fmt.Errorf("invalid TTL %q", value)
+		}
+		total += number * unit
+		number, digits = 0, false
+		if total > math.MaxInt32 {
+			return 0, fmt.Errorf("invalid TTL %q", value)
+		}
+	}
+	if digits {
+		return 0, fmt.Errorf("invalid TTL %q", value)
+	}
+	return endpoint.TTL(total), nil
+}
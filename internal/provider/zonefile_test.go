@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
+	"github.com/nrdcg/desec"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestManagedZones(t *testing.T) {
+	client, err := CreateDesecClient(config.Config{APIToken: "test-token", DomainFilters: []string{"example.org", "Example.com.", "example.com"}})
+	if err != nil {
+		t.Fatalf("CreateDesecClient() error = %v", err)
+	}
+	expected := []string{"example.com", "example.org"}
+	if zones := client.ManagedZones(); !reflect.DeepEqual(zones, expected) {
+		t.Errorf("ManagedZones() = %v, want %v", zones, expected)
+	}
+}
+
+func TestExportZone(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	fake.put("example.com", desec.RRSet{SubName: "www", Type: "CNAME", TTL: 3600, Records: []string{"lb.example.net."}})
+	fake.put("example.com", desec.RRSet{SubName: "", Type: "TXT", TTL: 7200, Records: []string{`"v=spf1 -all"`}})
+	fake.put("example.com", desec.RRSet{SubName: "", Type: "A", TTL: 3600, Records: []string{"192.0.2.2", "192.0.2.1"}})
+	fake.put("example.com", desec.RRSet{SubName: "", Type: "MX", TTL: 3600, Records: []string{"10 mail.example.com."}})
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600})
+
+	var out strings.Builder
+	if err := client.ExportZone(&out, "example.com."); err != nil {
+		t.Fatalf("ExportZone() error = %v", err)
+	}
+	expected := `$ORIGIN example.com.
+$TTL 3600
+@   3600 IN A     192.0.2.1
+@   3600 IN A     192.0.2.2
+@   3600 IN MX    10 mail.example.com.
+@   7200 IN TXT   "v=spf1 -all"
+www 3600 IN CNAME lb.example.net.
+`
+	if out.String() != expected {
+		t.Errorf("ExportZone() =\n%s\nwant\n%s", out.String(), expected)
+	}
+
+	if err := client.ExportZone(&out, "example.org"); !errors.Is(err, ErrZoneNotManaged) {
+		t.Errorf("ExportZone() of an unmanaged zone error = %v, want %v", err, ErrZoneNotManaged)
+	}
+}
+
+func TestParseZoneFile(t *testing.T) {
+	zoneFile := `$TTL 1h
+@	IN SOA ns1.desec.io. hostmaster.example.com. ( 1 86400 3600 2419200 3600 ) ; maintained by deSEC
+@	3600 IN A 192.0.2.1
+	IN A 192.0.2.2
+	MX 10 mail
+www	CNAME lb.example.net.
+txt IN 7200 TXT "v=spf1 -all" "with ; semicolon"
+$ORIGIN sub.example.com.
+api 300 AAAA 2001:db8::1
+srv._tcp SRV ( 10 5 443
+	target )
+`
+	endpoints, err := ParseZoneFile(strings.NewReader(zoneFile), "example.com")
+	if err != nil {
+		t.Fatalf("ParseZoneFile() error = %v", err)
+	}
+	expected := []*endpoint.Endpoint{
+		{DNSName: "example.com", RecordType: "A", Targets: endpoint.Targets{"192.0.2.1", "192.0.2.2"}, RecordTTL: 3600},
+		{DNSName: "example.com", RecordType: "MX", Targets: endpoint.Targets{"10 mail.example.com."}, RecordTTL: 3600},
+		{DNSName: "www.example.com", RecordType: "CNAME", Targets: endpoint.Targets{"lb.example.net."}, RecordTTL: 3600},
+		{DNSName: "txt.example.com", RecordType: "TXT", Targets: endpoint.Targets{`"v=spf1 -all" "with ; semicolon"`}, RecordTTL: 7200},
+		{DNSName: "api.sub.example.com", RecordType: "AAAA", Targets: endpoint.Targets{"2001:db8::1"}, RecordTTL: 300},
+		{DNSName: "srv._tcp.sub.example.com", RecordType: "SRV", Targets: endpoint.Targets{"10 5 443 target.sub.example.com."}, RecordTTL: 3600},
+	}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("ParseZoneFile() =\n%v\nwant\n%v", endpoints, expected)
+	}
+}
+
+func TestParseZoneFileErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		zoneFile string
+	}{
+		{name: "Unsupported directive", zoneFile: "$INCLUDE other.zone\n"},
+		{name: "Unsupported class", zoneFile: "www 3600 CH A 192.0.2.1\n"},
+		{name: "Missing data", zoneFile: "www 3600 IN A\n"},
+		{name: "Missing owner", zoneFile: "  3600 IN A 192.0.2.1\n"},
+		{name: "Unbalanced parentheses", zoneFile: "www 3600 IN TXT ( \"a\"\n"},
+		{name: "Unterminated string", zoneFile: "www 3600 IN TXT \"a\n"},
+		{name: "Invalid TTL", zoneFile: "$TTL 1y\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseZoneFile(strings.NewReader(tt.zoneFile), "example.com"); err == nil {
+				t.Error("ParseZoneFile() expected error but got none")
+			}
+		})
+	}
+}
+
+func TestParseZoneTTL(t *testing.T) {
+	tests := map[string]endpoint.TTL{"300": 300, "1h": 3600, "1h30m": 5400, "1D": 86400, "2w": 1209600}
+	for value, expected := range tests {
+		if ttl, err := parseZoneTTL(value); err != nil || ttl != expected {
+			t.Errorf("parseZoneTTL(%q) = %d, %v, want %d", value, ttl, err, expected)
+		}
+	}
+	for _, value := range []string{"", "h", "1x", "10h5", "-1"} {
+		if _, err := parseZoneTTL(value); err == nil {
+			t.Errorf("parseZoneTTL(%q) expected error but got none", value)
+		}
+	}
+}
+
+func TestExportedZoneParses(t *testing.T) {
+	fake, srv := newFakeDesec(t, "example.com")
+	fake.put("example.com", desec.RRSet{SubName: "", Type: "TXT", TTL: 7200, Records: []string{`"v=spf1 -all"`}})
+	fake.put("example.com", desec.RRSet{SubName: "", Type: "MX", TTL: 3600, Records: []string{"10 mail.example.com."}})
+	fake.put("example.com", desec.RRSet{SubName: "www", Type: "A", TTL: 3600, Records: []string{"192.0.2.1"}})
+	client := newTestClient(t, srv, config.Config{DomainFilters: []string{"example.com"}, DefaultTTL: 3600})
+
+	var out strings.Builder
+	if err := client.ExportZone(&out, "example.com"); err != nil {
+		t.Fatalf("ExportZone() error = %v", err)
+	}
+	endpoints, err := ParseZoneFile(strings.NewReader(out.String()), "example.com")
+	if err != nil {
+		t.Fatalf("ParseZoneFile() error = %v", err)
+	}
+	changes, err := client.DiffZone("example.com", endpoints, true)
+	if err != nil {
+		t.Fatalf("DiffZone() error = %v", err)
+	}
+	if len(changes.Create)+len(changes.UpdateNew)+len(changes.Delete) > 0 {
+		t.Errorf("DiffZone() of the exported zone = %+v, want no changes", changes)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/michelangelomo/external-dns-desec-provider/internal/config"
@@ -24,6 +27,34 @@ type webhook struct {
 	config      config.Config
 }
 
+// errorResponse is the JSON body sent along with error status codes
+type errorResponse struct {
+	Error     string                   `json:"error"`
+	Message   string                   `json:"message,omitempty"`
+	Details   []string                 `json:"details,omitempty"`
+	Endpoints []provider.EndpointError `json:"endpoints,omitempty"`
+	// RetryAfter is the delay in seconds asked by deSEC before retrying
+	RetryAfter int `json:"retryAfter,omitempty"`
+	// Result is the outcome of every zone of a partial apply
+	Result *provider.ApplyResult `json:"result,omitempty"`
+}
+
+// requestErrorStatuses maps the kinds of failed deSEC requests to the error
+// of the response and its status. external-dns only retries on 5xx statuses
+// and stops on others, so the temporary failures are sent with one.
+var requestErrorStatuses = []struct {
+	kind   error
+	error  string
+	status int
+}{
+	{provider.ErrThrottled, "throttled", http.StatusServiceUnavailable},
+	{provider.ErrUnavailable, "unavailable", http.StatusBadGateway},
+	{provider.ErrConflict, "conflict", http.StatusServiceUnavailable},
+	{provider.ErrUnauthorized, "unauthorized", http.StatusUnauthorized},
+	{provider.ErrInvalid, "invalid", http.StatusUnprocessableEntity},
+	{provider.ErrNotFound, "not found", http.StatusNotFound},
+}
+
 const (
 	externalDnsWebhookHeader = "application/external.dns.webhook+json;version=1"
 )
@@ -88,8 +119,7 @@ func (webhook webhook) recordsHandler(w http.ResponseWriter, r *http.Request) {
 		domainEndpoints, err := webhook.desecClient.GetEndpoints(domain)
 		if err != nil {
 			log.Errorf("failed to get records for domain %s: %v", domain, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			_, _ = fmt.Fprintf(w, "failed to get records for domain %s: %v", domain, err)
+			writeRequestError(w, fmt.Errorf("failed to get records for domain %s: %w", domain, err))
 			return
 		}
 
@@ -114,10 +144,15 @@ func (webhook webhook) applyChangesHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if err = provider.ValidateChanges(changes); err != nil {
+		log.Warnf("rejecting invalid changes: %v", err)
+		writeValidationError(w, err)
+		return
+	}
+
 	err = webhook.desecClient.ApplyChanges(changes)
 	if err != nil {
-		log.Errorf("failed to apply changes: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeApplyError(w, err)
 		return
 	}
 
@@ -133,6 +168,13 @@ func (webhook webhook) adjustEndpointsHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// external-dns stops on a 4xx status from this handler, so a single bad
+	// endpoint would block every zone: invalid endpoints are dropped instead
+	adjustedEndpoints, invalid := provider.FilterValidEndpoints(adjustedEndpoints)
+	for _, ep := range invalid {
+		log.Warnf("dropping invalid endpoint %s/%s: %s", ep.DNSName, ep.RecordType, ep.Reason)
+	}
+
 	endpoints, err := webhook.desecClient.AdjustEndpoints(adjustedEndpoints)
 	if err != nil {
 		log.Errorf("failed to adjust endpoints: %v", err)
@@ -148,3 +190,73 @@ func (webhook webhook) adjustEndpointsHandler(w http.ResponseWriter, r *http.Req
 	}
 	_, _ = w.Write(buf.Bytes())
 }
+
+// writeValidationError writes a 400 response listing every offending endpoint
+func writeValidationError(w http.ResponseWriter, err error) {
+	body := errorResponse{Error: err.Error()}
+	var validationErr *provider.ValidationError
+	if errors.As(err, &validationErr) {
+		body.Error = "validation failed"
+		body.Endpoints = validationErr.Endpoints
+	}
+	writeJSONError(w, http.StatusBadRequest, body)
+}
+
+// writeApplyError reports a failed ApplyChanges. Conflicts are sent with a 503
+// status, which external-dns treats as a soft error and retries on its next
+// cycle with the current records, where a 409 would stop it. Partial applies
+// are sent with a 503 as well, along with the outcome of every zone, so the
+// zones not applied are retried.
+func writeApplyError(w http.ResponseWriter, err error) {
+	var conflictErr *provider.ConflictError
+	if errors.As(err, &conflictErr) {
+		writeJSONError(w, http.StatusServiceUnavailable, errorResponse{Error: "conflict", Endpoints: conflictErr.Endpoints})
+		return
+	}
+	// external-dns only reads the status of the response: a 5xx up to 510 is
+	// a soft error, retried on its next cycle with a plan computed from the
+	// records in deSEC, so that only the zones not applied are sent again
+	var partialErr *provider.PartialApplyError
+	if errors.As(err, &partialErr) {
+		writeJSONError(w, http.StatusServiceUnavailable, errorResponse{Error: "partial", Message: err.Error(), Result: partialErr.Result})
+		return
+	}
+	log.Errorf("failed to apply changes: %v", err)
+	writeRequestError(w, err)
+}
+
+// writeRequestError reports an error with the status of its kind of failed
+// deSEC request, and the delay asked by deSEC in the Retry-After header.
+// Other errors are sent with a 500 status.
+func writeRequestError(w http.ResponseWriter, err error) {
+	var requestErr *provider.RequestError
+	if !errors.As(err, &requestErr) {
+		writeJSONError(w, http.StatusInternalServerError, errorResponse{Error: "internal error", Message: err.Error()})
+		return
+	}
+	body := errorResponse{Error: "internal error", Message: err.Error(), Details: requestErr.Messages}
+	status := http.StatusInternalServerError
+	for _, mapping := range requestErrorStatuses {
+		if errors.Is(requestErr.Kind, mapping.kind) {
+			body.Error, status = mapping.error, mapping.status
+			break
+		}
+	}
+	if requestErr.RetryAfter > 0 {
+		body.RetryAfter = int(math.Ceil(requestErr.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(body.RetryAfter))
+	}
+	writeJSONError(w, status, body)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, body errorResponse) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		log.Errorf("failed to encode error response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
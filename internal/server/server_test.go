@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -117,10 +119,11 @@ func TestRecordsHandler(t *testing.T) {
 
 	webhook.recordsHandler(w, req)
 
-	// Since we're using dry-run mode and a test token, the API call will likely fail
+	// Since we're using dry-run mode and a test token, the API call will likely fail,
+	// refused by deSEC or without reaching it
 	// But we should still get a proper HTTP response structure
-	if w.Code != http.StatusOK && w.Code != http.StatusInternalServerError {
-		t.Errorf("Status code = %v, expected %v or %v", w.Code, http.StatusOK, http.StatusInternalServerError)
+	if w.Code != http.StatusOK && w.Code != http.StatusUnauthorized && w.Code != http.StatusBadGateway {
+		t.Errorf("Status code = %v, expected %v, %v or %v", w.Code, http.StatusOK, http.StatusUnauthorized, http.StatusBadGateway)
 	}
 
 	// If the request succeeded, validate the JSON structure
@@ -227,6 +230,175 @@ func TestApplyChangesHandlerBadRequest(t *testing.T) {
 	}
 }
 
+func TestApplyChangesHandlerValidationError(t *testing.T) {
+	webhook := createTestWebhook()
+
+	changes := plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{
+				DNSName:    "new.example.com",
+				RecordType: "A",
+				Targets:    endpoint.Targets{"192.0.2.300"},
+			},
+			{
+				DNSName:    "empty.example.com",
+				RecordType: "AAAA",
+				Targets:    endpoint.Targets{},
+			},
+		},
+	}
+	body, err := json.Marshal(changes)
+	if err != nil {
+		t.Fatalf("Failed to marshal changes: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/records", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	log.SetLevel(log.ErrorLevel)
+	defer log.SetLevel(log.InfoLevel)
+
+	webhook.applyChangesHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Status code = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+
+	var response errorResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if len(response.Endpoints) != 2 {
+		t.Fatalf("Error response endpoints = %+v, want 2 entries", response.Endpoints)
+	}
+	if response.Endpoints[0].DNSName != "new.example.com" || response.Endpoints[1].DNSName != "empty.example.com" {
+		t.Errorf("Error response endpoints = %+v, want new.example.com and empty.example.com", response.Endpoints)
+	}
+}
+
+func TestWriteApplyError(t *testing.T) {
+	conflict := &provider.ConflictError{Endpoints: []provider.EndpointError{
+		{Change: "updateOld", DNSName: "www.example.com", RecordType: "A", Reason: "record no longer exists"},
+	}}
+
+	w := httptest.NewRecorder()
+	writeApplyError(w, fmt.Errorf("zone example.com: %w", conflict))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Status code = %v, want %v", w.Code, http.StatusServiceUnavailable)
+	}
+	var response errorResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if response.Error != "conflict" || len(response.Endpoints) != 1 || response.Endpoints[0].DNSName != "www.example.com" {
+		t.Errorf("Error response = %+v, want the conflicting endpoint", response)
+	}
+
+	result := &provider.ApplyResult{Status: provider.ApplyPartial, Zones: []provider.ZoneResult{
+		{Zone: "example.com", Status: provider.ResultApplied, RRSets: []provider.RRSetResult{}},
+		{Zone: "example.org", Status: provider.ResultFailed, Error: "deSEC unavailable", RRSets: []provider.RRSetResult{}},
+	}}
+	w = httptest.NewRecorder()
+	w.Header().Add("Content-Type", externalDnsWebhookHeader)
+	writeApplyError(w, &provider.PartialApplyError{Result: result, Err: errors.New("deSEC unavailable")})
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Status code = %v, want %v", w.Code, http.StatusServiceUnavailable)
+	}
+	// external-dns retries on its next cycle only after a 5xx up to 510, and
+	// stops on the other errors
+	if w.Code < http.StatusInternalServerError || w.Code > http.StatusNotExtended {
+		t.Errorf("Status code = %v, want one external-dns retries", w.Code)
+	}
+	if contentType := w.Header().Values("Content-Type"); !reflect.DeepEqual(contentType, []string{"application/json"}) {
+		t.Errorf("Content-Type = %v, want [application/json]", contentType)
+	}
+	response = errorResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if response.Error != "partial" || response.Result == nil || len(response.Result.Zones) != 2 || response.Result.Zones[1].Status != provider.ResultFailed {
+		t.Errorf("Error response = %+v, want the partial result", response)
+	}
+
+	w = httptest.NewRecorder()
+	log.SetLevel(log.PanicLevel)
+	defer log.SetLevel(log.InfoLevel)
+	writeApplyError(w, errors.New("deSEC unavailable"))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Status code = %v, want %v", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestWriteRequestError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedError  string
+		retryAfter     string
+	}{
+		{
+			name:           "Throttled",
+			err:            &provider.RequestError{Kind: provider.ErrThrottled, StatusCode: 429, RetryAfter: 1500 * time.Millisecond, Err: errors.New("429 Too Many Requests")},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedError:  "throttled",
+			retryAfter:     "2",
+		},
+		{
+			name:           "Unavailable",
+			err:            fmt.Errorf("zone example.com: %w", &provider.RequestError{Kind: provider.ErrUnavailable, Err: errors.New("connection refused")}),
+			expectedStatus: http.StatusBadGateway,
+			expectedError:  "unavailable",
+		},
+		{
+			name:           "Unauthorized",
+			err:            &provider.RequestError{Kind: provider.ErrUnauthorized, StatusCode: 401, Err: errors.New("401: Invalid token.")},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "unauthorized",
+		},
+		{
+			name:           "Invalid",
+			err:            &provider.RequestError{Kind: provider.ErrInvalid, StatusCode: 400, Messages: []string{"Invalid record."}, Err: errors.New("400: body")},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedError:  "invalid",
+		},
+		{
+			name:           "Not found",
+			err:            &provider.RequestError{Kind: provider.ErrNotFound, StatusCode: 404, Err: errors.New("404: Not found.")},
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "not found",
+		},
+		{
+			name:           "Other error",
+			err:            errors.New("failed to resolve alias target"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  "internal error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeRequestError(w, tt.err)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Status code = %v, want %v", w.Code, tt.expectedStatus)
+			}
+			if retryAfter := w.Header().Get("Retry-After"); retryAfter != tt.retryAfter {
+				t.Errorf("Retry-After = %q, want %q", retryAfter, tt.retryAfter)
+			}
+			var response errorResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+			if response.Error != tt.expectedError || response.Message != tt.err.Error() {
+				t.Errorf("Error response = %+v, want error %q with message %q", response, tt.expectedError, tt.err.Error())
+			}
+		})
+	}
+}
+
 func TestAdjustEndpointsHandler(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -319,6 +491,53 @@ func TestAdjustEndpointsHandlerBadRequest(t *testing.T) {
 	}
 }
 
+func TestAdjustEndpointsHandlerDropsInvalidEndpoints(t *testing.T) {
+	webhook := createTestWebhook()
+
+	endpoints := []*endpoint.Endpoint{
+		{
+			DNSName:    "www.example.com",
+			RecordType: "CNAME",
+			Targets:    endpoint.Targets{"alias.example.com"},
+		},
+		{
+			DNSName:    "www.example.com",
+			RecordType: "A",
+			Targets:    endpoint.Targets{"192.0.2.1"},
+		},
+		{
+			DNSName:    "bad.example.com",
+			RecordType: "A",
+			Targets:    endpoint.Targets{"192.0.2.300"},
+		},
+	}
+	body, err := json.Marshal(endpoints)
+	if err != nil {
+		t.Fatalf("Failed to marshal endpoints: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/adjustendpoints", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	log.SetLevel(log.ErrorLevel)
+	defer log.SetLevel(log.InfoLevel)
+
+	webhook.adjustEndpointsHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Status code = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var adjusted []*endpoint.Endpoint
+	if err := json.NewDecoder(w.Body).Decode(&adjusted); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(adjusted) != 1 || adjusted[0].DNSName != "www.example.com" || adjusted[0].RecordType != "A" {
+		t.Errorf("Adjusted endpoints = %+v, want only www.example.com/A", adjusted)
+	}
+}
+
 func TestWebhookServerRun(t *testing.T) {
 	config := config.Config{
 		APIToken:       "test-token",